@@ -3,16 +3,164 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"v65/asm"
+	"v65/debuginfo"
+	"v65/driver"
+	"v65/link"
+	"v65/o65"
+	"v65/obj"
+	"v65/output"
+	"v65/symfile"
 )
 
 func main() {
+	org := flag.Int("org", -1, "assemble absolute code for this address, instead of relocatable code")
+	base := flag.Int("base", -1, "address of the first relocatable segment in the output (default 0, or after the BASIC stub)")
+	out := flag.String("o", "", "write the code to this file")
+	format := flag.String("f", "bin", "format of the output: "+strings.Join(output.FormatNames(), ", "))
+	fill := flag.Int("fill", 0, "value of the unused bytes in a raw binary")
+	machine := flag.String("machine", "", "add a BASIC stub for this machine to a PRG: c64, vic20 or c128")
+	name := flag.String("name", "", "name of the program in a disk image (default the name of the source file)")
+	syms := flag.String("syms", "", "write the symbol table to this file")
+	symFormat := flag.String("symfmt", "generic", "format of the symbol table: "+strings.Join(symfile.FormatNames(), ", "))
+	debugInfo := flag.String("dbg", "", "write debug information to this file")
+	config := flag.String("C", "", "place the segments with this linker configuration, and write the memory areas to their files")
+	objFile := flag.String("obj", "", "write the object module to this file, for ld65 or ar65")
+	o65File := flag.String("o65", "", "write the object module to this file in the o65 format")
+	mapFile := flag.String("map", "", "write the map of the linked program to this file")
+	mapFormat := flag.String("mapfmt", "text", "format of the map: text or json")
+	gc := flag.Bool("gc", false, "drop the sections that are not used")
+	entries := flag.String("entry", "", "comma-separated symbols whose sections are used, with -gc")
 	flag.Parse()
 
+	writeOutput, ok := output.Formats[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s\n", *format)
+		os.Exit(2)
+	}
+	if *base < 0 {
+		*base = 0
+		if *machine != "" {
+			end, err := output.StubEnd(*machine)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			*base = end
+		}
+	}
+	if _, ok := driver.MapFormats[*mapFormat]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown map format: %s\n", *mapFormat)
+		os.Exit(2)
+	}
+	writeSyms, ok := symfile.Formats[*symFormat]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown symbol file format: %s\n", *symFormat)
+		os.Exit(2)
+	}
+	var cfg *link.Config
+	if *config != "" {
+		var err error
+		if cfg, err = driver.ReadConfig(*config); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot read configuration: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	status := 0
 	for _, sourceFile := range flag.Args() {
-		if _, err := asm.Assemble(sourceFile); err != nil {
+		ctx, err := asm.Assemble(sourceFile, asm.Options{Org: *org})
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "assembly error: %v\n", err)
+			status = 1
+			continue
+		}
+		if *objFile != "" {
+			if err := driver.WriteFile(*objFile, func(w io.Writer) error { return obj.Write(w, ctx.Module()) }); err != nil {
+				fmt.Fprintf(os.Stderr, "cannot write object module: %v\n", err)
+				status = 1
+			}
+		}
+		if *o65File != "" {
+			if err := driver.WriteFile(*o65File, func(w io.Writer) error { return o65.Write(w, ctx.Module()) }); err != nil {
+				fmt.Fprintf(os.Stderr, "cannot write o65 file: %v\n", err)
+				status = 1
+			}
+		}
+		var img *link.Image
+		if *out != "" || cfg != nil || *mapFile != "" {
+			mods := []*obj.Module{ctx.Module()}
+			if *gc {
+				mods = driver.Strip(os.Stdout, mods, *entries)
+			}
+			if cfg != nil {
+				img, err = link.LinkConfig(mods, cfg)
+			} else {
+				img, err = link.Link(mods, *base)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "link error: %v\n", err)
+				status = 1
+				continue
+			}
+			opts := output.Options{
+				Fill:       byte(*fill),
+				Machine:    *machine,
+				Vectors:    img.Vectors,
+				Attributes: img.Attributes,
+				Name:       *name,
+			}
+			if opts.Name == "" {
+				opts.Name = strings.TrimSuffix(filepath.Base(sourceFile), filepath.Ext(sourceFile))
+			}
+			if *out != "" {
+				if err := driver.WriteFile(*out, func(w io.Writer) error { return writeOutput(w, output.FromImage(img), opts) }); err != nil {
+					fmt.Fprintf(os.Stderr, "cannot write output: %v\n", err)
+					status = 1
+				}
+			}
+			if *mapFile != "" {
+				if err := driver.WriteMap(*mapFile, *mapFormat, img, cfg); err != nil {
+					fmt.Fprintf(os.Stderr, "cannot write map: %v\n", err)
+					status = 1
+				}
+			}
+			if cfg != nil {
+				if err := driver.WriteAreas(img, cfg, writeOutput, opts); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					status = 1
+				}
+			}
+		}
+		if *syms != "" {
+			table := ctx.Symbols()
+			if img != nil {
+				table = img.SymbolTable(table)
+			}
+			if err := driver.WriteFile(*syms, func(w io.Writer) error { return writeSyms(w, table) }); err != nil {
+				fmt.Fprintf(os.Stderr, "cannot write symbols: %v\n", err)
+				status = 1
+			}
+		}
+		if *debugInfo != "" {
+			var entries []*debuginfo.Entry
+			if img != nil {
+				entries = img.DebugInfo()
+			} else {
+				// Without a link, relocatable segments are assumed to
+				// start at address 0.
+				for _, seg := range ctx.Module().Segments {
+					entries = append(entries, debuginfo.FromSegment(seg, seg.Addr)...)
+				}
+			}
+			if err := driver.WriteFile(*debugInfo, func(w io.Writer) error { return debuginfo.Write(w, entries) }); err != nil {
+				fmt.Fprintf(os.Stderr, "cannot write debug information: %v\n", err)
+				status = 1
+			}
 		}
 	}
+	os.Exit(status)
 }
@@ -0,0 +1,332 @@
+// Package apple2 writes and reads the files and 140K floppy disk images
+// of the Apple II, for DOS 3.3 and ProDOS.
+package apple2
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// DiskSize is the size of a 140K disk image.
+const DiskSize = tracks * sectorsPerTrack * sectorSize
+
+const (
+	tracks          = 35
+	sectorsPerTrack = 16
+	sectorSize      = 256
+
+	vtocTrack    = 17
+	firstTrack   = 3 // Tracks 0-2 hold DOS itself.
+	catalogStart = 0x0b
+	catEntrySize = 35
+	catNameSize  = 30
+	tsPairs      = 122 // Track/sector pairs in a T/S list sector.
+	volumeNumber = 254
+
+	// TypeBinary is the DOS 3.3 file type of a binary file.
+	TypeBinary = 0x04
+)
+
+// BinaryFile returns the contents of a DOS 3.3 binary file: the load
+// address and the length, followed by the data.
+func BinaryFile(addr int, data []byte) []byte {
+	header := []byte{byte(addr), byte(addr >> 8), byte(len(data)), byte(len(data) >> 8)}
+	return append(header, data...)
+}
+
+// ParseBinaryFile returns the load address and the data of a DOS 3.3
+// binary file.
+func ParseBinaryFile(file []byte) (addr int, data []byte, err error) {
+	if len(file) < 4 {
+		return 0, nil, fmt.Errorf("binary file too short: %d bytes", len(file))
+	}
+	addr = int(file[0]) | int(file[1])<<8
+	n := int(file[2]) | int(file[3])<<8
+	if len(file) < 4+n {
+		return 0, nil, fmt.Errorf("binary file truncated: %d of %d bytes", len(file)-4, n)
+	}
+	return addr, file[4 : 4+n], nil
+}
+
+// DOSDisk is a DOS 3.3 disk image in DOS sector order (.dsk).
+type DOSDisk struct {
+	data []byte
+}
+
+// DOSFile is a file in the catalog of a DOS 3.3 disk.
+type DOSFile struct {
+	Name string
+	Type byte
+	Data []byte // For a binary file this includes the header.
+}
+
+// sector returns the contents of a sector.
+func (d *DOSDisk) sector(track, sec int) []byte {
+	offset := (track*sectorsPerTrack + sec) * sectorSize
+	return d.data[offset : offset+sectorSize]
+}
+
+// vtoc returns the volume table of contents.
+func (d *DOSDisk) vtoc() []byte {
+	return d.sector(vtocTrack, 0)
+}
+
+// bitmap returns the two bytes of the free sector bitmap of a track. Bit 7
+// of the first byte is sector 15 and bit 0 of the second byte sector 0.
+func (d *DOSDisk) bitmap(track int) []byte {
+	return d.vtoc()[0x38+4*track:]
+}
+
+// isFree returns true if a sector is not in use.
+func (d *DOSDisk) isFree(track, sec int) bool {
+	return d.bitmap(track)[1-sec/8]&(1<<uint(sec%8)) != 0
+}
+
+// setFree marks a sector as free or used.
+func (d *DOSDisk) setFree(track, sec int, free bool) {
+	b := &d.bitmap(track)[1-sec/8]
+	if free {
+		*b |= 1 << uint(sec%8)
+	} else {
+		*b &^= 1 << uint(sec%8)
+	}
+}
+
+// NewDOSDisk creates an empty DOS 3.3 disk. There is no DOS on the disk,
+// so it cannot be booted, but the catalog and the files are complete.
+func NewDOSDisk() *DOSDisk {
+	d := &DOSDisk{data: make([]byte, DiskSize)}
+	vtoc := d.vtoc()
+	vtoc[0x01], vtoc[0x02] = vtocTrack, sectorsPerTrack-1
+	vtoc[0x03] = 3 // DOS version.
+	vtoc[0x06] = volumeNumber
+	vtoc[0x27] = tsPairs
+	vtoc[0x30], vtoc[0x31] = vtocTrack, 1 // Last track allocated and direction.
+	vtoc[0x34], vtoc[0x35] = tracks, sectorsPerTrack
+	vtoc[0x36], vtoc[0x37] = 0x00, 0x01 // Bytes per sector.
+	for t := firstTrack; t < tracks; t++ {
+		if t == vtocTrack {
+			continue
+		}
+		for s := 0; s < sectorsPerTrack; s++ {
+			d.setFree(t, s, true)
+		}
+	}
+	// The catalog is a chain from sector 15 down to sector 1.
+	for s := sectorsPerTrack - 1; s > 0; s-- {
+		cat := d.sector(vtocTrack, s)
+		if s > 1 {
+			cat[0x01], cat[0x02] = vtocTrack, byte(s-1)
+		}
+	}
+	return d
+}
+
+// ReadDOSDisk reads a DOS 3.3 disk image.
+func ReadDOSDisk(data []byte) (*DOSDisk, error) {
+	if len(data) != DiskSize {
+		return nil, fmt.Errorf("not a 140K disk image: size %d", len(data))
+	}
+	d := &DOSDisk{data: append([]byte(nil), data...)}
+	if vtoc := d.vtoc(); vtoc[0x34] != tracks || vtoc[0x35] != sectorsPerTrack {
+		return nil, fmt.Errorf("not a DOS 3.3 disk")
+	}
+	return d, nil
+}
+
+// Bytes returns the disk image.
+func (d *DOSDisk) Bytes() []byte {
+	return d.data
+}
+
+// allocate allocates a free sector, starting at the track after the
+// catalog and moving outward, then at the track before the catalog and
+// moving inward, like DOS does.
+func (d *DOSDisk) allocate() (track, sec int, err error) {
+	var order []int
+	for t := vtocTrack + 1; t < tracks; t++ {
+		order = append(order, t)
+	}
+	for t := vtocTrack - 1; t >= firstTrack; t-- {
+		order = append(order, t)
+	}
+	for _, t := range order {
+		for s := sectorsPerTrack - 1; s >= 0; s-- {
+			if d.isFree(t, s) {
+				d.setFree(t, s, false)
+				return t, s, nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("disk full")
+}
+
+// freeSectors returns the number of free sectors.
+func (d *DOSDisk) freeSectors() int {
+	n := 0
+	for t := 0; t < tracks; t++ {
+		for s := 0; s < sectorsPerTrack; s++ {
+			if d.isFree(t, s) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// catalog calls f with every catalog entry, used or not, until f returns
+// false.
+func (d *DOSDisk) catalog(f func(entry []byte) bool) error {
+	vtoc := d.vtoc()
+	track, sec := int(vtoc[0x01]), int(vtoc[0x02])
+	for seen := 0; track != 0; seen++ {
+		if track >= tracks || sec >= sectorsPerTrack || seen == sectorsPerTrack {
+			return fmt.Errorf("corrupt catalog")
+		}
+		cat := d.sector(track, sec)
+		for i := catalogStart; i+catEntrySize <= sectorSize; i += catEntrySize {
+			if !f(cat[i : i+catEntrySize]) {
+				return nil
+			}
+		}
+		track, sec = int(cat[0x01]), int(cat[0x02])
+	}
+	return nil
+}
+
+// dosName returns a file name in high-bit ASCII, padded with spaces.
+func dosName(name string) []byte {
+	b := bytes.Repeat([]byte{' ' | 0x80}, catNameSize)
+	for i, c := range []byte(strings.ToUpper(name)) {
+		b[i] = c | 0x80
+	}
+	return b
+}
+
+// AddFile writes a file to the disk and adds it to the catalog. For a
+// binary file, data has to include the header (see BinaryFile).
+func (d *DOSDisk) AddFile(name string, typ byte, data []byte) error {
+	if name == "" || len(name) > catNameSize {
+		return fmt.Errorf("invalid file name: %q", name)
+	}
+	if _, err := d.ReadFile(name); err == nil {
+		return fmt.Errorf("file exists: %s", name)
+	}
+	dataSectors := (len(data) + sectorSize - 1) / sectorSize
+	listSectors := (dataSectors + tsPairs - 1) / tsPairs
+	if listSectors == 0 {
+		listSectors = 1
+	}
+	if dataSectors+listSectors > d.freeSectors() {
+		return fmt.Errorf("disk full: %s needs %d sectors", name, dataSectors+listSectors)
+	}
+	var entry []byte
+	err := d.catalog(func(e []byte) bool {
+		if e[0] == 0 || e[0] == 0xff {
+			entry = e
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return fmt.Errorf("catalog full")
+	}
+
+	// Write the T/S lists and the data.
+	var list []byte
+	var listTrack, listSec int
+	for i := 0; i < dataSectors || list == nil; i++ {
+		if i%tsPairs == 0 {
+			t, s, _ := d.allocate()
+			if list == nil {
+				listTrack, listSec = t, s
+			} else {
+				list[0x01], list[0x02] = byte(t), byte(s)
+			}
+			list = d.sector(t, s)
+			list[0x05], list[0x06] = byte(i), byte(i>>8)
+		}
+		if i == dataSectors {
+			break
+		}
+		t, s, _ := d.allocate()
+		copy(d.sector(t, s), data[i*sectorSize:])
+		pair := 0x0c + 2*(i%tsPairs)
+		list[pair], list[pair+1] = byte(t), byte(s)
+	}
+
+	entry[0], entry[1] = byte(listTrack), byte(listSec)
+	entry[2] = typ
+	copy(entry[3:], dosName(name))
+	size := dataSectors + listSectors
+	entry[33], entry[34] = byte(size), byte(size>>8)
+	return nil
+}
+
+// Files returns the files in the catalog. The data of a file is read in
+// whole sectors, so for a binary file it can be longer than the length in
+// its header.
+func (d *DOSDisk) Files() ([]*DOSFile, error) {
+	var files []*DOSFile
+	var err error
+	catErr := d.catalog(func(entry []byte) bool {
+		if entry[0] == 0 || entry[0] == 0xff {
+			return true
+		}
+		var f *DOSFile
+		if f, err = d.readFile(entry); err != nil {
+			return false
+		}
+		files = append(files, f)
+		return true
+	})
+	if err == nil {
+		err = catErr
+	}
+	return files, err
+}
+
+// ReadFile returns the contents of the file with the given name.
+func (d *DOSDisk) ReadFile(name string) ([]byte, error) {
+	files, err := d.Files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Name == strings.ToUpper(name) {
+			return f.Data, nil
+		}
+	}
+	return nil, fmt.Errorf("file not found: %s", name)
+}
+
+// readFile reads the file of a catalog entry by following its T/S lists.
+func (d *DOSDisk) readFile(entry []byte) (*DOSFile, error) {
+	name := make([]byte, catNameSize)
+	for i, c := range entry[3 : 3+catNameSize] {
+		name[i] = c &^ 0x80
+	}
+	f := &DOSFile{Name: strings.TrimRight(string(name), " "), Type: entry[2] &^ 0x80}
+	track, sec := int(entry[0]), int(entry[1])
+	for seen := 0; track != 0; seen++ {
+		if track >= tracks || sec >= sectorsPerTrack || seen == tracks*sectorsPerTrack {
+			return nil, fmt.Errorf("%s: invalid T/S list at %d/%d", f.Name, track, sec)
+		}
+		list := d.sector(track, sec)
+		for i := 0x0c; i < sectorSize; i += 2 {
+			if list[i] == 0 {
+				break
+			}
+			if int(list[i]) >= tracks || int(list[i+1]) >= sectorsPerTrack {
+				return nil, fmt.Errorf("%s: invalid sector %d/%d", f.Name, list[i], list[i+1])
+			}
+			f.Data = append(f.Data, d.sector(int(list[i]), int(list[i+1]))...)
+		}
+		track, sec = int(list[0x01]), int(list[0x02])
+	}
+	return f, nil
+}
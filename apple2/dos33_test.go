@@ -0,0 +1,89 @@
+package apple2
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// testData returns n bytes of test data.
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*13 + n)
+	}
+	return data
+}
+
+func TestBinaryFile(t *testing.T) {
+	file := BinaryFile(0x0803, []byte{0xea, 0x60})
+	if want := []byte{0x03, 0x08, 0x02, 0x00, 0xea, 0x60}; !bytes.Equal(file, want) {
+		t.Errorf("BinaryFile(); got:% x, want:% x", file, want)
+	}
+	addr, data, err := ParseBinaryFile(append(file, 0, 0))
+	if err != nil || addr != 0x0803 || !bytes.Equal(data, []byte{0xea, 0x60}) {
+		t.Errorf("ParseBinaryFile(); got:$%04x/% x/%v, want:$0803/ea 60/nil", addr, data, err)
+	}
+	if _, _, err := ParseBinaryFile(file[:5]); err == nil {
+		t.Errorf("ParseBinaryFile() of truncated file; got:nil, want:error")
+	}
+}
+
+func TestDOSDisk(t *testing.T) {
+	d := NewDOSDisk()
+	files := []*DOSFile{
+		{"HELLO", TypeBinary, BinaryFile(0x0803, testData(1000))},
+		{"LARGE", TypeBinary, BinaryFile(0x2000, testData(40000))},
+		{"EMPTY", TypeBinary, nil},
+	}
+	for i := 0; i < 6; i++ {
+		// Enough files to need a second catalog sector.
+		files = append(files, &DOSFile{fmt.Sprintf("FILE %d", i), TypeBinary, BinaryFile(0x4000, testData(i))})
+	}
+	for _, f := range files {
+		if err := d.AddFile(f.Name, f.Type, f.Data); err != nil {
+			t.Fatalf("AddFile(%s); got:%v, want:nil", f.Name, err)
+		}
+	}
+	d, err := ReadDOSDisk(d.Bytes())
+	if err != nil {
+		t.Fatalf("ReadDOSDisk(); got:%v, want:nil", err)
+	}
+	got, err := d.Files()
+	if err != nil {
+		t.Fatalf("Files(); got:%v, want:nil", err)
+	}
+	if len(got) != len(files) {
+		t.Fatalf("len(Files()); got:%d, want:%d", len(got), len(files))
+	}
+	for i, f := range files {
+		// Files are read in whole sectors.
+		if got[i].Name != f.Name || got[i].Type != f.Type || !bytes.HasPrefix(got[i].Data, f.Data) || len(got[i].Data)-len(f.Data) >= sectorSize {
+			t.Errorf("file %d; got:%s/%x (%d bytes), want:%s/%x (%d bytes)", i, got[i].Name, got[i].Type, len(got[i].Data), f.Name, f.Type, len(f.Data))
+		}
+	}
+	data, err := d.ReadFile("large")
+	if err != nil {
+		t.Fatalf("ReadFile(large); got:%v, want:nil", err)
+	}
+	if addr, data, err := ParseBinaryFile(data); err != nil || addr != 0x2000 || !bytes.Equal(data, testData(40000)) {
+		t.Errorf("ParseBinaryFile(large); got:$%04x/%d bytes/%v, want:$2000/40000 bytes/nil", addr, len(data), err)
+	}
+}
+
+func TestDOSDiskErrors(t *testing.T) {
+	if _, err := ReadDOSDisk(make([]byte, DiskSize)); err == nil {
+		t.Errorf("ReadDOSDisk() of empty image; got:nil, want:error")
+	}
+	d := NewDOSDisk()
+	if err := d.AddFile("", TypeBinary, nil); err == nil {
+		t.Errorf("AddFile() without name; got:nil, want:error")
+	}
+	if err := d.AddFile("BIG", TypeBinary, testData(DiskSize)); err == nil {
+		t.Errorf("AddFile() of too large file; got:nil, want:error")
+	}
+	d.AddFile("A", TypeBinary, nil)
+	if err := d.AddFile("A", TypeBinary, nil); err == nil {
+		t.Errorf("AddFile() of existing file; got:nil, want:error")
+	}
+}
@@ -0,0 +1,315 @@
+package apple2
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	blockSize   = 512
+	totalBlocks = DiskSize / blockSize
+
+	volDirBlock    = 2 // Key block of the volume directory.
+	volDirBlocks   = 4
+	bitmapBlock    = volDirBlock + volDirBlocks
+	entryLength    = 0x27
+	entriesPerBlk  = 0x0d
+	prodosNameSize = 15
+	maxSapling     = 256 * blockSize // Largest file with a single index block.
+
+	// Storage types.
+	seedling  = 1
+	sapling   = 2
+	volHeader = 0x0f
+
+	// TypeBIN is the ProDOS file type of a binary file. Its aux type is
+	// the load address.
+	TypeBIN = 0x06
+
+	accessAll = 0xe3 // Destroy, rename, write and read enabled.
+)
+
+// ProDOSVolume is a ProDOS disk image in ProDOS block order (.po).
+type ProDOSVolume struct {
+	data []byte
+}
+
+// ProDOSFile is a file in the volume directory of a ProDOS disk.
+type ProDOSFile struct {
+	Name    string
+	Type    byte
+	AuxType int
+	Data    []byte
+}
+
+// block returns the contents of a block.
+func (v *ProDOSVolume) block(n int) []byte {
+	return v.data[n*blockSize : (n+1)*blockSize]
+}
+
+// isFree returns true if a block is not in use. Bit 7 of the first byte of
+// the bitmap is block 0.
+func (v *ProDOSVolume) isFree(n int) bool {
+	return v.block(bitmapBlock)[n/8]&(0x80>>uint(n%8)) != 0
+}
+
+// setFree marks a block as free or used.
+func (v *ProDOSVolume) setFree(n int, free bool) {
+	b := &v.block(bitmapBlock)[n/8]
+	if free {
+		*b |= 0x80 >> uint(n%8)
+	} else {
+		*b &^= 0x80 >> uint(n%8)
+	}
+}
+
+// validName returns an error if name is not a valid ProDOS name: a letter
+// followed by letters, digits and periods, at most 15 characters.
+func validName(name string) error {
+	if name == "" || len(name) > prodosNameSize {
+		return fmt.Errorf("invalid ProDOS name: %q", name)
+	}
+	for i, c := range strings.ToUpper(name) {
+		letter := c >= 'A' && c <= 'Z'
+		if !letter && (i == 0 || !(c >= '0' && c <= '9' || c == '.')) {
+			return fmt.Errorf("invalid ProDOS name: %q", name)
+		}
+	}
+	return nil
+}
+
+// put16 stores a little endian word.
+func put16(b []byte, v int) {
+	b[0], b[1] = byte(v), byte(v>>8)
+}
+
+// get16 returns a little endian word.
+func get16(b []byte) int {
+	return int(b[0]) | int(b[1])<<8
+}
+
+// NewProDOSVolume creates an empty ProDOS volume with a name. There is no
+// boot loader in blocks 0 and 1.
+func NewProDOSVolume(name string) (*ProDOSVolume, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	v := &ProDOSVolume{data: make([]byte, DiskSize)}
+	for n := bitmapBlock + 1; n < totalBlocks; n++ {
+		v.setFree(n, true)
+	}
+	for i := 0; i < volDirBlocks; i++ {
+		dir := v.block(volDirBlock + i)
+		if i > 0 {
+			put16(dir[0:], volDirBlock+i-1)
+		}
+		if i < volDirBlocks-1 {
+			put16(dir[2:], volDirBlock+i+1)
+		}
+	}
+	header := v.block(volDirBlock)[4:]
+	header[0] = volHeader<<4 | byte(len(name))
+	copy(header[1:], strings.ToUpper(name))
+	header[0x1e] = 0xc3 // Access.
+	header[0x1f] = entryLength
+	header[0x20] = entriesPerBlk
+	put16(header[0x23:], bitmapBlock)
+	put16(header[0x25:], totalBlocks)
+	return v, nil
+}
+
+// ReadProDOSVolume reads a ProDOS disk image.
+func ReadProDOSVolume(data []byte) (*ProDOSVolume, error) {
+	if len(data) != DiskSize {
+		return nil, fmt.Errorf("not a 140K disk image: size %d", len(data))
+	}
+	v := &ProDOSVolume{data: append([]byte(nil), data...)}
+	if header := v.block(volDirBlock)[4:]; header[0]>>4 != volHeader || get16(header[0x25:]) != totalBlocks {
+		return nil, fmt.Errorf("not a ProDOS volume")
+	}
+	return v, nil
+}
+
+// Bytes returns the disk image.
+func (v *ProDOSVolume) Bytes() []byte {
+	return v.data
+}
+
+// Name returns the name of the volume.
+func (v *ProDOSVolume) Name() string {
+	header := v.block(volDirBlock)[4:]
+	return string(header[1 : 1+header[0]&0x0f])
+}
+
+// allocate allocates the first free block.
+func (v *ProDOSVolume) allocate() (int, error) {
+	for n := 0; n < totalBlocks; n++ {
+		if v.isFree(n) {
+			v.setFree(n, false)
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("disk full")
+}
+
+// entries calls f with every file entry of the volume directory, used or
+// not, until f returns false.
+func (v *ProDOSVolume) entries(f func(entry []byte) bool) error {
+	n := volDirBlock
+	for seen := 0; n != 0; seen++ {
+		if n >= totalBlocks || seen == totalBlocks {
+			return fmt.Errorf("corrupt volume directory")
+		}
+		dir := v.block(n)
+		for i := 0; i < entriesPerBlk; i++ {
+			if n == volDirBlock && i == 0 {
+				continue // The volume header.
+			}
+			offset := 4 + i*entryLength
+			if !f(dir[offset : offset+entryLength]) {
+				return nil
+			}
+		}
+		n = get16(dir[2:])
+	}
+	return nil
+}
+
+// AddFile writes a file to the volume and adds it to the volume directory.
+func (v *ProDOSVolume) AddFile(name string, typ byte, auxType int, data []byte) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	if _, err := v.ReadFile(name); err == nil {
+		return fmt.Errorf("file exists: %s", name)
+	}
+	if len(data) > maxSapling {
+		return fmt.Errorf("%s is too large: %d bytes", name, len(data))
+	}
+	var entry []byte
+	err := v.entries(func(e []byte) bool {
+		if e[0] == 0 {
+			entry = e
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return fmt.Errorf("volume directory full")
+	}
+	dataBlocks := (len(data) + blockSize - 1) / blockSize
+	if dataBlocks == 0 {
+		dataBlocks = 1
+	}
+	used := dataBlocks
+	storage := seedling
+	if dataBlocks > 1 {
+		storage = sapling
+		used++ // The index block.
+	}
+	free := 0
+	for n := 0; n < totalBlocks; n++ {
+		if v.isFree(n) {
+			free++
+		}
+	}
+	if used > free {
+		return fmt.Errorf("disk full: %s needs %d blocks", name, used)
+	}
+
+	key, _ := v.allocate()
+	index := v.block(key)
+	for i := 0; i < dataBlocks; i++ {
+		n := key
+		if storage == sapling {
+			n, _ = v.allocate()
+			index[i], index[256+i] = byte(n), byte(n>>8)
+		}
+		copy(v.block(n), data[i*blockSize:])
+	}
+
+	entry[0] = byte(storage<<4) | byte(len(name))
+	copy(entry[1:], strings.ToUpper(name))
+	entry[0x10] = typ
+	put16(entry[0x11:], key)
+	put16(entry[0x13:], used)
+	entry[0x15], entry[0x16], entry[0x17] = byte(len(data)), byte(len(data)>>8), byte(len(data)>>16)
+	entry[0x1e] = accessAll
+	put16(entry[0x1f:], auxType)
+	put16(entry[0x25:], volDirBlock)
+	header := v.block(volDirBlock)[4:]
+	put16(header[0x21:], get16(header[0x21:])+1)
+	return nil
+}
+
+// Files returns the files in the volume directory.
+func (v *ProDOSVolume) Files() ([]*ProDOSFile, error) {
+	var files []*ProDOSFile
+	var err error
+	dirErr := v.entries(func(entry []byte) bool {
+		if entry[0] == 0 {
+			return true
+		}
+		var f *ProDOSFile
+		if f, err = v.readFile(entry); err != nil {
+			return false
+		}
+		files = append(files, f)
+		return true
+	})
+	if err == nil {
+		err = dirErr
+	}
+	return files, err
+}
+
+// ReadFile returns the contents of the file with the given name.
+func (v *ProDOSVolume) ReadFile(name string) ([]byte, error) {
+	files, err := v.Files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Name == strings.ToUpper(name) {
+			return f.Data, nil
+		}
+	}
+	return nil, fmt.Errorf("file not found: %s", name)
+}
+
+// readFile reads the file of a directory entry.
+func (v *ProDOSVolume) readFile(entry []byte) (*ProDOSFile, error) {
+	f := &ProDOSFile{
+		Name:    string(entry[1 : 1+entry[0]&0x0f]),
+		Type:    entry[0x10],
+		AuxType: get16(entry[0x1f:]),
+	}
+	key := get16(entry[0x11:])
+	size := int(entry[0x15]) | int(entry[0x16])<<8 | int(entry[0x17])<<16
+	if key >= totalBlocks || size > maxSapling {
+		return nil, fmt.Errorf("%s: invalid entry", f.Name)
+	}
+	switch entry[0] >> 4 {
+	case seedling:
+		if size > blockSize {
+			return nil, fmt.Errorf("%s: seedling file too large: %d bytes", f.Name, size)
+		}
+		f.Data = append(f.Data, v.block(key)[:size]...)
+	case sapling:
+		index := v.block(key)
+		for i := 0; len(f.Data) < size; i++ {
+			n := int(index[i]) | int(index[256+i])<<8
+			if n == 0 || n >= totalBlocks {
+				return nil, fmt.Errorf("%s: invalid block %d", f.Name, n)
+			}
+			f.Data = append(f.Data, v.block(n)...)
+		}
+		f.Data = f.Data[:size]
+	default:
+		return nil, fmt.Errorf("%s: unsupported storage type %d", f.Name, entry[0]>>4)
+	}
+	return f, nil
+}
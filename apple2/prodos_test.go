@@ -0,0 +1,68 @@
+package apple2
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestProDOSVolume(t *testing.T) {
+	v, err := NewProDOSVolume("test.disk")
+	if err != nil {
+		t.Fatalf("NewProDOSVolume(); got:%v, want:nil", err)
+	}
+	files := []*ProDOSFile{
+		{"HELLO", TypeBIN, 0x0803, testData(300)},
+		{"LARGE", TypeBIN, 0x2000, testData(30000)},
+		{"EMPTY", TypeBIN, 0x4000, []byte{}},
+	}
+	for i := 0; i < 12; i++ {
+		// Enough files to need a second directory block.
+		files = append(files, &ProDOSFile{fmt.Sprintf("FILE%d", i), TypeBIN, 0x4000, testData(i)})
+	}
+	for _, f := range files {
+		if err := v.AddFile(f.Name, f.Type, f.AuxType, f.Data); err != nil {
+			t.Fatalf("AddFile(%s); got:%v, want:nil", f.Name, err)
+		}
+	}
+	v, err = ReadProDOSVolume(v.Bytes())
+	if err != nil {
+		t.Fatalf("ReadProDOSVolume(); got:%v, want:nil", err)
+	}
+	if v.Name() != "TEST.DISK" {
+		t.Errorf("Name(); got:%s, want:TEST.DISK", v.Name())
+	}
+	got, err := v.Files()
+	if err != nil {
+		t.Fatalf("Files(); got:%v, want:nil", err)
+	}
+	if len(got) != len(files) {
+		t.Fatalf("len(Files()); got:%d, want:%d", len(got), len(files))
+	}
+	for i, f := range files {
+		if got[i].Name != f.Name || got[i].Type != f.Type || got[i].AuxType != f.AuxType || !bytes.Equal(got[i].Data, f.Data) {
+			t.Errorf("file %d; got:%s/%x/$%04x (%d bytes), want:%s/%x/$%04x (%d bytes)", i, got[i].Name, got[i].Type, got[i].AuxType, len(got[i].Data), f.Name, f.Type, f.AuxType, len(f.Data))
+		}
+	}
+	if count := get16(v.block(volDirBlock)[4+0x21:]); count != len(files) {
+		t.Errorf("file count; got:%d, want:%d", count, len(files))
+	}
+}
+
+func TestProDOSErrors(t *testing.T) {
+	for _, name := range []string{"", "1ABC", "A B", "SIXTEEN.LETTERS."} {
+		if _, err := NewProDOSVolume(name); err == nil {
+			t.Errorf("NewProDOSVolume(%q); got:nil, want:error", name)
+		}
+	}
+	if _, err := ReadProDOSVolume(make([]byte, DiskSize)); err == nil {
+		t.Errorf("ReadProDOSVolume() of empty image; got:nil, want:error")
+	}
+	v, _ := NewProDOSVolume("VOL")
+	if err := v.AddFile("BIG", TypeBIN, 0, testData(maxSapling+1)); err == nil {
+		t.Errorf("AddFile() of too large file; got:nil, want:error")
+	}
+	if err := v.AddFile("FULL", TypeBIN, 0, testData(140*1024)); err == nil {
+		t.Errorf("AddFile() of file larger than the disk; got:nil, want:error")
+	}
+}
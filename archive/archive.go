@@ -0,0 +1,103 @@
+// Package archive reads and writes libraries of object modules. An
+// archive has an index of the symbols that its modules export, so that the
+// linker can find the modules it needs without looking at every one.
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"v65/obj"
+)
+
+// FileFormat identifies an archive file and the version of its format.
+const FileFormat = "v65-archive 1"
+
+// Archive is a library of object modules. Modules are added with Add, so
+// that the index stays up to date.
+type Archive struct {
+	Modules []*obj.Module
+	index   map[string]string // The index read from a file, nil if it is unknown.
+}
+
+// file is an archive file: the modules and their index, encoded as JSON.
+type file struct {
+	Format  string
+	Index   map[string]string // The module that exports each symbol.
+	Modules []*obj.Module
+}
+
+// Add adds a module to the archive. It replaces a module with the same
+// name. It is an error if another module already exports a symbol of the
+// module.
+func (ar *Archive) Add(mod *obj.Module) error {
+	index := ar.Index()
+	for _, sym := range mod.Symbols {
+		if other, ok := index[sym.Name]; ok && other != mod.Name {
+			return fmt.Errorf("%s: symbol %s is already exported by %s", mod.Name, sym.Name, other)
+		}
+	}
+	ar.index = nil
+	for i, m := range ar.Modules {
+		if m.Name == mod.Name {
+			ar.Modules[i] = mod
+			return nil
+		}
+	}
+	ar.Modules = append(ar.Modules, mod)
+	return nil
+}
+
+// Index returns the name of the module that exports each symbol. For an
+// archive that was read, that is the index of the file.
+func (ar *Archive) Index() map[string]string {
+	if ar.index != nil {
+		return ar.index
+	}
+	index := make(map[string]string)
+	for _, mod := range ar.Modules {
+		for _, sym := range mod.Symbols {
+			index[sym.Name] = mod.Name
+		}
+	}
+	return index
+}
+
+// Symbols returns the names of the exported symbols, sorted.
+func (ar *Archive) Symbols() []string {
+	var names []string
+	for name := range ar.Index() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write writes an archive.
+func Write(w io.Writer, ar *Archive) error {
+	enc := json.NewEncoder(w)
+	return enc.Encode(&file{Format: FileFormat, Index: ar.Index(), Modules: ar.Modules})
+}
+
+// Read reads an archive. Its index is used to find the modules, so every
+// symbol in it must belong to a module of the archive.
+func Read(r io.Reader) (*Archive, error) {
+	var f file
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("not an archive: %v", err)
+	}
+	if f.Format != FileFormat {
+		return nil, fmt.Errorf("not an archive: format %q", f.Format)
+	}
+	names := make(map[string]bool)
+	for _, mod := range f.Modules {
+		names[mod.Name] = true
+	}
+	for sym, name := range f.Index {
+		if !names[name] {
+			return nil, fmt.Errorf("index: symbol %s is exported by unknown module %s", sym, name)
+		}
+	}
+	return &Archive{Modules: f.Modules, index: f.Index}, nil
+}
@@ -0,0 +1,78 @@
+package archive
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"v65/obj"
+)
+
+// module returns a module that exports symbols.
+func module(name string, symbols ...string) *obj.Module {
+	mod := &obj.Module{Name: name}
+	for _, sym := range symbols {
+		mod.Symbols = append(mod.Symbols, &obj.Symbol{Name: sym})
+	}
+	return mod
+}
+
+func TestAdd(t *testing.T) {
+	ar := &Archive{}
+	for _, mod := range []*obj.Module{module("mul.s", "mul8", "mul16"), module("div.s", "div8")} {
+		if err := ar.Add(mod); err != nil {
+			t.Fatalf("Add(%s); got:%v, want:nil", mod.Name, err)
+		}
+	}
+	if err := ar.Add(module("fastmul.s", "mul8")); err == nil || !strings.Contains(err.Error(), "already exported by mul.s") {
+		t.Errorf("Add(fastmul.s); got:%v, want:already exported error", err)
+	}
+	if err := ar.Add(module("mul.s", "mul8")); err != nil {
+		t.Errorf("Add(mul.s) again; got:%v, want:nil", err)
+	}
+	if got, want := ar.Symbols(), []string{"div8", "mul8"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Symbols(); got:%v, want:%v", got, want)
+	}
+	if got := ar.Index()["div8"]; got != "div.s" {
+		t.Errorf("Index()[div8]; got:%s, want:div.s", got)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	ar := &Archive{Modules: []*obj.Module{module("mul.s", "mul8"), module("div.s", "div8")}}
+	var buf bytes.Buffer
+	if err := Write(&buf, ar); err != nil {
+		t.Fatalf("Write(); got:%v, want:nil", err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read(); got:%v, want:nil", err)
+	}
+	if !reflect.DeepEqual(got.Modules, ar.Modules) || !reflect.DeepEqual(got.Index(), ar.Index()) {
+		t.Errorf("Read(); got:%+v, want:%+v", got, ar)
+	}
+	if _, err := Read(strings.NewReader(`{"Format":"v65-obj 1"}`)); err == nil {
+		t.Errorf("Read() of an object file; got:nil, want:error")
+	}
+}
+
+func TestReadIndex(t *testing.T) {
+	// The index of the file is used, not rebuilt from the modules.
+	ar, err := Read(strings.NewReader(`{"Format":"v65-archive 1","Index":{"mul":"mul.s"},"Modules":[{"Name":"mul.s"}]}`))
+	if err != nil {
+		t.Fatalf("Read(); got:%v, want:nil", err)
+	}
+	if got := ar.Index(); !reflect.DeepEqual(got, map[string]string{"mul": "mul.s"}) {
+		t.Errorf("Index(); got:%v, want:map[mul:mul.s]", got)
+	}
+	if err := ar.Add(module("div.s", "div8")); err != nil {
+		t.Fatalf("Add(div.s); got:%v, want:nil", err)
+	}
+	if got := ar.Index(); !reflect.DeepEqual(got, map[string]string{"div8": "div.s"}) {
+		t.Errorf("Index() after Add(); got:%v, want:map[div8:div.s]", got)
+	}
+	_, err = Read(strings.NewReader(`{"Format":"v65-archive 1","Index":{"mul":"div.s"},"Modules":[{"Name":"mul.s"}]}`))
+	if err == nil || !strings.Contains(err.Error(), "symbol mul is exported by unknown module div.s") {
+		t.Errorf("Read() with a bad index; got:%v, want:unknown module error", err)
+	}
+}
@@ -29,9 +29,9 @@ func TestAdrMode(t *testing.T) {
 			lexer: &lexer{newSourceFromString(tc.str), nil},
 			seg:   newSegment(),
 		}
-		ctx.seg.symbols["foo"] = &externSymbol{"foo"}
-		ctx.seg.symbols["bar"] = &localSymbol{"bar", 42, false}
-		ctx.seg.symbols["baz"] = &localSymbol{"bar", 1000, false}
+		ctx.seg.symbols["foo"] = &externSymbol{id: "foo"}
+		ctx.seg.symbols["bar"] = &localSymbol{id: "bar", value: 42}
+		ctx.seg.symbols["baz"] = &localSymbol{id: "bar", value: 1000}
 		mode, val, err := ctx.parseAddressingMode()
 		if (err != nil && !tc.wantError) || (err == nil && tc.wantError) {
 			t.Errorf("parseAddressingMode() errors; got:%d, want:0", ctx.errors)
@@ -12,60 +12,194 @@ type lineStarter interface {
 // parseError is a generic indicator that there was a parsing error.
 var parseError = errors.New("generic parsing error")
 
-// Assemble assembles a source file.
-func Assemble(filename string) (*context, error) {
+// Options changes how a source file is assembled.
+type Options struct {
+	// Org is the address of the default segment. If it is negative, the
+	// segment is relocatable, unless the source contains an org.
+	Org int
+}
+
+// Assemble assembles a source file. If there are errors, the context is
+// returned together with an error.
+func Assemble(filename string, opts Options) (*context, error) {
 	src, err := newSource(filename)
 	if err != nil {
 		return nil, err
 	}
-	ctx := &context{pass: 1, seg: newSegment(), lexer: &lexer{src, nil}}
+	ctx := newContext(src)
+	if opts.Org >= 0 {
+		ctx.seg.absolute = true
+		ctx.seg.org = opts.Org
+		ctx.seg.startBlock(opts.Org)
+	}
 	ctx.assemble()
 	if ctx.errors == 0 {
-		ctx.pass++
-		ctx.seg.lc = 0
+		ctx.nextPass()
 		ctx.assemble()
 	}
-	fmt.Sprintf("There were %d error(s) and %d warning(s).\n", ctx.errors, ctx.warnings)
+	fmt.Printf("There were %d error(s) and %d warning(s).\n", ctx.errors, ctx.warnings)
+	if ctx.errors > 0 {
+		return ctx, fmt.Errorf("%s: %d error(s)", filename, ctx.errors)
+	}
 	return ctx, nil
 }
 
+// nextPass rewinds the source and the location counter for the next pass.
+func (ctx *context) nextPass() {
+	ctx.pass++
+	for _, seg := range ctx.allSegments() {
+		seg.lc = 0
+		seg.start = 0
+		seg.blocks = nil
+		if seg.absolute {
+			seg.startBlock(seg.org)
+		}
+		seg.relocs = make(relocMap)
+		seg.internal = make(relocMap)
+		seg.lines = nil
+	}
+	ctx.seg = ctx.segments[0]
+	ctx.forgetVariables()
+	ctx.zeroPageIndex = 0
+	ctx.iterationIndex = 0
+	ctx.scope = ""
+	ctx.vectors = nil
+	ctx.lexer.src.rewind()
+}
+
+// blockEnder is an interface that tokens implement if they end a block
+// of lines, like the endr at the end of a rept block.
+type blockEnder interface {
+	keyword() string
+}
+
 // assemble assembles from a source object.
 func (ctx *context) assemble() {
-loop:
 	for {
+		tok := ctx.assembleBlock()
+		if _, ok := tok.(*tokEOF); ok {
+			ctx.resolveExports()
+			if ctx.pass == 2 {
+				ctx.checkBlocks()
+			}
+			return
+		}
+		ctx.error("%s without start of block", tok.(blockEnder).keyword())
+		ctx.lexer.moveToNextLine()
+	}
+}
+
+// assembleBlock assembles lines until the end of the source or until
+// a line that ends a block. It returns the token that stopped it.
+func (ctx *context) assembleBlock() token {
+	for {
+		column := ctx.lexer.src.column()
 		tok := ctx.lexer.getToken()
 		if ctx.lexError(tok) {
-			ctx.lexer.src.moveToNextLine()
+			ctx.lexer.moveToNextLine()
 			continue
 		}
 		var label *localSymbol
 		if id, ok := tok.(*tokIdentifier); ok {
-			label = &localSymbol{
-				id:     id.id,
-				value:  int64(ctx.seg.lc),
-				global: false,
-			}
-			if ctx.seg.symbols.register(id.id, label) {
-				ctx.error("duplicate definition of label or symbol: %s", id.id)
-			}
+			column = ctx.lexer.src.column()
 			tok = ctx.lexer.getToken()
+			if !isAssignment(tok) {
+				label = ctx.defineLabel(id.id)
+			} else if v, err := ctx.defineVariable(id.id); err == nil {
+				label = v
+			} else {
+				ctx.lexer.moveToNextLine()
+				continue
+			}
 		}
 		switch tok.(type) {
 		case lineStarter:
+			seg, lc, lineNo := ctx.seg, ctx.seg.lc, ctx.lexer.src.lineNo
 			if err := tok.(lineStarter).assemble(ctx, label); err == nil {
 				tok = ctx.lexer.getToken()
 				if _, ok := tok.(*tokNewLine); !ok {
 					ctx.error("expected end-of-line, not: '%T(%v)'", tok, tok)
 				}
 			}
-			ctx.lexer.src.moveToNextLine()
+			ctx.checkOverflow()
+			ctx.setScope(label)
+			if ctx.lexer.src.lineNo == lineNo {
+				// Lines of blocks are recorded when they are assembled.
+				ctx.recordLine(seg, lc, column)
+			}
+			ctx.lexer.moveToNextLine()
+		case blockEnder:
+			return tok
 		case *tokEOF:
-			break loop
+			return tok
 		case *tokNewLine:
-			continue
+			ctx.setScope(label)
+			ctx.lexer.moveToNextLine()
 		default:
 			ctx.error("unexpected token at start of line: %T", tok)
-			ctx.lexer.src.moveToNextLine()
+			ctx.lexer.moveToNextLine()
+		}
+	}
+}
+
+// checkOverflow reports the first line whose code did not fit in the
+// current segment.
+func (ctx *context) checkOverflow() {
+	if ctx.seg.overflow && !ctx.seg.reported {
+		ctx.error("segment overflow")
+		ctx.seg.reported = true
+	}
+}
+
+// defineLabel defines a label with the current value of the location
+// counter.
+func (ctx *context) defineLabel(id string) *localSymbol {
+	return ctx.defineSymbol(id, int64(ctx.seg.lc), ctx.seg)
+}
+
+// defineConstant defines a symbol with a fixed value.
+func (ctx *context) defineConstant(id string, value int64) *localSymbol {
+	return ctx.defineSymbol(id, value, nil)
+}
+
+// defineSymbol defines a symbol with a value that is relative to a
+// segment, or absolute if seg is nil. In pass 2 the symbol that was
+// registered in pass 1 is reused. A symbol in a repeated block belongs to
+// the iteration that defines it.
+func (ctx *context) defineSymbol(id string, value int64, seg *segment) *localSymbol {
+	symbols := ctx.seg.symbols
+	if n := len(ctx.labelScopes); n > 0 {
+		symbols = ctx.labelScopes[n-1]
+	}
+	if ctx.pass == 2 {
+		if label, ok := symbols[id].(*localSymbol); ok {
+			label.value = value
+			label.seg = seg
+			label.lineNo = ctx.lexer.src.lineNo
+			return label
+		}
+	}
+	label := &localSymbol{
+		id:     id,
+		value:  value,
+		global: false,
+		seg:    seg,
+		lineNo: ctx.lexer.src.lineNo,
+	}
+	if symbols.register(id, label) {
+		ctx.error("duplicate definition of label or symbol: %s", id)
+	}
+	return label
+}
+
+// lookup finds a symbol. The labels of the iterations being assembled
+// come first, innermost first.
+func (ctx *context) lookup(id string) (symbol, bool) {
+	for i := len(ctx.labelScopes) - 1; i >= 0; i-- {
+		if sym, ok := ctx.labelScopes[i][id]; ok {
+			return sym, true
 		}
 	}
+	sym, ok := ctx.seg.symbols[id]
+	return sym, ok
 }
@@ -0,0 +1,27 @@
+package asm
+
+import "testing"
+
+// assembleString runs both assembler passes over a source string.
+func assembleString(str string) *context {
+	src := newSourceFromString(str)
+	ctx := newContext(src)
+	ctx.assemble()
+	if ctx.errors == 0 {
+		ctx.nextPass()
+		ctx.assemble()
+	}
+	return ctx
+}
+
+func TestTwoPasses(t *testing.T) {
+	ctx := assembleString("db fwd\nres 2\nfwd db fwd")
+	if ctx.errors != 0 {
+		t.Fatalf("assemble() errors; got:%d, want:0", ctx.errors)
+	}
+	for i, b := range []byte{3, 0, 0, 3} {
+		if ctx.seg.code[i] != b {
+			t.Errorf("code[%d]; got:%d, want:%d", i, ctx.seg.code[i], b)
+		}
+	}
+}
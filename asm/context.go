@@ -6,9 +6,21 @@ import "fmt"
 type context struct{
 	pass int
 	lexer *lexer
-	seg *segment
+	seg *segment // The current segment.
+	segments []*segment // All segments, in order of definition.
 	errors int
 	warnings int
+	undefined bool // Set when an expression refers to a not yet defined label.
+	zeroPages []bool // Zero page addressing decisions made in pass 1.
+	zeroPageIndex int // Index of the next decision in pass 2.
+	iterations []symbolMap // Labels of every iteration of a repeated block, made in pass 1.
+	iterationIndex int // Index of the next iteration in pass 2.
+	labelScopes []symbolMap // Labels of the iterations being assembled, innermost last.
+	structs map[string]*structDef
+	exports []*export // Exports of symbols that were not defined yet.
+	scope string // The last label that was defined, for debug information.
+	vectors []*vector
+	attributes map[string]int // Settings for the output, like the iNES header.
 }
 
 // lexError deals with the possibility of an error coming back from the lexer. Returns
@@ -30,7 +42,7 @@ func (ctx *context) error(s string, args ...interface{}) {
 
 // warning reports a warning.
 func (ctx *context) warning(s string, args ...interface{}) {
-	fmt.Printf("[%d:%d] warning: %s", ctx.lexer.src.lineNo, ctx.lexer.src.curPos, fmt.Sprintf(s, args...))
+	fmt.Printf("[%d:%d] warning: %s\n", ctx.lexer.src.lineNo, ctx.lexer.src.curPos, fmt.Sprintf(s, args...))
 	ctx.warnings++
 }
 
@@ -43,3 +55,23 @@ func (ctx *context) expect(f func(token) bool, typ string) (tok token, ok bool)
 	}
 	return tok, ok
 }
+
+// newContext creates an assembly context for a source.
+func newContext(src *source) *context {
+	seg := newSegment()
+	return &context{
+		pass:     1,
+		seg:      seg,
+		segments: []*segment{seg},
+		lexer:    &lexer{src, nil},
+	}
+}
+
+// allSegments returns all segments.
+func (ctx *context) allSegments() []*segment {
+	if len(ctx.segments) == 0 {
+		// Contexts created in tests only have a current segment.
+		ctx.segments = []*segment{ctx.seg}
+	}
+	return ctx.segments
+}
@@ -10,7 +10,7 @@ func assembleDdef(ctx *context, size int, emit func(int64)) error {
 	for {
 		val := ctx.expr()
 		next := ctx.lexer.getToken()
-		ctx.seg.relocs.maybeAdd(val, ctx.seg.lc, size)
+		ctx.seg.maybeAddReloc(val, size)
 		emit(val.val)
 		if _, ok := next.(*tokNewLine); ok {
 			return nil
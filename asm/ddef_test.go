@@ -14,12 +14,12 @@ func TestDb(t *testing.T) {
 		{"db 1,2,", 1, 0,1, []byte{1, 2, 0}},
 		{"db foo, bar, baz", 0, 1,1, []byte{0, 42, 0xe8}},
 		{"db foo+2", 0, 1, 1, []byte{2}},
-		{"dw 1000", 0, 0, 2, []byte{0x3, 0xe8}},
-		{"dw foo+1000", 0, 1, 2, []byte{0x3, 0xe8}},
-		{"dd 65538", 0, 0, 4, []byte{0, 1, 0, 2}},
-		{"dd foo+2", 0, 1, 4, []byte{0, 0, 0, 2}},
-		{"dd 0x12345678", 0, 0,4,  []byte{0x12, 0x34, 0x56, 0x78}},
-		{"dd 0x87654321", 0, 0, 4, []byte{0x87, 0x65, 0x43, 0x21}},
+		{"dw 1000", 0, 0, 2, []byte{0xe8, 0x3}},
+		{"dw foo+1000", 0, 1, 2, []byte{0xe8, 0x3}},
+		{"dd 65538", 0, 0, 4, []byte{2, 0, 1, 0}},
+		{"dd foo+2", 0, 1, 4, []byte{2, 0, 0, 0}},
+		{"dd 0x12345678", 0, 0,4,  []byte{0x78, 0x56, 0x34, 0x12}},
+		{"dd 0x87654321", 0, 0, 4, []byte{0x21, 0x43, 0x65, 0x87}},
 		{"ds \"abc\",\"def\"", 0, 0, 0, []byte{97, 98, 99, 100, 101, 102}},
 		{"ds \"abc\",", 1, 0, 0, []byte{97, 98, 99}},
 		{"db", 1, 0, 1, []byte{0}},
@@ -29,9 +29,9 @@ func TestDb(t *testing.T) {
 			lexer: &lexer{newSourceFromString(tc.str), nil},
 			seg: newSegment(),
 		}
-		ctx.seg.symbols["foo"] = &externSymbol{"foo"}
-		ctx.seg.symbols["bar"] = &localSymbol{"bar", 42,  false}
-		ctx.seg.symbols["baz"] = &localSymbol{"bar", 1000, false}
+		ctx.seg.symbols["foo"] = &externSymbol{id: "foo"}
+		ctx.seg.symbols["bar"] = &localSymbol{id: "bar", value: 42}
+		ctx.seg.symbols["baz"] = &localSymbol{id: "bar", value: 1000}
 		ctx.assemble()
 		if ctx.errors != tc.wantErrors {
 			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
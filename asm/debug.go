@@ -0,0 +1,53 @@
+package asm
+
+import "v65/obj"
+
+// lineInfo maps a range of bytes in a segment to the source line that
+// produced them.
+type lineInfo struct {
+	lc     int
+	size   int
+	lineNo int
+	column int
+	scope  string
+}
+
+// setScope makes a label the scope of the lines that follow, unless it
+// is a constant or a variable.
+func (ctx *context) setScope(label *localSymbol) {
+	if label != nil && label.seg != nil && !label.variable {
+		ctx.scope = label.id
+	}
+}
+
+// recordLine records the debug information for the current line, which
+// started at lc in seg, if it emitted anything.
+func (ctx *context) recordLine(seg *segment, lc int, column int) {
+	if seg != ctx.seg || seg.lc <= lc {
+		return
+	}
+	seg.lines = append(seg.lines, &lineInfo{
+		lc:     lc,
+		size:   seg.lc - lc,
+		lineNo: ctx.lexer.src.lineNo,
+		column: column,
+		scope:  ctx.scope,
+	})
+}
+
+// objLines converts the debug information of a segment for the object
+// module.
+func (seg *segment) objLines(file string) []*obj.Line {
+	var lines []*obj.Line
+	for _, l := range seg.lines {
+		lines = append(lines, &obj.Line{
+			Offset: l.lc,
+			Size:   l.size,
+			File:   file,
+			Line:   l.lineNo,
+			Column: l.column,
+			Scope:  l.scope,
+		})
+	}
+	return lines
+}
@@ -8,10 +8,15 @@ func (*tokEqu) assemble(ctx *context, label *localSymbol) (err error) {
 		ctx.error("defining a local symbol with an external value is not allowed")
 		err = parseError
 	}
+	if val.seg != nil && val.part != partAll {
+		ctx.error("defining a local symbol with a byte of a relocatable value is not allowed")
+		err = parseError
+	}
 	if label == nil {
 		ctx.warning("equ without label, value is lost")
 	} else {
 		label.value = val.val
+		label.seg = val.seg
 	}
 	return err
 }
@@ -24,9 +24,9 @@ func TestEqu(t *testing.T) {
 			lexer: &lexer{newSourceFromString(tc.str), nil},
 			seg: newSegment(),
 		}
-		ctx.seg.symbols["foo"] = &externSymbol{"foo"}
-		ctx.seg.symbols["bar"] = &localSymbol{"bar", 42, false}
-		ctx.seg.symbols["baz"] = &localSymbol{"bar", 1000, false}
+		ctx.seg.symbols["foo"] = &externSymbol{id: "foo"}
+		ctx.seg.symbols["bar"] = &localSymbol{id: "bar", value: 42}
+		ctx.seg.symbols["baz"] = &localSymbol{id: "bar", value: 1000}
 		ctx.assemble()
 		if ctx.errors != tc.wantErrors {
 			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
@@ -1,54 +1,107 @@
 package asm
 
+// Parts of a value that an expression can select with the < and >
+// operators.
+const (
+	partAll  = 0
+	partLow  = 1 // <expression
+	partHigh = 2 // >expression
+	partBank = 3 // bank(label)
+)
+
 type exprValue struct {
-	sym *externSymbol // If this is the value of a relocatable expression.
-	val int64
+	sym  *externSymbol // If this is the value of a relocatable expression.
+	seg  *segment      // If this is relative to the start of a segment.
+	val  int64
+	part int // Which part of the value the expression selects.
+}
+
+// relocatable returns true if the final value of the expression is only
+// known after linking.
+func (v *exprValue) relocatable() bool {
+	return v.sym != nil || v.seg != nil
 }
 
+// expr parses an expression. An expression can refer to at most one
+// external symbol or label in a relocatable segment, to which a constant
+// can be added or from which it can be subtracted. The difference of two
+// labels in the same segment is a constant. An expression can start with
+// < or > to select the low or high byte of the value of the whole
+// expression. The bank of a label, bank(label), is a value of its own,
+// to which a constant can be added.
 func (ctx *context) expr() *exprValue {
+	part := partAll
 	tok := ctx.lexer.getToken()
-
-	// If this token is an identifier, there is a change that we have
-	// an expression that requires relocation. Such an expression starts
-	// with an external symbol and then a positive or negative constant
-	// offset.
-	if id, ok := tok.(*tokIdentifier); ok {
-		var sym symbol
-		if sym, ok = ctx.seg.symbols[id.id]; !ok {
-			// The error will be generated down there somewhere.
-			ctx.lexer.pushback(tok)
-			return &exprValue{nil, ctx.level1()}
-		}
-		if externSym, ok := sym.(*externSymbol); ok {
-			// This is an external symbol. The rest of the expression
-			// can be + or - something else.
-			next := ctx.lexer.getToken()
-			var v int64
-			if _, ok := next.(*tokPlus); ok {
-				v = ctx.level1()
-			} else if _, ok := next.(*tokMinus); ok {
-				v = -ctx.level1()
-			} else {
-				ctx.lexer.pushback(next)
-			}
-			return &exprValue{externSym, v}
+	if r, ok := tok.(*tokRune); ok && r.r == '<' {
+		part = partLow
+	} else if ok && r.r == '>' {
+		part = partHigh
+	} else {
+		ctx.lexer.pushback(tok)
+	}
+	val := ctx.level1()
+	if part != partAll && val.part == partBank {
+		ctx.error("cannot select a byte of a bank")
+	}
+	if !val.relocatable() {
+		switch part {
+		case partLow:
+			val.val &= 0xff
+		case partHigh:
+			val.val = (val.val >> 8) & 0xff
 		}
-		// The identifier is a label with a known value. Fallthrough.
 	}
+	// The part is kept for absolute values as well, because the result
+	// is a single byte, even when the value is not known yet in pass 1.
+	if part != partAll {
+		val.part = part
+	}
+	return val
+}
 
-	ctx.lexer.pushback(tok)
-	v := ctx.level1()
-	return &exprValue{nil, v}
+// checkAbsolute reports an error if one of the operands of an operator
+// is relocatable.
+func (ctx *context) checkAbsolute(a, b *exprValue) {
+	if a.relocatable() || b.relocatable() {
+		ctx.error("operator cannot be used on a relocatable value")
+	}
 }
 
-func (ctx *context) level1() int64 {
+// add adds two values, of which at most one can be relocatable.
+func (ctx *context) add(a, b *exprValue) *exprValue {
+	if a.relocatable() && b.relocatable() {
+		ctx.error("cannot add two relocatable values")
+	} else if b.relocatable() {
+		a, b = b, a
+	}
+	return &exprValue{sym: a.sym, seg: a.seg, val: a.val + b.val, part: a.part}
+}
+
+// subtract subtracts two values. Subtracting two labels from the same
+// segment results in a constant.
+func (ctx *context) subtract(a, b *exprValue) *exprValue {
+	switch {
+	case !b.relocatable():
+		return &exprValue{sym: a.sym, seg: a.seg, val: a.val - b.val, part: a.part}
+	case b.seg != nil && a.seg == b.seg:
+		return &exprValue{val: a.val - b.val}
+	}
+	ctx.error("cannot subtract a relocatable value")
+	return &exprValue{val: a.val - b.val}
+}
+
+func (ctx *context) level1() *exprValue {
 	val := ctx.level2()
 	for {
 		next := ctx.lexer.getToken()
 		if _, ok := next.(*tokOr); ok {
-			val = val | ctx.level2()
+			v := ctx.level2()
+			ctx.checkAbsolute(val, v)
+			val = &exprValue{val: val.val | v.val}
 		} else if _, ok := next.(*tokAnd); ok {
-			val = val & ctx.level2()
+			v := ctx.level2()
+			ctx.checkAbsolute(val, v)
+			val = &exprValue{val: val.val & v.val}
 		} else {
 			ctx.lexer.pushback(next)
 			return val
@@ -56,14 +109,14 @@ func (ctx *context) level1() int64 {
 	}
 }
 
-func (ctx *context) level2() int64 {
+func (ctx *context) level2() *exprValue {
 	val := ctx.level3()
 	for {
 		next := ctx.lexer.getToken()
 		if _, ok := next.(*tokPlus); ok {
-			val = val + ctx.level3()
+			val = ctx.add(val, ctx.level3())
 		} else if _, ok := next.(*tokMinus); ok {
-			val = val - ctx.level3()
+			val = ctx.subtract(val, ctx.level3())
 		} else {
 			ctx.lexer.pushback(next)
 			return val
@@ -71,19 +124,31 @@ func (ctx *context) level2() int64 {
 	}
 }
 
-func (ctx *context) level3() int64 {
+func (ctx *context) level3() *exprValue {
 	val := ctx.level4()
 	for {
 		next := ctx.lexer.getToken()
 		if _, ok := next.(*tokMultiply); ok {
-			val = val * ctx.level4()
+			v := ctx.level4()
+			ctx.checkAbsolute(val, v)
+			val = &exprValue{val: val.val * v.val}
 		} else if _, ok := next.(*tokDivide); ok {
 			v := ctx.level4()
-			if v == 0 {
+			ctx.checkAbsolute(val, v)
+			if v.val == 0 {
 				ctx.error("division by zero")
+				val = &exprValue{val: val.val}
 			} else {
-				val = val / v
+				val = &exprValue{val: val.val / v.val}
 			}
+		} else if _, ok := next.(*tokShiftLeft); ok {
+			v := ctx.level4()
+			ctx.checkAbsolute(val, v)
+			val = &exprValue{val: val.val << uint64(v.val)}
+		} else if _, ok := next.(*tokShiftRight); ok {
+			v := ctx.level4()
+			ctx.checkAbsolute(val, v)
+			val = &exprValue{val: val.val >> uint64(v.val)}
 		} else {
 			ctx.lexer.pushback(next)
 			return val
@@ -91,39 +156,55 @@ func (ctx *context) level3() int64 {
 	}
 }
 
-func (ctx *context) level4() int64 {
+func (ctx *context) level4() *exprValue {
 	next := ctx.lexer.getToken()
 	if ctx.lexError(next) {
-		return 0
+		return &exprValue{}
 	}
-	if _,  ok := next.(*tokMultiply); ok {
+	if _, ok := next.(*tokMultiply); ok {
 		// Current location counter.
-		return int64(ctx.seg.lc)
+		return ctx.seg.location(int64(ctx.seg.lc))
 	}
 	if num, ok := next.(*tokIntNumber); ok {
-		return num.n
+		return &exprValue{val: num.n}
 	}
 	if _, ok := next.(*tokLeftParen); ok {
 		v := ctx.level1()
 		next := ctx.lexer.getToken()
 		if _, ok := next.(*tokRightParen); !ok {
 			ctx.error("expected ')', not '%T'", next)
-			return 0
+			return &exprValue{}
 		}
 		return v
 	}
 	if id, ok := next.(*tokIdentifier); ok {
-		// Label, must be locally defined.
-		sym, ok := ctx.seg.symbols[id.id]
-		if !ok && ctx.pass == 2 {
+		sym, ok := ctx.lookup(id.id)
+		if !ok && ctx.pass == 1 {
+			// Forward reference, this will be resolved in pass 2.
+			ctx.undefined = true
+			return &exprValue{}
+		}
+		if !ok {
 			ctx.error("unknown label: %s", id.id)
-			return 0
+			return &exprValue{}
 		}
-		if localSym, ok := sym.(*localSymbol); ok {
-			return localSym.value
+		switch s := sym.(type) {
+		case *localSymbol:
+			if s.seg != nil {
+				return s.seg.location(s.value)
+			}
+			return &exprValue{val: s.value}
+		case *externSymbol:
+			return &exprValue{sym: s}
 		}
-		ctx.error("illegal use in expression of external label: %s", id.id)
-		return 0
+	}
+	if _, ok := next.(*tokSizeof); ok {
+		// Size of a struct: sizeof NAME or sizeof(NAME).
+		return &exprValue{val: ctx.sizeof()}
+	}
+	if _, ok := next.(*tokBank); ok {
+		// Bank of a label: bank(NAME).
+		return ctx.bankOf()
 	}
 	if _, ok := next.(*tokPlus); ok {
 		// Unary plus operator.
@@ -131,9 +212,86 @@ func (ctx *context) level4() int64 {
 	}
 	if _, ok := next.(*tokMinus); ok {
 		// Unary minus operator.
-		return -ctx.level4()
+		v := ctx.level4()
+		ctx.checkAbsolute(v, &exprValue{})
+		return &exprValue{val: -v.val}
 	}
 	ctx.lexer.pushback(next)
 	ctx.error("invalid expression; unexpected token: '%T(%v)'", next, next)
-	return 0
-}
\ No newline at end of file
+	return &exprValue{}
+}
+
+// sizeof parses the operand of the sizeof operator and returns the size
+// of the struct.
+func (ctx *context) sizeof() int64 {
+	next := ctx.lexer.getToken()
+	_, paren := next.(*tokLeftParen)
+	if paren {
+		next = ctx.lexer.getToken()
+	}
+	id, ok := next.(*tokIdentifier)
+	if !ok {
+		ctx.error("expected struct name, not '%T'", next)
+		return 0
+	}
+	if paren {
+		next = ctx.lexer.getToken()
+		if _, ok := next.(*tokRightParen); !ok {
+			ctx.error("expected ')', not '%T'", next)
+			return 0
+		}
+	}
+	def, ok := ctx.structs[id.id]
+	if !ok {
+		ctx.error("unknown struct: %s", id.id)
+		return 0
+	}
+	return int64(def.size)
+}
+
+// bankOf parses the operand of the bank function and returns the bank of
+// the label. The bank of a label in a relocatable segment or of an
+// external symbol is only known after linking.
+func (ctx *context) bankOf() *exprValue {
+	next := ctx.lexer.getToken()
+	if _, ok := next.(*tokLeftParen); !ok {
+		ctx.error("expected '(', not '%T'", next)
+		return &exprValue{}
+	}
+	next = ctx.lexer.getToken()
+	id, ok := next.(*tokIdentifier)
+	if !ok {
+		ctx.error("expected label, not '%T'", next)
+		return &exprValue{}
+	}
+	next = ctx.lexer.getToken()
+	if _, ok := next.(*tokRightParen); !ok {
+		ctx.error("expected ')', not '%T'", next)
+		return &exprValue{}
+	}
+	sym, ok := ctx.seg.symbols[id.id]
+	if !ok && ctx.pass == 1 {
+		// Forward reference, this will be resolved in pass 2.
+		ctx.undefined = true
+		return &exprValue{part: partBank}
+	}
+	if !ok {
+		ctx.error("unknown label: %s", id.id)
+		return &exprValue{}
+	}
+	switch s := sym.(type) {
+	case *localSymbol:
+		if s.seg == nil {
+			ctx.error("%s is a constant, it has no bank", id.id)
+			return &exprValue{}
+		}
+		if s.seg.absolute {
+			return &exprValue{val: int64(s.seg.bank)}
+		}
+		return &exprValue{seg: s.seg, part: partBank}
+	case *externSymbol:
+		return &exprValue{sym: s, part: partBank}
+	}
+	ctx.error("%s has no bank", id.id)
+	return &exprValue{}
+}
@@ -4,8 +4,8 @@ import "testing"
 
 func TestExpressionEval(t *testing.T) {
 	seg := newSegment()
-	seg.symbols["fu"] = &externSymbol{"fu"}
-	seg.symbols["bar"] = &localSymbol{"bar", 7, false}
+	seg.symbols["fu"] = &externSymbol{id: "fu"}
+	seg.symbols["bar"] = &localSymbol{id: "bar", value: 7}
 	for _, tc := range []struct {
 		str        string
 		wantNum    int64
@@ -2,6 +2,11 @@ package asm
 
 type tokExtern struct{}
 
+// assemble assembles an extern statement. Every symbol can have an
+// address size: extern foo: abs, ptr: zp. Symbols that are declared to
+// be in the zero page can be used with zero page addressing modes. The
+// bounds of segments and memory areas that the linker defines, like
+// __data_load__, are imported in the same way.
 func (*tokExtern) assemble(ctx *context, _label *localSymbol) error {
 	for {
 		// First, we expect an identifier.
@@ -11,12 +16,31 @@ func (*tokExtern) assemble(ctx *context, _label *localSymbol) error {
 			ctx.error("expected identifier, not: '%T(%v)'", next, next)
 			return parseError
 		}
-		if ctx.seg.symbols.register(id.id, &externSymbol{id.id}) {
-			ctx.warning("redefinition of symbol %s\n", id.id)
+		sym := &externSymbol{id: id.id}
+		// Then an optional address size.
+		next = ctx.lexer.getToken()
+		if r, ok := next.(*tokRune); ok && r.r == ':' {
+			next = ctx.lexer.getToken()
+			size, _ := next.(*tokIdentifier)
+			switch {
+			case size != nil && size.id == "zp":
+				sym.zeroPage = true
+			case size != nil && size.id == "abs":
+				// pass
+			default:
+				ctx.error("expected address size zp or abs, not: '%T(%v)'", next, next)
+				return parseError
+			}
+			next = ctx.lexer.getToken()
+		}
+		if old, ok := ctx.seg.symbols[id.id].(*externSymbol); ok && ctx.pass == 2 {
+			// Already registered in pass 1.
+			old.zeroPage = sym.zeroPage
+		} else if ctx.seg.symbols.register(id.id, sym) {
+			ctx.warning("redefinition of symbol %s", id.id)
 		}
 		// Then we either get a comma and we go around again, or we
 		// get a newline and then we're done.
-		next = ctx.lexer.getToken()
 		switch t := next.(type) {
 		case *tokNewLine:
 			return nil
@@ -18,6 +18,9 @@ func TestExtern(t *testing.T) {
 		{"extern", 1, 0, 0, []string{}},
 		{"extern foo,", 1, 0, 1, []string{"foo"}},
 		{"extern foo,4,bar", 1, 0, 1, []string{"foo"}},
+		{"extern foo: zp, bar: abs", 0, 0, 2, []string{"foo", "bar"}},
+		{"extern foo: far", 1, 0, 0, []string{}},
+		{"extern foo:", 1, 0, 0, []string{}},
 	} {
 		println(tc.src)
 		ctx := &context{
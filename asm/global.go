@@ -1,9 +1,65 @@
 package asm
 
-type tokGlobal struct{}
+type tokGlobal struct {
+	weak bool
+}
+
+// export is an export of a symbol that is defined later in the source.
+type export struct {
+	id     string
+	weak   bool
+	lineNo int
+}
+
+// exportSymbol marks a local symbol as exported.
+func (ctx *context) exportSymbol(sym symbol, id string, weak bool) {
+	ls, ok := sym.(*localSymbol)
+	if !ok {
+		ctx.error("cannot make an external symbol global")
+	} else if ls.variable {
+		ctx.error("cannot make variable %s global", id)
+	} else {
+		ls.global = true
+		ls.weak = ls.weak || weak
+	}
+}
+
+// resolveExports exports the symbols that were exported before they were
+// defined. This is done at the end of every pass.
+func (ctx *context) resolveExports() {
+	for _, exp := range ctx.exports {
+		sym, ok := ctx.seg.symbols[exp.id]
+		if !ok {
+			if ctx.pass != 2 {
+				ctx.warning("symbol %s exported on line %d is never defined", exp.id, exp.lineNo)
+			}
+			continue
+		}
+		ctx.exportSymbol(sym, exp.id, exp.weak)
+	}
+	ctx.exports = nil
+}
 
-// assemble assembles a global statement.
-func (*tokGlobal) assemble(ctx *context, label *localSymbol) error {
+// exportValue parses the value of an export with an assignment and defines
+// the symbol.
+func (ctx *context) exportValue(id string) (*localSymbol, error) {
+	val := ctx.expr()
+	if val.sym != nil {
+		ctx.error("exporting an external value is not allowed")
+		return nil, parseError
+	}
+	if val.seg != nil && val.part != partAll {
+		ctx.error("exporting a byte of a relocatable value is not allowed")
+		return nil, parseError
+	}
+	return ctx.defineSymbol(id, val.val, val.seg), nil
+}
+
+// assemble assembles a global, export or weak statement: a list of
+// symbols, each optionally followed by = and a value. A symbol without a
+// value can be defined later in the source. A weak export can be
+// overridden by a (non-weak) export of another module when linking.
+func (g *tokGlobal) assemble(ctx *context, label *localSymbol) error {
 	for {
 		next := ctx.lexer.getToken()
 		id, ok := next.(*tokIdentifier)
@@ -11,20 +67,22 @@ func (*tokGlobal) assemble(ctx *context, label *localSymbol) error {
 			ctx.error("expected identifier, not '%T'", next)
 			return parseError
 		}
-		sym, ok := ctx.seg.symbols[id.id]
-		if !ok {
-			ctx.error("undefined symbol %s", id.id)
-		} else {
-			ls, ok := sym.(*localSymbol)
-			if !ok {
-				ctx.error("cannot make an external symbol global")
-			} else {
-				ls.global = true
+		next = ctx.lexer.getToken()
+		if _, ok := next.(*tokEquals); ok {
+			ls, err := ctx.exportValue(id.id)
+			if err != nil {
+				return err
 			}
+			ctx.exportSymbol(ls, id.id, g.weak)
+			next = ctx.lexer.getToken()
+		} else if sym, ok := ctx.seg.symbols[id.id]; ok {
+			ctx.exportSymbol(sym, id.id, g.weak)
+		} else {
+			ctx.exports = append(ctx.exports, &export{id.id, g.weak, ctx.lexer.src.lineNo})
 		}
-		next = ctx.lexer.getToken()
 		switch next.(type) {
 		case *tokNewLine:
+			ctx.lexer.pushback(next)
 			return nil
 		case *tokComma:
 			// pass
@@ -37,6 +95,6 @@ func (*tokGlobal) assemble(ctx *context, label *localSymbol) error {
 
 func init() {
 	metaMap["global"] = &tokGlobal{}
+	metaMap["export"] = &tokGlobal{}
+	metaMap["weak"] = &tokGlobal{weak: true}
 }
-
-
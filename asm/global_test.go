@@ -20,9 +20,9 @@ func TestGlobal(t *testing.T) {
 			lexer: &lexer{newSourceFromString(tc.str), nil},
 			seg: newSegment(),
 		}
-		ctx.seg.symbols["foo"] = &externSymbol{"foo"}
-		ctx.seg.symbols["bar"] = &localSymbol{"bar", 42, false}
-		ctx.seg.symbols["baz"] = &localSymbol{"bar", 1000, false}
+		ctx.seg.symbols["foo"] = &externSymbol{id: "foo"}
+		ctx.seg.symbols["bar"] = &localSymbol{id: "bar", value: 42}
+		ctx.seg.symbols["baz"] = &localSymbol{id: "bar", value: 1000}
 		ctx.assemble()
 		if ctx.errors != tc.wantErrors {
 			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
@@ -41,3 +41,46 @@ func TestGlobal(t *testing.T) {
 		}
 	}
 }
+
+func TestExport(t *testing.T) {
+	for _, tc := range []struct {
+		str          string
+		wantErrors   int
+		wantWarnings int
+		wantIDs      []string
+		wantWeak     []string
+	}{
+		{"global start\nstart nop", 0, 0, []string{"start"}, nil},
+		{"export start, size\nstart nop\nsize equ *-start", 0, 0, []string{"start", "size"}, nil},
+		{"export max = 10", 0, 0, []string{"max"}, nil},
+		{"export end = start+1, other\nstart nop\nother nop", 0, 0, []string{"end", "other"}, nil},
+		{"weak handler\nhandler rts", 0, 0, []string{"handler"}, []string{"handler"}},
+		{"weak handler = 0xfffe", 0, 0, []string{"handler"}, []string{"handler"}},
+		{"global missing", 0, 1, nil, nil},
+		{"global foo\nextern foo", 1, 0, nil, nil},
+		{"global n\nn set 1", 1, 0, nil, nil},
+		{"export max = 10\nmax equ 11", 1, 0, nil, nil},
+		{"extern foo\nexport bar = foo", 1, 0, nil, nil},
+	} {
+		println(tc.str)
+		ctx := assembleString(tc.str)
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+		if ctx.warnings != tc.wantWarnings {
+			t.Errorf("assemble() warnings; got:%d, want:%d", ctx.warnings, tc.wantWarnings)
+		}
+		weak := make(map[string]bool)
+		for _, id := range tc.wantWeak {
+			weak[id] = true
+		}
+		for _, wantID := range tc.wantIDs {
+			ls, ok := ctx.seg.symbols[wantID].(*localSymbol)
+			if !ok {
+				t.Errorf("symbol %s is a local symbol; got:false, want:true", wantID)
+			} else if !ls.global || ls.weak != weak[wantID] {
+				t.Errorf("symbol %s global/weak; got:%v/%v, want:true/%v", wantID, ls.global, ls.weak, weak[wantID])
+			}
+		}
+	}
+}
@@ -27,6 +27,9 @@ type tokPlus struct{}
 type tokMinus struct{}
 type tokMultiply struct{}
 type tokDivide struct{}
+type tokShiftLeft struct{}
+type tokShiftRight struct{}
+type tokEquals struct{}
 type tokNewLine struct{}
 type tokIdentifier struct {
 	id string
@@ -72,13 +75,14 @@ func (t *tokError) Error() string {
 
 // getWord returns the next word from the stream. firstRune is the first
 // (starter) rune for the word, which has already been consumed from
-// the string.
+// the string. After the first rune a word can contain dots, so that
+// struct members can be written as struct.member.
 func (l *lexer) getWord(firstRune rune) string {
 	word := make([]rune, 1, 64)
 	word[0] = firstRune
 	for {
 		r, eof := l.src.peekRune()
-		if eof || (!unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_') {
+		if eof || (!unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.') {
 			return string(word)
 		}
 		word = append(word, unicode.ToLower(r))
@@ -271,6 +275,17 @@ func (l *lexer) getToken() token {
 		return &tokMultiply{}
 	case '/':
 		return &tokDivide{}
+	case '<', '>':
+		if next, _ := l.src.peekRune(); next != r {
+			return &tokRune{r}
+		}
+		l.src.consumeRune()
+		if r == '<' {
+			return &tokShiftLeft{}
+		}
+		return &tokShiftRight{}
+	case '=':
+		return &tokEquals{}
 	case '(':
 		return &tokLeftParen{}
 	case ')':
@@ -280,3 +295,9 @@ func (l *lexer) getToken() token {
 	}
 }
 
+// moveToNextLine drops a pushed back token and moves to the next line
+// of the input.
+func (l *lexer) moveToNextLine() {
+	l.nextToken = nil
+	l.src.moveToNextLine()
+}
@@ -0,0 +1,140 @@
+package asm
+
+import (
+	"fmt"
+	"sort"
+	"v65/obj"
+	"v65/symfile"
+)
+
+// segmentName is the name of the segment the assembler emits code into
+// when no segment has been selected.
+const segmentName = "code"
+
+// relocations converts the relocations of a segment for the object module.
+// If internal is true the keys of the map are segment names, otherwise
+// they are symbols.
+func relocations(relocs relocMap, internal bool) []*obj.Reloc {
+	var out []*obj.Reloc
+	for id, rs := range relocs {
+		for _, r := range rs {
+			reloc := &obj.Reloc{
+				Offset: r.lc,
+				Size:   r.size,
+				Addend: r.addend,
+				Part:   r.part,
+				Call:   r.call,
+			}
+			if internal {
+				reloc.Segment = id
+			} else {
+				reloc.Symbol = id
+			}
+			out = append(out, reloc)
+		}
+	}
+	return out
+}
+
+// pieceName returns the name of the object segment for block i of a
+// segment. The first block has the name of the segment, the others get
+// their address appended.
+func (seg *segment) pieceName(i int, r [2]int) string {
+	if i == 0 {
+		return seg.name
+	}
+	return fmt.Sprintf("%s@%04x", seg.name, r[0])
+}
+
+// objSegments converts a segment for the object module. An absolute
+// segment is split into a segment for every block of code, so that the
+// space between the blocks is not part of the output.
+func (seg *segment) objSegments(file string) []*obj.Segment {
+	relocs := append(relocations(seg.relocs, false), relocations(seg.internal, true)...)
+	sort.Slice(relocs, func(i, j int) bool {
+		return relocs[i].Offset < relocs[j].Offset
+	})
+	lines := seg.objLines(file)
+	var out []*obj.Segment
+	for i, r := range seg.ranges() {
+		piece := &obj.Segment{
+			Name:     seg.pieceName(i, r),
+			Code:     append([]byte(nil), seg.code[r[0]:r[1]]...),
+			Absolute: seg.absolute,
+			Addr:     r[0],
+			Align:    seg.align,
+			Bank:     seg.bank,
+			Parent:   seg.parent,
+		}
+		for _, reloc := range relocs {
+			if reloc.Offset >= r[0] && reloc.Offset < r[1] {
+				moved := *reloc
+				moved.Offset -= r[0]
+				piece.Relocs = append(piece.Relocs, &moved)
+			}
+		}
+		for _, l := range lines {
+			if l.Offset >= r[0] && l.Offset < r[1] {
+				moved := *l
+				moved.Offset -= r[0]
+				piece.Lines = append(piece.Lines, &moved)
+			}
+		}
+		out = append(out, piece)
+	}
+	return out
+}
+
+// Module returns the assembled code as an object module for the linker.
+func (ctx *context) Module() *obj.Module {
+	mod := &obj.Module{Name: ctx.lexer.src.filename}
+	for _, seg := range ctx.allSegments() {
+		mod.Segments = append(mod.Segments, seg.objSegments(mod.Name)...)
+	}
+	for id, sym := range ctx.seg.symbols {
+		switch s := sym.(type) {
+		case *localSymbol:
+			if !s.global {
+				continue
+			}
+			exp := &obj.Symbol{Name: id, Value: s.value, Weak: s.weak}
+			if s.seg != nil && !s.seg.absolute {
+				exp.Segment = s.seg.name
+			}
+			mod.Symbols = append(mod.Symbols, exp)
+		case *externSymbol:
+			mod.Externs = append(mod.Externs, &obj.Extern{Name: id, ZeroPage: s.zeroPage})
+		}
+	}
+	mod.Vectors = ctx.objVectors()
+	mod.Attributes = ctx.attributes
+	sort.Slice(mod.Symbols, func(i, j int) bool {
+		return mod.Symbols[i].Name < mod.Symbols[j].Name
+	})
+	sort.Slice(mod.Externs, func(i, j int) bool {
+		return mod.Externs[i].Name < mod.Externs[j].Name
+	})
+	return mod
+}
+
+// Symbols returns the symbol table for debuggers, sorted by name. The value
+// of a label in a relocatable segment is relative to the start of the
+// segment. Variables are left out, because they have no single value.
+func (ctx *context) Symbols() []*symfile.Symbol {
+	var syms []*symfile.Symbol
+	for id, sym := range ctx.seg.symbols {
+		ls, ok := sym.(*localSymbol)
+		if !ok || ls.variable {
+			continue
+		}
+		out := &symfile.Symbol{Name: id, Value: ls.value, Global: ls.global, Line: ls.lineNo}
+		if ls.seg != nil {
+			out.Segment = ls.seg.name
+		}
+		syms = append(syms, out)
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		return syms[i].Name < syms[j].Name
+	})
+	return syms
+}
@@ -0,0 +1,88 @@
+package asm
+
+import "testing"
+
+func TestModule(t *testing.T) {
+	ctx := assembleString("extern ptr: zp, fn\nzero equ 0xfb\nstart lda ptr\njsr fn\nglobal start, zero")
+	if ctx.errors != 0 {
+		t.Fatalf("assemble() errors; got:%d, want:0", ctx.errors)
+	}
+	mod := ctx.Module()
+	if len(mod.Segments) != 1 {
+		t.Fatalf("len(mod.Segments); got:%d, want:1", len(mod.Segments))
+	}
+	seg := mod.Segments[0]
+	if len(seg.Code) != 5 {
+		t.Errorf("len(seg.Code); got:%d, want:5", len(seg.Code))
+	}
+	if len(seg.Relocs) != 2 {
+		t.Fatalf("len(seg.Relocs); got:%d, want:2", len(seg.Relocs))
+	}
+	for i, want := range []struct {
+		offset int
+		size   int
+		symbol string
+	}{
+		{1, 1, "ptr"},
+		{3, 2, "fn"},
+	} {
+		r := seg.Relocs[i]
+		if r.Offset != want.offset || r.Size != want.size || r.Symbol != want.symbol {
+			t.Errorf("seg.Relocs[%d]; got:%d/%d/%s, want:%d/%d/%s", i, r.Offset, r.Size, r.Symbol, want.offset, want.size, want.symbol)
+		}
+	}
+	if len(mod.Externs) != 2 || mod.Extern("ptr") == nil || !mod.Extern("ptr").ZeroPage || mod.Extern("fn").ZeroPage {
+		t.Errorf("mod.Externs; got:%v, want:ptr (zp) and fn", mod.Externs)
+	}
+	if len(mod.Symbols) != 2 {
+		t.Fatalf("len(mod.Symbols); got:%d, want:2", len(mod.Symbols))
+	}
+	if s := mod.Symbols[0]; s.Name != "start" || s.Segment != "code" || s.Value != 0 {
+		t.Errorf("mod.Symbols[0]; got:%v, want:start relative to code", s)
+	}
+	if s := mod.Symbols[1]; s.Name != "zero" || s.Segment != "" || s.Value != 0xfb {
+		t.Errorf("mod.Symbols[1]; got:%v, want:absolute zero", s)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	ctx := assembleString("org 0x1000\nzero equ 0xfb\n\nstart lda zero\nglobal start\nfor i = 0, 1\nendfor")
+	if ctx.errors != 0 {
+		t.Fatalf("assemble() errors; got:%d, want:0", ctx.errors)
+	}
+	syms := ctx.Symbols()
+	if len(syms) != 2 {
+		t.Fatalf("len(ctx.Symbols()); got:%d, want:2", len(syms))
+	}
+	if s := syms[0]; s.Name != "start" || s.Segment != "code" || s.Value != 0x1000 || !s.Global || s.Line != 4 {
+		t.Errorf("syms[0]; got:%+v, want:global start at $1000 on line 4", s)
+	}
+	if s := syms[1]; s.Name != "zero" || s.Segment != "" || s.Value != 0xfb || s.Global || s.Line != 2 {
+		t.Errorf("syms[1]; got:%+v, want:zero = $fb on line 2", s)
+	}
+}
+
+func TestDebugLines(t *testing.T) {
+	ctx := assembleString("org 0x1000\nstart  lda #1\n\n  rept 2\n  nop\n  endr\nvalue equ 3\nloop db 1, 2")
+	if ctx.errors != 0 {
+		t.Fatalf("assemble() errors; got:%d, want:0", ctx.errors)
+	}
+	lines := ctx.Module().Segments[0].Lines
+	for i, want := range []struct {
+		offset, size, line, column int
+		scope                      string
+	}{
+		{0, 2, 2, 8, "start"},
+		{2, 1, 5, 3, "start"},
+		{3, 1, 5, 3, "start"},
+		{4, 2, 8, 6, "loop"},
+	} {
+		if i >= len(lines) {
+			t.Fatalf("len(lines); got:%d, want:4", len(lines))
+		}
+		l := lines[i]
+		if l.Offset != want.offset || l.Size != want.size || l.Line != want.line || l.Column != want.column || l.Scope != want.scope {
+			t.Errorf("lines[%d]; got:%+v, want:%+v", i, *l, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package asm
+
+import (
+	"fmt"
+	"v65/obj"
+)
+
+type tokInes struct {
+	name string
+}
+type tokBank struct{}
+type tokVectors struct{}
+
+// assemble assembles an instruction that sets a field of the iNES header
+// of a NES ROM: inesprg N (16K PRG banks), ineschr N (8K CHR banks),
+// inesmap N (mapper) or inesmir N (mirroring).
+func (t *tokInes) assemble(ctx *context, _label *localSymbol) error {
+	n, err := ctx.constExpr()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > 0xfff {
+		ctx.error("%s out of range: %d", t.name, n)
+		return parseError
+	}
+	if ctx.attributes == nil {
+		ctx.attributes = make(map[string]int)
+	}
+	if old, ok := ctx.attributes[t.name]; ok && old != int(n) && ctx.pass != 2 {
+		ctx.error("%s already set to %d", t.name, old)
+		return parseError
+	}
+	ctx.attributes[t.name] = int(n)
+	return nil
+}
+
+// assemble assembles a bank instruction: bank N
+// Code and data that follows is emitted into bank N, which has a segment
+// of its own.
+func (*tokBank) assemble(ctx *context, _label *localSymbol) error {
+	n, err := ctx.constExpr()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > 0xff {
+		ctx.error("bank out of range: %d", n)
+		return parseError
+	}
+	ctx.selectSegment(fmt.Sprintf("bank%d", n)).bank = int(n)
+	return nil
+}
+
+// assemble assembles a vectors instruction: vectors NMI, RESET, IRQ
+// The output puts the addresses in the interrupt vectors at $fffa.
+func (*tokVectors) assemble(ctx *context, _label *localSymbol) error {
+	for i, kind := range []int{obj.NMI, obj.Reset, obj.IRQ} {
+		if i > 0 {
+			if _, ok := ctx.expect(func(t token) bool {
+				_, ok := t.(*tokComma)
+				return ok
+			}, "','"); !ok {
+				return parseError
+			}
+		}
+		if err := assembleVector(ctx, kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	for _, name := range []string{"inesprg", "ineschr", "inesmap", "inesmir"} {
+		metaMap[name] = &tokInes{name}
+	}
+	metaMap["bank"] = &tokBank{}
+	metaMap["vectors"] = &tokVectors{}
+}
@@ -0,0 +1,79 @@
+package asm
+
+import (
+	"testing"
+	"v65/obj"
+)
+
+func TestNES(t *testing.T) {
+	for _, tc := range []struct {
+		str        string
+		wantErrors int
+	}{
+		{"inesprg 1\nineschr 1\ninesmap 0\ninesmir 1", 0},
+		{"inesprg 1\ninesprg 1", 0},
+		{"inesprg 1\ninesprg 2", 1},
+		{"inesmap 4096", 1},
+		{"bank 0\norg 0xc000\nnop\nbank 1\norg 0xe000\nnop\nbank 0\nnop", 0},
+		{"bank 256", 1},
+		{"vectors nmi, reset, 0\nnmi rti\nreset nop", 0},
+		{"vectors 1, 2", 1},
+		{"vectors <1, 2, 3", 1},
+	} {
+		println(tc.str)
+		ctx := assembleString(tc.str)
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+	}
+}
+
+func TestNESModule(t *testing.T) {
+	ctx := assembleString("inesprg 1\nineschr 1\nbank 1\norg 0xe000\nreset nop\nbank 2\norg 0\ndb 0xff\nvectors reset, reset, reset")
+	if ctx.errors != 0 {
+		t.Fatalf("assemble() errors; got:%d, want:0", ctx.errors)
+	}
+	mod := ctx.Module()
+	if mod.Attributes["inesprg"] != 1 || mod.Attributes["ineschr"] != 1 {
+		t.Errorf("mod.Attributes; got:%v, want:inesprg 1 and ineschr 1", mod.Attributes)
+	}
+	for name, bank := range map[string]int{"bank1": 1, "bank2": 2} {
+		if seg := mod.Segment(name); seg == nil || seg.Bank != bank || !seg.Absolute {
+			t.Errorf("segment %s; got:%v, want:absolute in bank %d", name, seg, bank)
+		}
+	}
+	if len(mod.Vectors) != 3 || mod.Vectors[1].Kind != obj.Reset || mod.Vectors[1].Value != 0xe000 {
+		t.Errorf("mod.Vectors; got:%v, want:NMI, reset and IRQ at $e000", mod.Vectors)
+	}
+}
+
+func TestBankOf(t *testing.T) {
+	for _, tc := range []struct {
+		str        string
+		wantErrors int
+		wantBytes  []byte // The code of segment bank0.
+	}{
+		{"bank 0\norg 0x8000\nlda #bank(fn)\nlda #bank(fn)+1\nbank 3\norg 0x8000\nfn rts", 0, []byte{0xa9, 0x03, 0xa9, 0x04}},
+		{"bank 0\norg 0x8000\nextern fn\nlda #bank(fn)", 0, []byte{0xa9, 0x00}},
+		{"bank 0\nconst equ 1\nlda #bank(const)", 1, nil},
+		{"bank 0\nlda #bank(missing)", 1, nil},
+		{"bank 0\nlda #bank fn\nfn rts", 1, nil},
+		{"bank 0\nlda #<bank(fn)\nfn rts", 1, nil},
+	} {
+		println(tc.str)
+		ctx := assembleString(tc.str)
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+		if tc.wantErrors != 0 {
+			continue
+		}
+		seg := ctx.Module().Segment("bank0")
+		for i, b := range tc.wantBytes {
+			if i >= len(seg.Code) || seg.Code[i] != b {
+				t.Errorf("code[%d]; got:%v, want:%v", i, seg.Code, tc.wantBytes)
+				break
+			}
+		}
+	}
+}
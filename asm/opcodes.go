@@ -12,7 +12,7 @@ var opcodes = opcodeMap{
 	"and": {-1, -1, 0x2d, 0x25, 0x29, 0x3d, 0x39, 0x21, 0x31, 0x35, -1, -1, -1},
 	"asl": {-1, 0x0a, 0x0e, 0x06, -1, 0x1e, -1, -1, -1, 0x16, -1, -1, -1},
 	"bcc": {-1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, 0x90, -1},
-	"bcs": {-1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, 0x80, -1},
+	"bcs": {-1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, 0xb0, -1},
 	"beq": {-1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, 0xf0, -1},
 	"bit": {-1, -1, 0x2c, 0x24, -1, -1, -1, -1, -1, -1, -1, -1, -1},
 	"bmi": {-1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, 0x30, -1},
@@ -66,7 +66,53 @@ var opcodes = opcodeMap{
 	"tya": {0x98, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1},
 }
 
-func (op *tokOpcode) assemble(ctx *context) error {
+// zeroPageModes maps the absolute addressing modes to their zero page
+// counterparts.
+var zeroPageModes = map[int]int{
+	absolute:  zeroPage,
+	absoluteX: zeroPageX,
+	absoluteY: zeroPageY,
+}
+
+// zeroPage decides whether an operand can use zero page addressing. The
+// decision made in pass 1 is reused in pass 2, so that the size of the
+// instruction cannot change between the passes.
+func (ctx *context) zeroPage(val *exprValue) bool {
+	zp := !ctx.undefined && val.val >= 0 && val.val < 256
+	switch {
+	case val.part != partAll:
+		// A single byte of a relocatable value.
+		zp = true
+	case val.sym != nil:
+		// The linker checks that the symbol is really in the zero page.
+		zp = val.sym.zeroPage
+	case val.seg != nil:
+		// Relocatable segments are never placed in the zero page.
+		zp = false
+	}
+	if ctx.pass != 2 {
+		ctx.zeroPages = append(ctx.zeroPages, zp)
+		return zp
+	}
+	decided := ctx.zeroPages[ctx.zeroPageIndex]
+	ctx.zeroPageIndex++
+	if decided && !zp {
+		ctx.error("operand does not fit in the zero page: %d", val.val)
+	}
+	return decided
+}
+
+// checkByte reports an error in pass 2 if the value of a one byte operand
+// is not in the range min..max. A relocatable value is only known after
+// linking.
+func (ctx *context) checkByte(val *exprValue, min, max int64) {
+	if ctx.pass == 2 && !val.relocatable() && (val.val < min || val.val > max) {
+		ctx.error("operand does not fit in a byte: %d", val.val)
+	}
+}
+
+func (op *tokOpcode) assemble(ctx *context, _label *localSymbol) error {
+	ctx.undefined = false
 	mode, val, err := ctx.parseAddressingMode()
 	if err != nil {
 		return parseError
@@ -77,25 +123,30 @@ func (op *tokOpcode) assemble(ctx *context) error {
 	if opcodes[op.opcode][relative] != -1 {
 		if mode != absolute {
 			ctx.error("illegal addressing mode for %s instruction", op.opcode)
+			return parseError
 		}
 		mode = relative
 
 		if val.sym != nil {
 			ctx.error("target address of branch instruction may not be an external symbol")
+			return parseError
+		}
+		if ctx.pass == 2 && val.seg != ctx.seg && !ctx.seg.absolute {
+			ctx.error("target address of branch instruction must be in the same segment")
+			return parseError
 		}
 	}
 
 	// Special cases for zero page access. These accesses cannot use an
 	// external symbol, because we cannot have absolute code labels in the
-	// zero page.
-	if mode == absolute && val.sym == nil && val.val < 256 {
-		mode = zeroPage
+	// zero page, unless the symbol was declared to be in the zero page.
+	if zpMode, ok := zeroPageModes[mode]; ok && opcodes[op.opcode][zpMode] != -1 && ctx.zeroPage(val) {
+		mode = zpMode
 	}
-	if mode == absoluteX && val.sym == nil && val.val < 256 {
-		mode = zeroPageX
-	}
-	if mode == absoluteY && val.sym == nil && val.val < 256 {
-		mode = zeroPageY
+
+	if (mode == indexedIndirect || mode == indirectIndexed) && val.sym != nil && !val.sym.zeroPage {
+		ctx.error("external symbol %s needs to be declared as zp for indirect indexed addressing", val.sym.id)
+		return parseError
 	}
 
 	code := opcodes[op.opcode][mode]
@@ -113,27 +164,45 @@ func (op *tokOpcode) assemble(ctx *context) error {
 	case accumulator: // A
 		// pass
 
-	// Cases that not require two additional bytes to be written.
+	// Cases that require two additional bytes to be written.
 	case absolute: // <expression>
 		fallthrough
 	case absoluteX: // <expression>, X
 		fallthrough
 	case absoluteY: // <expression>, Y
 		fallthrough
+	case indirect: // (<expression>)
+		if mode == absolute && (op.opcode == "jsr" || op.opcode == "jmp") {
+			ctx.seg.maybeAddCall(val)
+		} else {
+			ctx.seg.maybeAddReloc(val, 2)
+		}
+		ctx.seg.emitWord(val.val)
+
+	// Cases that require one additional byte to be written. The zero page
+	// modes have been checked by zeroPage.
 	case indexedIndirect: // (<expression>, X)
 		fallthrough
 	case indirectIndexed: // (<expression>), Y
+		ctx.checkByte(val, 0, 255)
 		fallthrough
-	case indirect: // (<expression>)
-		ctx.seg.emitWord(val.val)
-		ctx.seg.relocs.maybeAdd(val, ctx.seg.lc, 2)
 	case zeroPage:
 		fallthrough
 	case zeroPageX:
 		fallthrough
 	case zeroPageY:
-		fallthrough
+		ctx.seg.maybeAddReloc(val, 1)
+		ctx.seg.emit(val.val)
 	case immediate: // #<expression>
+		ctx.checkByte(val, -128, 255)
+		ctx.seg.maybeAddReloc(val, 1)
+		ctx.seg.emit(val.val)
+	case relative:
+		offset := val.val - int64(ctx.seg.lc+1)
+		if ctx.pass == 2 && (offset < -128 || offset > 127) {
+			ctx.error("branch target out of range: %d", offset)
+		}
+		ctx.seg.emit(offset)
 
 	default:
 		_, file, line, _ := runtime.Caller(1)
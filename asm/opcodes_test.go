@@ -0,0 +1,67 @@
+package asm
+
+import "testing"
+
+func TestOpcodes(t *testing.T) {
+	for _, tc := range []struct {
+		str        string
+		wantErrors int
+		wantRelocs int
+		wantBytes  []byte
+	}{
+		{"nop", 0, 0, []byte{0xea}},
+		{"asl a", 0, 0, []byte{0x0a}},
+		{"lda #42", 0, 0, []byte{0xa9, 42}},
+		{"lda 0x42", 0, 0, []byte{0xa5, 0x42}},
+		{"lda 0x1234", 0, 0, []byte{0xad, 0x34, 0x12}},
+		{"lda 0x42,x", 0, 0, []byte{0xb5, 0x42}},
+		{"lda 0x42,y", 0, 0, []byte{0xb9, 0x42, 0x00}},
+		{"ldx 0x42,y", 0, 0, []byte{0xb6, 0x42}},
+		{"lda (0x42,x)", 0, 0, []byte{0xa1, 0x42}},
+		{"lda (0x42),y", 0, 0, []byte{0xb1, 0x42}},
+		{"jmp (0x1234)", 0, 0, []byte{0x6c, 0x34, 0x12}},
+		{"jmp 0x10", 0, 0, []byte{0x4c, 0x10, 0x00}},
+		{"jsr foo", 0, 1, []byte{0x20, 0x00, 0x00}},
+		{"lda foo", 0, 1, []byte{0xad, 0x00, 0x00}},
+		{"lda #foo", 0, 1, []byte{0xa9, 0x00}},
+		{"lda #255", 0, 0, []byte{0xa9, 0xff}},
+		{"lda #-128", 0, 0, []byte{0xa9, 0x80}},
+		{"lda #300", 1, 0, []byte{}},
+		{"ldx #-200", 1, 0, []byte{}},
+		{"lda (1000),y", 1, 0, []byte{}},
+		{"lda (0x1234,x)", 1, 0, []byte{}},
+		{"lda (-1),y", 1, 0, []byte{}},
+		{"lda zpv", 0, 1, []byte{0xa5, 0x00}},
+		{"lda zpv+1,x", 0, 1, []byte{0xb5, 0x01}},
+		{"lda (zpv),y", 0, 1, []byte{0xb1, 0x00}},
+		{"jmp zpv", 0, 1, []byte{0x4c, 0x00, 0x00}},
+		{"lda (foo),y", 1, 0, []byte{}},
+		{"lda fwd\nfwd nop", 0, 0, []byte{0xad, 0x03, 0x00, 0xea}},
+		{"loop dex\nbne loop", 0, 0, []byte{0xca, 0xd0, 0xfd}},
+		{"bcs done\nnop\ndone rts", 0, 0, []byte{0xb0, 0x01, 0xea, 0x60}},
+		{"bne 0x200", 1, 0, []byte{}},
+		{"bne foo", 1, 0, []byte{}},
+		{"bne #1", 1, 0, []byte{}},
+		{"sta #1", 1, 0, []byte{}},
+	} {
+		println(tc.str)
+		ctx := assembleString("extern foo, zpv: zp\n" + tc.str)
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+		if tc.wantErrors != 0 {
+			continue
+		}
+		if len(ctx.seg.relocs) != tc.wantRelocs {
+			t.Errorf("len(ctx.seg.relocs); got:%d, want:%d", len(ctx.seg.relocs), tc.wantRelocs)
+		}
+		if ctx.seg.size != len(tc.wantBytes) {
+			t.Errorf("ctx.seg.size; got:%d, want:%d", ctx.seg.size, len(tc.wantBytes))
+		}
+		for i, b := range tc.wantBytes {
+			if ctx.seg.code[i] != b {
+				t.Errorf("code[%d]; got:%d, want:%d", i, ctx.seg.code[i], b)
+			}
+		}
+	}
+}
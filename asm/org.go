@@ -0,0 +1,94 @@
+package asm
+
+type tokOrg struct{}
+type tokSegment struct{}
+
+// assemble assembles an org instruction: org ADDR
+// This gives the current segment a fixed address, so that it does not
+// need to be relocated by the linker. An absolute segment can have more
+// than one org, each of which starts a new block of code.
+func (*tokOrg) assemble(ctx *context, label *localSymbol) error {
+	addr, err := ctx.constExpr()
+	if err != nil {
+		return err
+	}
+	if addr < 0 || addr > 0xffff {
+		ctx.error("address out of range: %d", addr)
+		return parseError
+	}
+	seg := ctx.seg
+	if seg.parent != "" {
+		ctx.error("org in section %s", seg.name)
+		return parseError
+	}
+	if !seg.absolute {
+		if seg.size > 0 {
+			ctx.error("org in relocatable segment %s after code", seg.name)
+			return parseError
+		}
+		seg.absolute = true
+		seg.org = int(addr)
+	}
+	if int(addr) < seg.org {
+		seg.org = int(addr)
+	}
+	seg.startBlock(int(addr))
+	if label != nil {
+		label.value = addr
+		label.seg = seg
+	}
+	return nil
+}
+
+// checkBlocks reports the org blocks of the absolute segments that
+// overlap, because the code of one block overwrites the other.
+func (ctx *context) checkBlocks() {
+	for _, seg := range ctx.allSegments() {
+		if !seg.absolute {
+			continue
+		}
+		var last [2]int // The block that reaches the furthest so far.
+		for i, b := range seg.sortedBlocks() {
+			if i > 0 && b[0] < last[1] {
+				ctx.error("org block at $%04x overlaps the block at $%04x in segment %s", b[0], last[0], seg.name)
+			}
+			if i == 0 || b[1] > last[1] {
+				last = b
+			}
+		}
+	}
+}
+
+// assemble assembles a segment instruction: segment NAME
+// Code and data that follows is emitted into the named segment, which is
+// created if it does not exist yet.
+func (*tokSegment) assemble(ctx *context, _label *localSymbol) error {
+	tok, ok := ctx.expect(func(t token) bool {
+		_, ok := t.(*tokIdentifier)
+		return ok
+	}, "segment name")
+	if !ok {
+		return parseError
+	}
+	ctx.selectSegment(tok.(*tokIdentifier).id)
+	return nil
+}
+
+// selectSegment makes the segment with the given name the current one,
+// creating it if it does not exist yet.
+func (ctx *context) selectSegment(name string) *segment {
+	for _, seg := range ctx.allSegments() {
+		if seg.name == name {
+			ctx.seg = seg
+			return seg
+		}
+	}
+	ctx.seg = newNamedSegment(name, ctx.seg.symbols)
+	ctx.segments = append(ctx.segments, ctx.seg)
+	return ctx.seg
+}
+
+func init() {
+	metaMap["org"] = &tokOrg{}
+	metaMap["segment"] = &tokSegment{}
+}
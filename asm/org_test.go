@@ -0,0 +1,150 @@
+package asm
+
+import (
+	"testing"
+	"v65/obj"
+)
+
+func TestInternalRelocations(t *testing.T) {
+	for _, tc := range []struct {
+		str        string
+		wantErrors int
+		wantBytes  []byte
+		wantRelocs []relocation // Relocations for the "code" segment.
+	}{
+		{"start nop\njmp start", 0, []byte{0xea, 0x4c, 0x00, 0x00}, []relocation{{lc: 2, size: 2, call: true}}},
+		{"start nop\nlda bank(start)", 0, []byte{0xea, 0xa5, 0x00}, []relocation{{lc: 2, size: 1, part: partBank}}},
+		{"start nop\ndb bank(start)+1", 0, []byte{0xea, 0x01}, []relocation{{lc: 1, size: 1, addend: 1, part: partBank}}},
+		{"nop\ntable dw table+2", 0, []byte{0xea, 0x03, 0x00}, []relocation{{lc: 1, size: 2, addend: 3}}},
+		{"nop\nlda data\ndata db 1", 0, []byte{0xea, 0xad, 0x04, 0x00, 0x01}, []relocation{{lc: 2, size: 2, addend: 4}}},
+		{"lda #<data\nldx #>data\ndata db 1", 0, []byte{0xa9, 0x04, 0xa2, 0x04, 0x01}, []relocation{{lc: 1, size: 1, addend: 4, part: partLow}, {lc: 3, size: 1, addend: 4, part: partHigh}}},
+		{"start nop\nfinish db finish-start", 0, []byte{0xea, 0x01}, nil},
+		{"loop dex\nbne loop", 0, []byte{0xca, 0xd0, 0xfd}, nil},
+		{"org 0x1000\nstart nop\njmp start", 0, []byte{0xea, 0x4c, 0x00, 0x10}, nil},
+		{"org 0x1000\nlda <start\nstart nop", 0, []byte{0xa5, 0x02, 0xea}, nil},
+		{"nop\norg 0x1000", 1, nil, nil},
+		{"org 0xffff\nnop", 0, []byte{0xea}, nil},
+		{"org 0xffff\nnop\nnop", 1, nil, nil},
+		{"org 0xfffe\njmp 0x1000", 1, nil, nil},
+		{"org 0x10000", 1, nil, nil},
+		{"start nop\ndb start*2", 1, nil, nil},
+		{"segment data\nvalue db 1\nsegment code\nlda value", 0, []byte{0xad, 0x00, 0x00}, nil},
+	} {
+		println(tc.str)
+		ctx := assembleString(tc.str)
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+		if tc.wantErrors != 0 {
+			continue
+		}
+		seg := ctx.allSegments()[0]
+		code := seg.code[seg.org:seg.size]
+		if len(code) != len(tc.wantBytes) {
+			t.Errorf("code size; got:%d, want:%d", len(code), len(tc.wantBytes))
+		}
+		for i, b := range tc.wantBytes {
+			if i < len(code) && code[i] != b {
+				t.Errorf("code[%d]; got:$%x, want:$%x", i, code[i], b)
+			}
+		}
+		got := seg.internal[seg.name]
+		if len(got) != len(tc.wantRelocs) {
+			t.Errorf("len(internal relocations); got:%d, want:%d", len(got), len(tc.wantRelocs))
+			continue
+		}
+		for i, r := range tc.wantRelocs {
+			if got[i] != r {
+				t.Errorf("relocation %d; got:%v, want:%v", i, got[i], r)
+			}
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	ctx := assembleString("segment data\nvalue db 1\nsegment code\nlda value\nsegment data\ndb 2")
+	if ctx.errors != 0 {
+		t.Fatalf("assemble() errors; got:%d, want:0", ctx.errors)
+	}
+	mod := ctx.Module()
+	if len(mod.Segments) != 2 {
+		t.Fatalf("len(mod.Segments); got:%d, want:2", len(mod.Segments))
+	}
+	code, data := mod.Segment("code"), mod.Segment("data")
+	if len(code.Code) != 3 || len(data.Code) != 2 {
+		t.Errorf("segment sizes; got:%d/%d, want:3/2", len(code.Code), len(data.Code))
+	}
+	if len(code.Relocs) != 1 || code.Relocs[0].Segment != "data" || code.Relocs[0].Offset != 1 {
+		t.Errorf("code.Relocs; got:%v, want:one relocation for data at offset 1", code.Relocs)
+	}
+}
+
+func TestOrgBlocks(t *testing.T) {
+	ctx := assembleString("org 0x2000\ninit lda #1\nrts\ninitad init\norg 0x3000\nstart nop\norg 0x2003\nnop\nrunad start")
+	if ctx.errors != 0 {
+		t.Fatalf("assemble() errors; got:%d, want:0", ctx.errors)
+	}
+	mod := ctx.Module()
+	if len(mod.Segments) != 2 {
+		t.Fatalf("len(mod.Segments); got:%d, want:2", len(mod.Segments))
+	}
+	for i, want := range []struct {
+		name string
+		addr int
+		size int
+	}{
+		{"code", 0x2000, 4},
+		{"code@3000", 0x3000, 1},
+	} {
+		seg := mod.Segments[i]
+		if seg.Name != want.name || seg.Addr != want.addr || len(seg.Code) != want.size || !seg.Absolute {
+			t.Errorf("mod.Segments[%d]; got:%s at $%04x with %d bytes, want:%s at $%04x with %d bytes", i, seg.Name, seg.Addr, len(seg.Code), want.name, want.addr, want.size)
+		}
+	}
+	if len(mod.Vectors) != 2 {
+		t.Fatalf("len(mod.Vectors); got:%d, want:2", len(mod.Vectors))
+	}
+	for i, want := range []obj.Vector{
+		{Kind: obj.Init, Value: 0x2000, AtSegment: "code", AtOffset: 3},
+		{Kind: obj.Run, Value: 0x3000, AtSegment: "code", AtOffset: 4},
+	} {
+		if *mod.Vectors[i] != want {
+			t.Errorf("mod.Vectors[%d]; got:%+v, want:%+v", i, *mod.Vectors[i], want)
+		}
+	}
+}
+
+func TestOrgOverlap(t *testing.T) {
+	for _, tc := range []struct {
+		str        string
+		wantErrors int
+		wantRanges [][2]int
+	}{
+		{"org 0x2000\ndb 1,2,3\norg 0x2003\ndb 9", 0, [][2]int{{0x2000, 0x2004}}},
+		{"org 0x2003\ndb 9\norg 0x2000\ndb 1,2,3", 0, [][2]int{{0x2000, 0x2004}}},
+		{"org 0x2000\ndb 1,2,3\norg 0x2004\ndb 9", 0, [][2]int{{0x2000, 0x2003}, {0x2004, 0x2005}}},
+		{"org 0x2000\ndb 1,2,3\norg 0x2001\ndb 9", 1, nil},
+		{"org 0x2001\ndb 9\norg 0x2000\ndb 1,2,3", 1, nil},
+		{"org 0x2000\ndb 1,2,3,4\norg 0x2001\ndb 9\norg 0x2002\ndb 8", 2, nil},
+		{"org 0x2000\ndb 1,2,3,4\norg 0x2001\ndb 9\norg 0x2003\ndb 8", 2, nil},
+	} {
+		println(tc.str)
+		ctx := assembleString(tc.str)
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+		if tc.wantErrors != 0 {
+			continue
+		}
+		got := ctx.seg.ranges()
+		if len(got) != len(tc.wantRanges) {
+			t.Errorf("ranges(); got:%v, want:%v", got, tc.wantRanges)
+			continue
+		}
+		for i, r := range tc.wantRanges {
+			if got[i] != r {
+				t.Errorf("ranges()[%d]; got:%v, want:%v", i, got[i], r)
+			}
+		}
+	}
+}
@@ -3,20 +3,40 @@ package asm
 type relocation struct {
 	lc int
 	size int
+	addend int64 // The constant that is added to the value of the symbol.
+	part int // The part of the value that is stored (see exprValue).
+	call bool // Is the value the target of a jsr or jmp?
 }
 
 type relocMap map[string][]relocation
 
-func (r relocMap) add(sym string, lc int, size int) {
+func (r relocMap) add(sym string, reloc relocation) {
 	_, ok := r[sym]
 	if !ok {
 		r[sym] = make([]relocation, 0, 1)
 	}
-	r[sym] = append(r[sym], relocation{lc, size})
+	r[sym] = append(r[sym], reloc)
 }
 
-func (r relocMap) maybeAdd(val *exprValue, lc int, size int) {
-	if val.sym != nil {
-		r.add(val.sym.id, lc, size)
+// maybeAddReloc adds a relocation for a value of size bytes at the
+// location counter, if the value is relocatable.
+func (seg *segment) maybeAddReloc(val *exprValue, size int) {
+	seg.addReloc(val, relocation{lc: seg.lc, size: size, addend: val.val, part: val.part})
+}
+
+// maybeAddCall adds a relocation for the target address of a jsr or jmp
+// at the location counter, if the address is relocatable. The linker
+// checks that the target can be called from the bank of the segment.
+func (seg *segment) maybeAddCall(val *exprValue) {
+	seg.addReloc(val, relocation{lc: seg.lc, size: 2, addend: val.val, part: val.part, call: true})
+}
+
+// addReloc adds a relocation for a relocatable value.
+func (seg *segment) addReloc(val *exprValue, reloc relocation) {
+	switch {
+	case val.sym != nil:
+		seg.relocs.add(val.sym.id, reloc)
+	case val.seg != nil:
+		seg.internal.add(val.seg.name, reloc)
 	}
 }
\ No newline at end of file
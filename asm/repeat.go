@@ -0,0 +1,187 @@
+package asm
+
+type tokRept struct{}
+type tokEndr struct{}
+type tokFor struct{}
+type tokEndfor struct{}
+
+// keyword returns the keyword that ends a rept block.
+func (*tokEndr) keyword() string {
+	return "endr"
+}
+
+// keyword returns the keyword that ends a for block.
+func (*tokEndfor) keyword() string {
+	return "endfor"
+}
+
+// blockKeyword returns the first token on a line that is not a label.
+func blockKeyword(line string) token {
+	l := &lexer{newSourceFromString(line), nil}
+	tok := l.getToken()
+	if _, ok := tok.(*tokIdentifier); ok {
+		tok = l.getToken()
+	}
+	return tok
+}
+
+// endBlock consumes the tokens on the current line up to and including
+// the one that ends the block and checks that it is the expected one.
+func (ctx *context) endBlock(tok token, ender string) error {
+	be, ok := tok.(blockEnder)
+	if !ok {
+		ctx.error("missing %s", ender)
+		return parseError
+	}
+	if be.keyword() != ender {
+		ctx.error("expected %s, not %s", ender, be.keyword())
+		return parseError
+	}
+	return nil
+}
+
+// skipBlock skips the lines up to the end of the current block without
+// assembling them.
+func (ctx *context) skipBlock(ender string) error {
+	src := ctx.lexer.src
+	depth := 0
+	for {
+		src.moveToNextLine()
+		if src.lineNo > len(src.lines) {
+			return ctx.endBlock(&tokEOF{}, ender)
+		}
+		switch blockKeyword(src.lines[src.lineNo-1]).(type) {
+		case *tokRept, *tokFor:
+			depth++
+		case *tokEndr, *tokEndfor:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			tok := ctx.lexer.getToken()
+			if _, ok := tok.(*tokIdentifier); ok {
+				tok = ctx.lexer.getToken()
+			}
+			return ctx.endBlock(tok, ender)
+		}
+	}
+}
+
+// repeat assembles the lines up to the end of the current block n times.
+// Before every iteration the iteration function is called with the
+// iteration number. Every iteration has its own labels, so that the block
+// can branch to a label in it.
+func (ctx *context) repeat(n int64, ender string, iteration func(i int64)) error {
+	if tok := ctx.lexer.getToken(); !isNewLine(tok) {
+		ctx.error("expected end-of-line, not: '%T(%v)'", tok, tok)
+		return parseError
+	}
+	if n <= 0 {
+		return ctx.skipBlock(ender)
+	}
+	start := ctx.lexer.src.lineNo + 1
+	for i := int64(0); i < n; i++ {
+		ctx.lexer.src.seek(start)
+		iteration(i)
+		ctx.labelScopes = append(ctx.labelScopes, ctx.iterationLabels())
+		err := ctx.endBlock(ctx.assembleBlock(), ender)
+		ctx.labelScopes = ctx.labelScopes[:len(ctx.labelScopes)-1]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iterationLabels returns the table for the labels of the next iteration
+// of a repeated block. Pass 2 reuses the tables of pass 1, so that a label
+// can be used before it is defined.
+func (ctx *context) iterationLabels() symbolMap {
+	if ctx.pass != 2 {
+		labels := make(symbolMap)
+		ctx.iterations = append(ctx.iterations, labels)
+		return labels
+	}
+	labels := ctx.iterations[ctx.iterationIndex]
+	ctx.iterationIndex++
+	return labels
+}
+
+// assemble assembles a rept instruction: rept COUNT
+// Labels in the block are local to each repetition.
+func (*tokRept) assemble(ctx *context, _label *localSymbol) error {
+	n, err := ctx.constExpr()
+	if err != nil {
+		return err
+	}
+	return ctx.repeat(n, "endr", func(int64) {})
+}
+
+// assemble assembles a for instruction: for VAR = START, END[, STEP]
+// The variable is available as a symbol in the block. Labels in the block
+// are local to each iteration.
+func (*tokFor) assemble(ctx *context, _label *localSymbol) error {
+	tok, ok := ctx.expect(func(t token) bool {
+		_, ok := t.(*tokIdentifier)
+		return ok
+	}, "loop variable")
+	if !ok {
+		return parseError
+	}
+	id := tok.(*tokIdentifier).id
+	if _, ok := ctx.expect(func(t token) bool {
+		_, ok := t.(*tokEquals)
+		return ok
+	}, "'='"); !ok {
+		return parseError
+	}
+	start, err := ctx.constExpr()
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.expect(func(t token) bool {
+		_, ok := t.(*tokComma)
+		return ok
+	}, "','"); !ok {
+		return parseError
+	}
+	end, err := ctx.constExpr()
+	if err != nil {
+		return err
+	}
+	step, ok, err := ctx.optionalArg()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		step = 1
+	}
+	if step == 0 {
+		ctx.error("step of for loop cannot be zero")
+		return parseError
+	}
+	v, err := ctx.defineVariable(id)
+	if err != nil {
+		return err
+	}
+	n := (end-start)/step + 1
+	if (end-start)*step < 0 {
+		n = 0
+	}
+	return ctx.repeat(n, "endfor", func(i int64) {
+		v.value = start + i*step
+	})
+}
+
+// isNewLine returns true if the token is a newline.
+func isNewLine(tok token) bool {
+	_, ok := tok.(*tokNewLine)
+	return ok
+}
+
+func init() {
+	metaMap["rept"] = &tokRept{}
+	metaMap["endr"] = &tokEndr{}
+	metaMap["for"] = &tokFor{}
+	metaMap["endfor"] = &tokEndfor{}
+}
@@ -0,0 +1,58 @@
+package asm
+
+import "testing"
+
+func TestRepeat(t *testing.T) {
+	for _, tc := range []struct {
+		str        string
+		wantErrors int
+		wantBytes  []byte
+	}{
+		{"rept 3\ndb 1\nendr", 0, []byte{1, 1, 1}},
+		{"rept 3\n\n; comment\ndb 1\nendr\ndb 2", 0, []byte{1, 1, 1, 2}},
+		{"rept 0\ndb 1\nendr\ndb 2", 0, []byte{2}},
+		{"rept 0\nrept 2\ndb 1\nendr\nendr\ndb 2", 0, []byte{2}},
+		{"rept 2\nrept 2\ndb 1\nendr\ndb 2\nendr", 0, []byte{1, 1, 2, 1, 1, 2}},
+		{"for i = 0, 3\ndb i*i\nendfor", 0, []byte{0, 1, 4, 9}},
+		{"for i = 3, 0, -1\ndb i\nendfor", 0, []byte{3, 2, 1, 0}},
+		{"for i = 0, 6, 3\ndb i\nendfor", 0, []byte{0, 3, 6}},
+		{"for i = 1, 0\ndb i\nendfor\ndb 9", 0, []byte{9}},
+		{"for i = 0, 1\nfor j = 0, 1\ndb i*2+j\nendfor\nendfor", 0, []byte{0, 1, 2, 3}},
+		{"for i = 0, 1\ndb i\nendfor\nfor i = 5, 6\ndb i\nendfor", 0, []byte{0, 1, 5, 6}},
+		{"for i = 254, 255\ndb (i*i)>>8, 1<<(i-254)\nendfor", 0, []byte{252, 1, 254, 2}},
+		{"for i = 0, 1\nlda 0x1000+i\nsta 0x20+i\nendfor", 0, []byte{0xad, 0x00, 0x10, 0x85, 0x20, 0xad, 0x01, 0x10, 0x85, 0x21}},
+		{"rept 2\nloop dex\nbne loop\nendr", 0, []byte{0xca, 0xd0, 0xfd, 0xca, 0xd0, 0xfd}},
+		{"rept 2\nbne skip\nnop\nskip nop\nendr", 0, []byte{0xd0, 0x01, 0xea, 0xea, 0xd0, 0x01, 0xea, 0xea}},
+		{"for i = 0, 1\nloop dex\nbne loop\nendfor", 0, []byte{0xca, 0xd0, 0xfd, 0xca, 0xd0, 0xfd}},
+		{"rept 2\nouter nop\nrept 2\ninner bne outer\nendr\nendr", 0, []byte{0xea, 0xd0, 0xfd, 0xd0, 0xfb, 0xea, 0xd0, 0xfd, 0xd0, 0xfb}},
+		{"top nop\nrept 2\nbne top\nendr", 0, []byte{0xea, 0xd0, 0xfd, 0xd0, 0xfb}},
+		{"rept 2\nl nop\nl nop\nendr", 2, []byte{}},
+		{"rept 1\nl nop\nendr\njmp l", 1, []byte{}},
+		{"rept 2\ndb 1", 1, []byte{}},
+		{"rept 70000\ndb 1\nendr", 1, []byte{}},
+		{"endr", 1, []byte{}},
+		{"rept 2 3\ndb 1\nendr", 2, []byte{}},
+		{"rept later\nendr\nlater equ 1", 2, []byte{}},
+		{"for i = 0, 1\ndb i\nendr", 1, []byte{}},
+		{"for i = 0, 1, 0\nendfor", 2, []byte{}},
+		{"for i, 0, 1\nendfor", 2, []byte{}},
+		{"i equ 1\nfor i = 0, 1\nendfor", 2, []byte{}},
+	} {
+		println(tc.str)
+		ctx := assembleString(tc.str)
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+		if tc.wantErrors != 0 {
+			continue
+		}
+		if ctx.seg.size != len(tc.wantBytes) {
+			t.Errorf("ctx.seg.size; got:%d, want:%d", ctx.seg.size, len(tc.wantBytes))
+		}
+		for i, b := range tc.wantBytes {
+			if ctx.seg.code[i] != b {
+				t.Errorf("code[%d]; got:%d, want:%d", i, ctx.seg.code[i], b)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package asm
+
+type tokRes struct{}
+type tokFill struct{}
+type tokAlign struct{}
+type tokPadTo struct{}
+
+// constExpr parses an expression that needs to have a known value in
+// pass 1, because it is used to move the location counter.
+func (ctx *context) constExpr() (int64, error) {
+	ctx.undefined = false
+	val := ctx.expr()
+	if val.sym != nil {
+		ctx.error("external symbol %s not allowed here", val.sym.id)
+		return 0, parseError
+	}
+	if ctx.undefined {
+		ctx.error("expression refers to a label that is not yet defined")
+		return 0, parseError
+	}
+	return val.val, nil
+}
+
+// optionalArg parses an optional ", expr" suffix, like the fill value of
+// res. If there is one, its value is returned and ok is true.
+func (ctx *context) optionalArg() (arg int64, ok bool, err error) {
+	next := ctx.lexer.getToken()
+	if _, isComma := next.(*tokComma); !isComma {
+		ctx.lexer.pushback(next)
+		return 0, false, nil
+	}
+	val := ctx.expr()
+	if val.sym != nil {
+		ctx.error("external symbol %s not allowed here", val.sym.id)
+		return 0, false, parseError
+	}
+	return val.val, true, nil
+}
+
+// advance moves the location counter n bytes forward. If fill is true the
+// bytes are emitted with the value v, otherwise space is only reserved.
+func (ctx *context) advance(n int64, v int64, fill bool) error {
+	if n < 0 {
+		ctx.error("negative size: %d", n)
+		return parseError
+	}
+	if !ctx.seg.fits(int(n)) {
+		ctx.error("reserving %d bytes overflows the segment", n)
+		return parseError
+	}
+	if !fill {
+		ctx.seg.reserve(int(n))
+		return nil
+	}
+	for i := int64(0); i < n; i++ {
+		ctx.seg.emit(v)
+	}
+	return nil
+}
+
+// assemble assembles a res instruction: res N[, fill]
+func (*tokRes) assemble(ctx *context, _label *localSymbol) error {
+	n, err := ctx.constExpr()
+	if err != nil {
+		return err
+	}
+	v, fill, err := ctx.optionalArg()
+	if err != nil {
+		return err
+	}
+	return ctx.advance(n, v, fill)
+}
+
+// assemble assembles a fill instruction: fill count, value
+func (*tokFill) assemble(ctx *context, _label *localSymbol) error {
+	n, err := ctx.constExpr()
+	if err != nil {
+		return err
+	}
+	v, fill, err := ctx.optionalArg()
+	if err != nil {
+		return err
+	}
+	if !fill {
+		ctx.error("expected ',' and fill value")
+		return parseError
+	}
+	return ctx.advance(n, v, true)
+}
+
+// assemble assembles an align instruction: align N[, fill]
+// N needs to be a power of two.
+func (*tokAlign) assemble(ctx *context, _label *localSymbol) error {
+	n, err := ctx.constExpr()
+	if err != nil {
+		return err
+	}
+	if n <= 0 || n&(n-1) != 0 {
+		ctx.error("alignment must be a power of two, not %d", n)
+		return parseError
+	}
+	v, fill, err := ctx.optionalArg()
+	if err != nil {
+		return err
+	}
+	if !ctx.seg.absolute && int(n) > ctx.seg.align {
+		// The linker needs to place the segment on this boundary as well.
+		ctx.seg.align = int(n)
+	}
+	lc := int64(ctx.seg.lc)
+	return ctx.advance((lc+n-1)&^(n-1)-lc, v, fill)
+}
+
+// assemble assembles a pad_to instruction: pad_to ADDR[, fill]
+// The padding is always emitted (with zeroes if no fill value is given),
+// because it is meant for building ROM images.
+func (*tokPadTo) assemble(ctx *context, _label *localSymbol) error {
+	addr, err := ctx.constExpr()
+	if err != nil {
+		return err
+	}
+	v, _, err := ctx.optionalArg()
+	if err != nil {
+		return err
+	}
+	if addr < int64(ctx.seg.lc) {
+		ctx.error("cannot pad to %d, location counter is already at %d", addr, ctx.seg.lc)
+		return parseError
+	}
+	return ctx.advance(addr-int64(ctx.seg.lc), v, true)
+}
+
+func init() {
+	metaMap["res"] = &tokRes{}
+	metaMap["fill"] = &tokFill{}
+	metaMap["align"] = &tokAlign{}
+	metaMap["pad_to"] = &tokPadTo{}
+}
@@ -0,0 +1,68 @@
+package asm
+
+import "testing"
+
+func TestReserve(t *testing.T) {
+	for _, tc := range []struct {
+		str        string
+		wantErrors int
+		wantLc     int
+		wantBytes  []byte
+	}{
+		{"res 3", 0, 3, []byte{0, 0, 0}},
+		{"res 3, 0xff", 0, 3, []byte{0xff, 0xff, 0xff}},
+		{"res -1", 1, 0, []byte{}},
+		{"res foo", 1, 0, []byte{}},
+		{"res 1, foo", 1, 0, []byte{}},
+		{"res 70000", 1, 0, []byte{}},
+		{"res 65535\ndb 1, 2, 3", 1, 65536, []byte{}},
+		{"res 65535\ndw 1", 1, 65535, []byte{}},
+		{"res 65535\nlda 1000", 1, 65536, []byte{}},
+		{"fill 2, 0xea", 0, 2, []byte{0xea, 0xea}},
+		{"fill 2", 1, 0, []byte{}},
+		{"db 1\nalign 4", 0, 4, []byte{1, 0, 0, 0}},
+		{"db 1\nalign 4, 0xff", 0, 4, []byte{1, 0xff, 0xff, 0xff}},
+		{"db 1,2,3,4\nalign 4", 0, 4, []byte{1, 2, 3, 4}},
+		{"db 1\nalign 256", 0, 256, []byte{1, 0}},
+		{"align 3", 1, 0, []byte{}},
+		{"align 0", 1, 0, []byte{}},
+		{"db 1\npad_to 3", 0, 3, []byte{1, 0, 0}},
+		{"db 1\npad_to 3, 0xff", 0, 3, []byte{1, 0xff, 0xff}},
+		{"db 1,2\npad_to 1", 1, 2, []byte{1, 2}},
+		{"res 2\nlabel db 7\nres label", 0, 5, []byte{0, 0, 7, 0, 0}},
+	} {
+		println(tc.str)
+		ctx := &context{
+			lexer: &lexer{newSourceFromString(tc.str), nil},
+			seg:   newSegment(),
+		}
+		ctx.seg.symbols["foo"] = &externSymbol{id: "foo"}
+		ctx.assemble()
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+		if ctx.seg.lc != tc.wantLc {
+			t.Errorf("ctx.seg.lc; got:%d, want:%d", ctx.seg.lc, tc.wantLc)
+		}
+		if ctx.seg.size != tc.wantLc {
+			t.Errorf("ctx.seg.size; got:%d, want:%d", ctx.seg.size, tc.wantLc)
+		}
+		for i, b := range tc.wantBytes {
+			if ctx.seg.code[i] != b {
+				t.Errorf("code[%d]; got:%d, want:%d", i, ctx.seg.code[i], b)
+			}
+		}
+	}
+}
+
+func TestReserveForwardReference(t *testing.T) {
+	ctx := &context{
+		pass:  1,
+		lexer: &lexer{newSourceFromString("res later\nlater equ 2"), nil},
+		seg:   newSegment(),
+	}
+	ctx.assemble()
+	if ctx.errors != 1 {
+		t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, 1)
+	}
+}
@@ -0,0 +1,43 @@
+package asm
+
+type tokSection struct{}
+
+// assemble assembles a section instruction: section NAME
+// Code and data that follows is emitted into a section of the current
+// segment. A section is placed with its segment, but the linker can drop
+// it if nothing refers to it, so every routine of a library can be put
+// in a section of its own. The section is named SEGMENT:NAME.
+func (*tokSection) assemble(ctx *context, _label *localSymbol) error {
+	tok, ok := ctx.expect(func(t token) bool {
+		_, ok := t.(*tokIdentifier)
+		return ok
+	}, "section name")
+	if !ok {
+		return parseError
+	}
+	parent := ctx.seg.name
+	if ctx.seg.parent != "" {
+		parent = ctx.seg.parent
+	}
+	if ctx.segment(parent).absolute {
+		ctx.error("section in absolute segment %s", parent)
+		return parseError
+	}
+	seg := ctx.selectSegment(parent + ":" + tok.(*tokIdentifier).id)
+	seg.parent = parent
+	return nil
+}
+
+// segment returns the segment with the given name, or nil.
+func (ctx *context) segment(name string) *segment {
+	for _, seg := range ctx.allSegments() {
+		if seg.name == name {
+			return seg
+		}
+	}
+	return nil
+}
+
+func init() {
+	metaMap["section"] = &tokSection{}
+}
@@ -0,0 +1,52 @@
+package asm
+
+import "testing"
+
+func TestSection(t *testing.T) {
+	ctx := assembleString("start jsr mul\nrts\nsection mul\nmul jmp add\nsection add\nadd rts\nsegment data\nsection table\ntable db 1\nglobal mul, add, table")
+	if ctx.errors != 0 {
+		t.Fatalf("assemble() errors; got:%d, want:0", ctx.errors)
+	}
+	mod := ctx.Module()
+	for i, want := range []struct {
+		name   string
+		parent string
+		size   int
+	}{
+		{"code", "", 4},
+		{"code:mul", "code", 3},
+		{"code:add", "code", 1},
+		{"data", "", 0},
+		{"data:table", "data", 1},
+	} {
+		if i >= len(mod.Segments) {
+			t.Fatalf("len(mod.Segments); got:%d, want:5", len(mod.Segments))
+		}
+		seg := mod.Segments[i]
+		if seg.Name != want.name || seg.Parent != want.parent || len(seg.Code) != want.size {
+			t.Errorf("mod.Segments[%d]; got:%s/%s/%d, want:%s/%s/%d", i, seg.Name, seg.Parent, len(seg.Code), want.name, want.parent, want.size)
+		}
+	}
+	if r := mod.Segment("code:mul").Relocs; len(r) != 1 || r[0].Segment != "code:add" || r[0].Addend != 0 {
+		t.Errorf("relocations of code:mul; got:%v, want:code:add", r)
+	}
+	if s := mod.Symbols[0]; s.Name != "add" || s.Segment != "code:add" || s.Value != 0 {
+		t.Errorf("mod.Symbols[0]; got:%v, want:add at the start of code:add", s)
+	}
+}
+
+func TestSectionErrors(t *testing.T) {
+	for _, tc := range []struct {
+		str string
+	}{
+		{"section"},
+		{"section 1"},
+		{"org 0x1000\nsection fn"},
+		{"section fn\norg 0x1000"},
+	} {
+		println(tc.str)
+		if ctx := assembleString(tc.str); ctx.errors == 0 {
+			t.Errorf("assemble(%q) errors; got:0, want:>0", tc.str)
+		}
+	}
+}
@@ -1,26 +1,62 @@
 package asm
 
+import "sort"
+
 // segment contains the generated machine language and symbols.
 type segment struct {
-	code    []byte
-	lc      int
-	size    int
-	symbols symbolMap
-	relocs  relocMap
+	name     string
+	code     []byte
+	lc       int
+	size     int
+	symbols  symbolMap
+	relocs   relocMap // Relocations for external symbols.
+	internal relocMap // Relocations for labels, keyed by segment name.
+	absolute bool     // Has the segment been given a fixed address with org?
+	org      int      // Lowest address of an absolute segment.
+	start    int      // Address of the current org block of an absolute segment.
+	blocks   [][2]int // Start and end addresses of the earlier org blocks.
+	align    int      // Alignment the segment needs when it is placed.
+	lines    []*lineInfo
+	bank     int    // The bank of a cartridge or of banked memory.
+	parent   string // The segment that a section is part of, "" if it is not a section.
+	overflow bool   // Did code not fit in the segment?
+	reported bool   // Has the overflow been reported?
 }
 
 // newSegment creates a new segment that can hold 64K of code and data.
 // 64K should really be enough for everyone :-)
 func newSegment() *segment {
+	return newNamedSegment(segmentName, make(symbolMap))
+}
+
+// newNamedSegment creates a new segment that shares the symbol table
+// with the other segments of the source.
+func newNamedSegment(name string, symbols symbolMap) *segment {
 	return &segment{
-		code:    make([]byte, 65536),
-		symbols: make(symbolMap),
-		relocs:  make(relocMap),
+		name:     name,
+		code:     make([]byte, 65536),
+		symbols:  symbols,
+		relocs:   make(relocMap),
+		internal: make(relocMap),
+		align:    1,
+	}
+}
+
+// location returns the value of an offset in the segment. In a relocatable
+// segment this value is only known after linking.
+func (seg *segment) location(offset int64) *exprValue {
+	if seg.absolute {
+		return &exprValue{val: offset}
 	}
+	return &exprValue{seg: seg, val: offset}
 }
 
-// emit writes a byte of data to the segment.
+// emit writes a byte of data to the segment. Data that does not fit is
+// dropped and marks the segment as overflowed.
 func (seg *segment) emit(b int64) {
+	if !seg.fitsCode(1) {
+		return
+	}
 	seg.code[seg.lc] = byte(b)
 	seg.lc++
 	if seg.lc > seg.size {
@@ -28,24 +64,98 @@ func (seg *segment) emit(b int64) {
 	}
 }
 
-// emitWord writes a word of data (16 bits) to the segment, big endian.
+// emitWord writes a word of data (16 bits) to the segment, little endian
+// as the 6502 reads it.
 func (seg *segment) emitWord(w int64) {
-	seg.code[seg.lc] = byte(w >> 8)
-	seg.code[seg.lc+1] = byte(w & 255)
+	if !seg.fitsCode(2) {
+		return
+	}
+	seg.code[seg.lc] = byte(w & 255)
+	seg.code[seg.lc+1] = byte(w >> 8)
 	seg.lc += 2
 	if seg.lc > seg.size {
 		seg.size = seg.lc
 	}
 }
 
-// emitDWord writes a double word (32 bits) of data to the segment, big endian.
+// emitDWord writes a double word (32 bits) of data to the segment, little endian.
 func (seg *segment) emitDWord(dw int64) {
-	seg.code[seg.lc] = byte(dw >> 24)
-	seg.code[seg.lc+1] = byte(dw >> 16)
-	seg.code[seg.lc+2] = byte(dw >> 8)
-	seg.code[seg.lc+3] = byte(dw & 255)
+	if !seg.fitsCode(4) {
+		return
+	}
+	seg.code[seg.lc] = byte(dw & 255)
+	seg.code[seg.lc+1] = byte(dw >> 8)
+	seg.code[seg.lc+2] = byte(dw >> 16)
+	seg.code[seg.lc+3] = byte(dw >> 24)
 	seg.lc += 4
 	if seg.lc > seg.size {
 		seg.size = seg.lc
 	}
 }
+
+// reserve advances the location counter by n bytes without writing any
+// data to the segment.
+func (seg *segment) reserve(n int) {
+	seg.lc += n
+	if seg.lc > seg.size {
+		seg.size = seg.lc
+	}
+}
+
+// fits returns true if n more bytes fit in the segment.
+func (seg *segment) fits(n int) bool {
+	return n >= 0 && seg.lc+n <= len(seg.code)
+}
+
+// fitsCode returns true if n more bytes of code fit in the segment, and
+// marks the segment as overflowed if they do not.
+func (seg *segment) fitsCode(n int) bool {
+	if !seg.fits(n) {
+		seg.overflow = true
+		return false
+	}
+	return true
+}
+
+// startBlock starts a new block of code at addr in an absolute segment.
+func (seg *segment) startBlock(addr int) {
+	if seg.lc > seg.start {
+		seg.blocks = append(seg.blocks, [2]int{seg.start, seg.lc})
+	}
+	seg.start = addr
+	seg.lc = addr
+}
+
+// sortedBlocks returns the start and end addresses of the blocks of code
+// in an absolute segment, sorted by their start.
+func (seg *segment) sortedBlocks() [][2]int {
+	blocks := append([][2]int(nil), seg.blocks...)
+	if seg.lc > seg.start {
+		blocks = append(blocks, [2]int{seg.start, seg.lc})
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i][0] < blocks[j][0]
+	})
+	return blocks
+}
+
+// ranges returns the start and end addresses of the blocks of code in the
+// segment, sorted and merged where they touch. A relocatable segment is a
+// single block. Blocks that overlap are reported by checkBlocks.
+func (seg *segment) ranges() [][2]int {
+	if !seg.absolute {
+		return [][2]int{{0, seg.size}}
+	}
+	var ranges [][2]int
+	for _, b := range seg.sortedBlocks() {
+		if n := len(ranges); n > 0 && b[0] == ranges[n-1][1] {
+			ranges[n-1][1] = b[1]
+			continue
+		}
+		ranges = append(ranges, b)
+	}
+	if len(ranges) == 0 {
+		ranges = [][2]int{{seg.org, seg.org}}
+	}
+	return ranges
+}
@@ -28,12 +28,12 @@ func TestEmitWord(t *testing.T) {
 		want1 byte
 		want2 byte
 	}{
-		{1, 0, 1},
-		{2, 0, 2},
-		{255, 0, 255},
+		{1, 1, 0},
+		{2, 2, 0},
+		{255, 255, 0},
 		{-1, 255, 255},
-		{-2, 255, 254},
-		{1000, 3, 0xe8},
+		{-2, 254, 255},
+		{1000, 0xe8, 3},
 	} {
 		seg := newSegment()
 		seg.emitWord(tc.n)
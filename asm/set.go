@@ -0,0 +1,73 @@
+package asm
+
+type tokSet struct{}
+
+// isAssignment returns true if the token assigns a value to a variable.
+func isAssignment(tok token) bool {
+	switch tok.(type) {
+	case *tokSet, *tokEquals:
+		return true
+	}
+	return false
+}
+
+// defineVariable defines a symbol that can be given a new value at any
+// time, or returns the existing one.
+func (ctx *context) defineVariable(id string) (*localSymbol, error) {
+	if sym, ok := ctx.seg.symbols[id]; ok {
+		if v, ok := sym.(*localSymbol); ok && v.variable {
+			return v, nil
+		}
+		ctx.error("%s is already defined and is not a variable", id)
+		return nil, parseError
+	}
+	v := &localSymbol{id: id, variable: true}
+	ctx.seg.symbols.register(id, v)
+	return v, nil
+}
+
+// forgetVariables removes all variables from the symbol table. Variables
+// only get a value when the assembler passes their assignment, so in every
+// pass a use of a variable sees the value that was current on that line.
+func (ctx *context) forgetVariables() {
+	for id, sym := range ctx.seg.symbols {
+		if v, ok := sym.(*localSymbol); ok && v.variable {
+			delete(ctx.seg.symbols, id)
+		}
+	}
+}
+
+// assembleSet assembles an assignment to a variable: NAME set EXPR or
+// NAME = EXPR.
+func assembleSet(ctx *context, label *localSymbol) error {
+	if label == nil {
+		ctx.error("assignment without a variable")
+		return parseError
+	}
+	val := ctx.expr()
+	if val.sym != nil {
+		ctx.error("assigning an external value to a variable is not allowed")
+		return parseError
+	}
+	if val.seg != nil && val.part != partAll {
+		ctx.error("assigning a byte of a relocatable value to a variable is not allowed")
+		return parseError
+	}
+	label.value = val.val
+	label.seg = val.seg
+	return nil
+}
+
+// assemble assembles a set instruction.
+func (*tokSet) assemble(ctx *context, label *localSymbol) error {
+	return assembleSet(ctx, label)
+}
+
+// assemble assembles an assignment with =.
+func (*tokEquals) assemble(ctx *context, label *localSymbol) error {
+	return assembleSet(ctx, label)
+}
+
+func init() {
+	metaMap["set"] = &tokSet{}
+}
@@ -0,0 +1,53 @@
+package asm
+
+import "testing"
+
+func TestSet(t *testing.T) {
+	for _, tc := range []struct {
+		str        string
+		wantErrors int
+		wantBytes  []byte
+	}{
+		{"n set 1\ndb n", 0, []byte{1}},
+		{"n = 1\ndb n\nn = n+1\ndb n", 0, []byte{1, 2}},
+		{"n set 1\ndb n\nn set 5\ndb n\nn set n*2\ndb n", 0, []byte{1, 5, 10}},
+		{"n set 0\nred equ n\nn set n+1\ngreen equ n\nn set n+1\nblue equ n\ndb red, green, blue", 0, []byte{0, 1, 2}},
+		{"n set 0\nrept 3\nn set n+2\ndb n\nendr", 0, []byte{2, 4, 6}},
+		{"db n\nn set 1", 1, []byte{}},
+		{"l db 1\nl set 2", 1, []byte{}},
+		{"n set 1\nn db 2", 1, []byte{}},
+		{"set 1", 1, []byte{}},
+		{"= 1", 1, []byte{}},
+		{"extern foo\nn set foo", 1, []byte{}},
+		{"n set 1\nglobal n", 1, []byte{}},
+	} {
+		println(tc.str)
+		ctx := assembleString(tc.str)
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+		if tc.wantErrors != 0 {
+			continue
+		}
+		if ctx.seg.size != len(tc.wantBytes) {
+			t.Errorf("ctx.seg.size; got:%d, want:%d", ctx.seg.size, len(tc.wantBytes))
+		}
+		for i, b := range tc.wantBytes {
+			if ctx.seg.code[i] != b {
+				t.Errorf("code[%d]; got:%d, want:%d", i, ctx.seg.code[i], b)
+			}
+		}
+	}
+}
+
+func TestSetPass2Value(t *testing.T) {
+	// In pass 2 label must get the value n has on its line, not the
+	// value n had at the end of pass 1.
+	ctx := assembleString("n set 1\nlabel equ n\nn set 2\ndb label, n")
+	if ctx.errors != 0 {
+		t.Fatalf("assemble() errors; got:%d, want:0", ctx.errors)
+	}
+	if ctx.seg.code[0] != 1 || ctx.seg.code[1] != 2 {
+		t.Errorf("code; got:%d,%d, want:1,2", ctx.seg.code[0], ctx.seg.code[1])
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"unicode"
 )
 
 type source struct {
@@ -83,3 +84,34 @@ func (s *source) moveToNextLine() {
 		s.curLine = []rune(s.lines[s.lineNo-1])
 	}
 }
+
+// rewind moves back to before the first line of the input, so that the
+// source can be read again.
+func (s *source) rewind() {
+	s.lineNo = 0
+	s.curLine = nil
+	s.curPos = 0
+	s.nextChar = 0
+}
+
+// seek moves to the start of line lineNo.
+func (s *source) seek(lineNo int) {
+	s.lineNo = lineNo - 1
+	s.moveToNextLine()
+}
+
+// column returns the column of the next character on the line that is not
+// a space.
+func (s *source) column() int {
+	if s.lineNo == 0 {
+		s.moveToNextLine()
+	}
+	pos := s.curPos
+	if s.nextChar != 0 && s.nextChar != '\n' {
+		pos--
+	}
+	for pos <= len(s.curLine) && unicode.IsSpace(s.curLine[pos-1]) {
+		pos++
+	}
+	return pos
+}
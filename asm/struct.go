@@ -0,0 +1,319 @@
+package asm
+
+type tokStruct struct{}
+type tokEndstruct struct{}
+type tokEnum struct{}
+type tokEndenum struct{}
+type tokDstruct struct{}
+type tokSizeof struct{}
+
+// Kinds of struct fields.
+const (
+	fieldByte = iota
+	fieldWord
+	fieldDWord
+	fieldRes
+	fieldStruct
+)
+
+// structField is a member of a struct.
+type structField struct {
+	name   string
+	kind   int
+	offset int
+	size   int
+	typ    *structDef // The type of a nested struct.
+}
+
+// structDef is the definition of a struct.
+type structDef struct {
+	name   string
+	fields []*structField
+	size   int
+}
+
+// keyword returns the keyword that ends a struct block.
+func (*tokEndstruct) keyword() string {
+	return "endstruct"
+}
+
+// keyword returns the keyword that ends an enum block.
+func (*tokEndenum) keyword() string {
+	return "endenum"
+}
+
+// defineMembers defines the symbols for the members of a struct, prefixed
+// with prefix and with offsets relative to base.
+func (ctx *context) defineMembers(prefix string, def *structDef, base int) {
+	for _, f := range def.fields {
+		ctx.defineConstant(prefix+"."+f.name, int64(base+f.offset))
+		if f.typ != nil {
+			ctx.defineMembers(prefix+"."+f.name, f.typ, base+f.offset)
+		}
+	}
+}
+
+// memberName returns the name of a struct or enum member. Register names
+// are allowed, because they make perfectly good member names.
+func memberName(tok token) (string, bool) {
+	switch tt := tok.(type) {
+	case *tokIdentifier:
+		return tt.id, true
+	case *tokRegisterA:
+		return "a", true
+	case *tokRegisterX:
+		return "x", true
+	case *tokRegisterY:
+		return "y", true
+	}
+	return "", false
+}
+
+// parseField parses the type of a struct field and returns the field.
+func (ctx *context) parseField(name string) (*structField, error) {
+	tok := ctx.lexer.getToken()
+	switch tt := tok.(type) {
+	case *tokRes:
+		n, err := ctx.constExpr()
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			ctx.error("negative size: %d", n)
+			return nil, parseError
+		}
+		return &structField{name: name, kind: fieldRes, size: int(n)}, nil
+	case *tokIdentifier:
+		switch tt.id {
+		case "byte":
+			return &structField{name: name, kind: fieldByte, size: 1}, nil
+		case "word":
+			return &structField{name: name, kind: fieldWord, size: 2}, nil
+		case "dword":
+			return &structField{name: name, kind: fieldDWord, size: 4}, nil
+		}
+		if def, ok := ctx.structs[tt.id]; ok {
+			return &structField{name: name, kind: fieldStruct, size: def.size, typ: def}, nil
+		}
+		ctx.error("unknown field type: %s", tt.id)
+		return nil, parseError
+	}
+	ctx.error("expected field type, not '%T(%v)'", tok, tok)
+	return nil, parseError
+}
+
+// blockLines calls f for every line of a struct or enum block, until
+// the line with the token that ends it. f is called with the first token
+// on the line and needs to consume the rest of it, but not the newline.
+func (ctx *context) blockLines(ender string, f func(tok token) error) error {
+	if tok := ctx.lexer.getToken(); !isNewLine(tok) {
+		ctx.error("expected end-of-line, not: '%T(%v)'", tok, tok)
+		return parseError
+	}
+	for {
+		ctx.lexer.moveToNextLine()
+		tok := ctx.lexer.getToken()
+		switch tok.(type) {
+		case *tokNewLine:
+			continue
+		case *tokEOF, blockEnder:
+			return ctx.endBlock(tok, ender)
+		}
+		if ctx.lexError(tok) {
+			continue
+		}
+		if err := f(tok); err != nil {
+			continue
+		}
+		if tok := ctx.lexer.getToken(); !isNewLine(tok) {
+			ctx.error("expected end-of-line, not: '%T(%v)'", tok, tok)
+		}
+	}
+}
+
+// assemble assembles a struct definition: struct NAME, followed by lines
+// with a member name and a type (byte, word, dword, res N or the name of
+// another struct), and ended by endstruct.
+func (*tokStruct) assemble(ctx *context, _label *localSymbol) error {
+	tok, ok := ctx.expect(func(t token) bool {
+		_, ok := t.(*tokIdentifier)
+		return ok
+	}, "struct name")
+	if !ok {
+		return parseError
+	}
+	def := &structDef{name: tok.(*tokIdentifier).id}
+	names := make(map[string]bool)
+	err := ctx.blockLines("endstruct", func(tok token) error {
+		name, ok := memberName(tok)
+		if !ok {
+			ctx.error("expected field name, not '%T(%v)'", tok, tok)
+			return parseError
+		}
+		if names[name] {
+			ctx.error("duplicate field %s in struct %s", name, def.name)
+			return parseError
+		}
+		f, err := ctx.parseField(name)
+		if err != nil {
+			return err
+		}
+		names[f.name] = true
+		f.offset = def.size
+		def.size += f.size
+		def.fields = append(def.fields, f)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if ctx.structs == nil {
+		ctx.structs = make(map[string]*structDef)
+	}
+	if _, ok := ctx.structs[def.name]; ok && ctx.pass != 2 {
+		ctx.error("duplicate definition of struct %s", def.name)
+		return parseError
+	}
+	ctx.structs[def.name] = def
+	ctx.defineMembers(def.name, def, 0)
+	return nil
+}
+
+// assemble assembles an enum definition: enum [NAME], followed by lines
+// with a name and optionally = VALUE, and ended by endenum. Values that
+// are not given are one more than the previous one, starting at zero.
+// If the enum has a name, the symbols are defined as NAME.member.
+func (*tokEnum) assemble(ctx *context, _label *localSymbol) error {
+	prefix := ""
+	tok := ctx.lexer.getToken()
+	if id, ok := tok.(*tokIdentifier); ok {
+		prefix = id.id + "."
+	} else {
+		ctx.lexer.pushback(tok)
+	}
+	var next int64
+	return ctx.blockLines("endenum", func(tok token) error {
+		name, ok := memberName(tok)
+		if !ok {
+			ctx.error("expected enum member, not '%T(%v)'", tok, tok)
+			return parseError
+		}
+		tok = ctx.lexer.getToken()
+		if _, ok := tok.(*tokEquals); ok {
+			v, err := ctx.constExpr()
+			if err != nil {
+				return err
+			}
+			next = v
+		} else {
+			ctx.lexer.pushback(tok)
+		}
+		ctx.defineConstant(prefix+name, next)
+		next++
+		return nil
+	})
+}
+
+// emitField emits a primitive struct field with its initial value.
+func (ctx *context) emitField(f *structField, tok token, val *exprValue) {
+	switch f.kind {
+	case fieldByte:
+		ctx.seg.maybeAddReloc(val, 1)
+		ctx.seg.emit(val.val)
+	case fieldWord:
+		ctx.seg.maybeAddReloc(val, 2)
+		ctx.seg.emitWord(val.val)
+	case fieldDWord:
+		ctx.seg.maybeAddReloc(val, 4)
+		ctx.seg.emitDWord(val.val)
+	case fieldRes:
+		var b []byte
+		if s, ok := tok.(*tokString); ok {
+			b = []byte(s.s)
+			if len(b) > f.size {
+				ctx.error("string too long for field %s: %d > %d", f.name, len(b), f.size)
+				b = b[:f.size]
+			}
+		}
+		for i := 0; i < f.size; i++ {
+			if i < len(b) {
+				ctx.seg.emit(int64(b[i]))
+			} else if _, ok := tok.(*tokString); ok {
+				ctx.seg.emit(0)
+			} else {
+				ctx.seg.emit(val.val)
+			}
+		}
+	}
+}
+
+// primitiveFields returns the fields of a struct with all nested structs
+// replaced by their fields.
+func (def *structDef) primitiveFields() []*structField {
+	fields := make([]*structField, 0, len(def.fields))
+	for _, f := range def.fields {
+		if f.typ != nil {
+			fields = append(fields, f.typ.primitiveFields()...)
+		} else {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// assemble assembles a dstruct instruction: dstruct NAME[, value...]
+// This emits an instance of a struct, with the fields initialized with
+// the values in order. Nested structs are initialized field by field. A
+// res field takes a string or a value to fill it with. Fields without a
+// value are zero.
+func (*tokDstruct) assemble(ctx *context, _label *localSymbol) error {
+	tok, ok := ctx.expect(func(t token) bool {
+		_, ok := t.(*tokIdentifier)
+		return ok
+	}, "struct name")
+	if !ok {
+		return parseError
+	}
+	def, ok := ctx.structs[tok.(*tokIdentifier).id]
+	if !ok {
+		ctx.error("unknown struct: %s", tok.(*tokIdentifier).id)
+		return parseError
+	}
+	if !ctx.seg.fits(def.size) {
+		ctx.error("struct %s overflows the segment", def.name)
+		return parseError
+	}
+	fields := def.primitiveFields()
+	i := 0
+	for ; ; i++ {
+		next := ctx.lexer.getToken()
+		if _, ok := next.(*tokComma); !ok {
+			ctx.lexer.pushback(next)
+			break
+		}
+		if i == len(fields) {
+			ctx.error("too many values for struct %s", def.name)
+			return parseError
+		}
+		next = ctx.lexer.getToken()
+		if _, ok := next.(*tokString); ok && fields[i].kind == fieldRes {
+			ctx.emitField(fields[i], next, nil)
+			continue
+		}
+		ctx.lexer.pushback(next)
+		ctx.emitField(fields[i], nil, ctx.expr())
+	}
+	for ; i < len(fields); i++ {
+		ctx.emitField(fields[i], nil, &exprValue{})
+	}
+	return nil
+}
+
+func init() {
+	metaMap["struct"] = &tokStruct{}
+	metaMap["endstruct"] = &tokEndstruct{}
+	metaMap["enum"] = &tokEnum{}
+	metaMap["endenum"] = &tokEndenum{}
+	metaMap["dstruct"] = &tokDstruct{}
+	metaMap["sizeof"] = &tokSizeof{}
+}
@@ -0,0 +1,90 @@
+package asm
+
+import "testing"
+
+const testStructs = `struct vec
+x byte
+y byte
+endstruct
+struct actor
+pos vec
+speed word
+name res 4
+flags dword
+endstruct
+`
+
+func TestStruct(t *testing.T) {
+	for _, tc := range []struct {
+		str        string
+		wantErrors int
+		wantBytes  []byte
+	}{
+		{"db vec.x, vec.y, sizeof vec", 0, []byte{0, 1, 2}},
+		{"db actor.pos, actor.pos.y, actor.speed, actor.name, actor.flags, sizeof(actor)", 0, []byte{0, 1, 2, 4, 8, 12}},
+		{"lda #actor.speed\nldy #actor.pos.y", 0, []byte{0xa9, 2, 0xa0, 1}},
+		{"dstruct vec, 1, 2", 0, []byte{1, 2}},
+		{"dstruct vec, 1", 0, []byte{1, 0}},
+		{"dstruct vec", 0, []byte{0, 0}},
+		{"dstruct actor, 1, 2, 0x1234, \"ab\", 5", 0, []byte{1, 2, 0x34, 0x12, 'a', 'b', 0, 0, 5, 0, 0, 0}},
+		{"dstruct actor, 1, 2, 3, 0xff", 0, []byte{1, 2, 3, 0, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}},
+		{"t dstruct vec, 1, 2\ndstruct vec, 3, 4\ndb t+sizeof vec", 0, []byte{1, 2, 3, 4, 2}},
+		{"dstruct vec, 1, 2, 3", 1, []byte{}},
+		{"dstruct actor, 1, 2, 3, \"abcde\"", 1, []byte{}},
+		{"dstruct point", 1, []byte{}},
+		{"db sizeof point", 1, []byte{}},
+		{"struct vec\nz byte\nendstruct", 1, []byte{}},
+		{"struct s\na byte\na word\nendstruct", 1, []byte{}},
+		{"struct s\na long\nendstruct", 1, []byte{}},
+		{"struct s\na byte", 1, []byte{}},
+		{"endstruct", 1, []byte{}},
+		{"struct s\nbuf res later\nendstruct\nlater equ 2", 1, []byte{}},
+	} {
+		println(tc.str)
+		ctx := assembleString(testStructs + tc.str)
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+		if tc.wantErrors != 0 {
+			continue
+		}
+		if ctx.seg.size != len(tc.wantBytes) {
+			t.Errorf("ctx.seg.size; got:%d, want:%d", ctx.seg.size, len(tc.wantBytes))
+		}
+		for i, b := range tc.wantBytes {
+			if ctx.seg.code[i] != b {
+				t.Errorf("code[%d]; got:%d, want:%d", i, ctx.seg.code[i], b)
+			}
+		}
+	}
+}
+
+func TestEnum(t *testing.T) {
+	for _, tc := range []struct {
+		str        string
+		wantErrors int
+		wantBytes  []byte
+	}{
+		{"enum\nred\ngreen\nblue\nendenum\ndb red, green, blue", 0, []byte{0, 1, 2}},
+		{"enum color\nred\ngreen = 5\nblue\nendenum\ndb color.red, color.green, color.blue", 0, []byte{0, 5, 6}},
+		{"enum\n\nred ; comment\nendenum\ndb red", 0, []byte{0}},
+		{"enum\nred\nred\nendenum", 1, []byte{}},
+		{"enum\n1\nendenum", 1, []byte{}},
+		{"enum\nred = later\nendenum\nlater equ 1", 1, []byte{}},
+		{"enum\nred\nendstruct", 1, []byte{}},
+	} {
+		println(tc.str)
+		ctx := assembleString(tc.str)
+		if ctx.errors != tc.wantErrors {
+			t.Errorf("assemble() errors; got:%d, want:%d", ctx.errors, tc.wantErrors)
+		}
+		if tc.wantErrors != 0 {
+			continue
+		}
+		for i, b := range tc.wantBytes {
+			if ctx.seg.code[i] != b {
+				t.Errorf("code[%d]; got:%d, want:%d", i, ctx.seg.code[i], b)
+			}
+		}
+	}
+}
@@ -13,12 +13,17 @@ type localSymbol struct {
 	id string
 	value int64
 	global bool // Should this symbol be exported?
+	weak bool // Can the export be overridden by another module?
+	variable bool // May this symbol be redefined (e.g. a loop variable)?
+	seg *segment // The segment a label is relative to, nil for constants.
+	lineNo int // The line that defines the symbol.
 }
 
 // externSymbol is a symbol that is defined in another segment
 // and the linker should resolve any uses.
 type externSymbol struct {
 	id string
+	zeroPage bool // Is this symbol known to be in the zero page?
 }
 
 // register registers a new symbol in the symbol table. Returns false
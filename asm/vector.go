@@ -0,0 +1,66 @@
+package asm
+
+import "v65/obj"
+
+type tokInitad struct{}
+type tokRunad struct{}
+
+// vector is an address for the loader, defined at lc in seg.
+type vector struct {
+	kind int
+	val  *exprValue
+	seg  *segment
+	lc   int
+}
+
+// assembleVector assembles the address of a vector of a kind.
+func assembleVector(ctx *context, kind int) error {
+	val := ctx.expr()
+	if val.part != partAll {
+		ctx.error("address of a vector cannot be a byte of a value")
+		return parseError
+	}
+	ctx.vectors = append(ctx.vectors, &vector{kind, val, ctx.seg, ctx.seg.lc})
+	return nil
+}
+
+// assemble assembles an initad instruction: initad ADDR
+// The loader calls the routine at ADDR as soon as the code before the
+// instruction is loaded, like INITAD on the Atari.
+func (*tokInitad) assemble(ctx *context, _label *localSymbol) error {
+	return assembleVector(ctx, obj.Init)
+}
+
+// assemble assembles a runad instruction: runad ADDR
+// The program starts at ADDR after it has been loaded, like RUNAD on the
+// Atari.
+func (*tokRunad) assemble(ctx *context, _label *localSymbol) error {
+	return assembleVector(ctx, obj.Run)
+}
+
+// objVectors converts the vectors for the object module.
+func (ctx *context) objVectors() []*obj.Vector {
+	var out []*obj.Vector
+	for _, v := range ctx.vectors {
+		vec := &obj.Vector{Kind: v.kind, Value: v.val.val}
+		if v.val.sym != nil {
+			vec.Symbol = v.val.sym.id
+		} else if v.val.seg != nil {
+			vec.Segment = v.val.seg.name
+		}
+		for i, r := range v.seg.ranges() {
+			if v.lc >= r[0] && v.lc <= r[1] {
+				vec.AtSegment = v.seg.pieceName(i, r)
+				vec.AtOffset = v.lc - r[0]
+				break
+			}
+		}
+		out = append(out, vec)
+	}
+	return out
+}
+
+func init() {
+	metaMap["initad"] = &tokInitad{}
+	metaMap["runad"] = &tokRunad{}
+}
@@ -0,0 +1,105 @@
+// Command ar65 bundles object modules into a library archive, or lists
+// the modules of an archive and the symbols they export.
+//
+// Modules are added to the archive, replacing modules with the same
+// name. If the archive does not exist yet, it is created. For example:
+//
+//	a65 -obj mul.o mul.s
+//	a65 -obj div.o div.s
+//	ar65 -o math.a mul.o div.o
+//	ar65 -t math.a
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"v65/archive"
+	"v65/obj"
+)
+
+// readArchive reads an archive, or returns an empty archive if the file
+// does not exist.
+func readArchive(name string) (*archive.Archive, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return &archive.Archive{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return archive.Read(f)
+}
+
+// readModule reads an object file.
+func readModule(name string) (*obj.Module, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return obj.Read(f)
+}
+
+// list prints the modules of an archive with the symbols they export.
+func list(name string) error {
+	ar, err := readArchive(name)
+	if err != nil {
+		return err
+	}
+	for _, mod := range ar.Modules {
+		fmt.Println(mod.Name)
+		for _, sym := range mod.Symbols {
+			fmt.Printf("\t%s\n", sym.Name)
+		}
+	}
+	return nil
+}
+
+// update adds object files to an archive.
+func update(name string, files []string) error {
+	ar, err := readArchive(name)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		mod, err := readModule(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		if err := ar.Add(mod); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := archive.Write(f, ar); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func main() {
+	out := flag.String("o", "", "add the object files to this archive")
+	toc := flag.String("t", "", "list the modules of this archive")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *toc != "":
+		err = list(*toc)
+	case *out != "":
+		err = update(*out, flag.Args())
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
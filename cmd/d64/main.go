@@ -0,0 +1,111 @@
+// Command d64 builds a D64 disk image from files, or lists the files on
+// a disk image.
+//
+// Every file argument is a path, optionally followed by =NAME to set the
+// name of the file on the disk, and by ,TYPE to set its type (prg, seq,
+// usr or del). The default name is the base name of the path without the
+// extension, and the default type is prg. For example:
+//
+//	d64 -o game.d64 -name "my game" -id 01 loader.prg game.bin=GAME,prg
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"v65/d64"
+)
+
+// parseFileArg parses a file argument: PATH[=NAME][,TYPE]
+func parseFileArg(arg string) (path, name string, typ d64.FileType, err error) {
+	typ = d64.PRG
+	if i := strings.LastIndex(arg, ","); i >= 0 {
+		t, ok := d64.FileTypes[strings.ToLower(arg[i+1:])]
+		if !ok {
+			return "", "", 0, fmt.Errorf("unknown file type: %s", arg[i+1:])
+		}
+		typ, arg = t, arg[:i]
+	}
+	path = arg
+	if i := strings.Index(arg, "="); i >= 0 {
+		path, name = arg[:i], arg[i+1:]
+	} else {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return path, name, typ, nil
+}
+
+// list prints the directory of a disk image.
+func list(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	d, err := d64.Read(data)
+	if err != nil {
+		return err
+	}
+	files, err := d.Files()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("0 %q %s\n", d.Name(), d.ID())
+	for _, f := range files {
+		typ := "???"
+		for name, t := range d64.FileTypes {
+			if t == f.Type {
+				typ = name
+			}
+		}
+		fmt.Printf("%-5d %-18q %s\n", (len(f.Data)+253)/254, f.Name, typ)
+	}
+	return nil
+}
+
+// build writes a disk image with the files.
+func build(out, name, id string, args []string) error {
+	d, err := d64.New(name, id)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		path, name, typ, err := parseFileArg(arg)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := d.AddFile(name, typ, data); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(out, d.Bytes(), 0666)
+}
+
+func main() {
+	out := flag.String("o", "", "write the disk image to this file")
+	name := flag.String("name", "", "name of the disk")
+	id := flag.String("id", "00", "ID of the disk, 2 characters")
+	listImage := flag.String("l", "", "list the files on this disk image")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *listImage != "":
+		err = list(*listImage)
+	case *out != "":
+		err = build(*out, *name, *id, flag.Args())
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "d64: %v\n", err)
+		os.Exit(1)
+	}
+}
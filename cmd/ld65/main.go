@@ -0,0 +1,176 @@
+// Command ld65 links object modules, o65 files and library archives into
+// a program.
+//
+// The modules of an archive are only linked if they export a symbol that
+// another linked module imports. The command reports which module was
+// linked for which symbol. With -r, the modules are linked into a single
+// object file for a later link, instead of a program, in the o65 format
+// with -f o65. For example:
+//
+//	ld65 -o game.prg -f prg -base 0x801 main.o sound.o math.a
+//	ld65 -C cart.cfg -map cart.map main.o math.a
+//	ld65 -r -o sound.o player.o effects.o
+//	ld65 -r -f o65 -o sound.o65 player.o effects.o
+//
+// With -reloc, a routine that moves the program to another page is added
+// after the program, together with its relocation table. The routine is
+// called with the new page in A.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"v65/archive"
+	"v65/driver"
+	"v65/link"
+	"v65/o65"
+	"v65/obj"
+	"v65/output"
+)
+
+// readInputs reads object files, o65 files and archives.
+func readInputs(names []string) ([]*obj.Module, []*archive.Archive, error) {
+	var mods []*obj.Module
+	var libs []*archive.Archive
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if lib, err := archive.Read(bytes.NewReader(data)); err == nil {
+			libs = append(libs, lib)
+			continue
+		}
+		read := obj.Read
+		if bytes.HasPrefix(data, o65.Magic) {
+			read = o65.Read
+		}
+		mod, err := read(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		mods = append(mods, mod)
+	}
+	return mods, libs, nil
+}
+
+func main() {
+	base := flag.Int("base", 0, "address of the first relocatable segment, without a configuration")
+	config := flag.String("C", "", "place the segments with this linker configuration, and write the memory areas to their files")
+	out := flag.String("o", "", "write the program to this file")
+	format := flag.String("f", "bin", "format of the output: "+strings.Join(output.FormatNames(), ", "))
+	fill := flag.Int("fill", 0, "value of the unused bytes in a raw binary")
+	name := flag.String("name", "PROGRAM", "name of the program in a disk image")
+	mapFile := flag.String("map", "", "write the map of the linked program to this file")
+	mapFormat := flag.String("mapfmt", "text", "format of the map: text or json")
+	gc := flag.Bool("gc", false, "drop the sections that are not used")
+	entries := flag.String("entry", "", "comma-separated symbols whose sections are used, with -gc")
+	relocating := flag.Bool("reloc", false, "add a routine that moves the program to the page in A, without a configuration")
+	partial := flag.Bool("r", false, "link the modules into an object file with the name of -o, for a later link, in the o65 format with -f o65")
+	flag.Parse()
+
+	writeOutput, ok := output.Formats[*format]
+	if !ok && !*partial {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s\n", *format)
+		os.Exit(2)
+	}
+	if _, ok := driver.MapFormats[*mapFormat]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown map format: %s\n", *mapFormat)
+		os.Exit(2)
+	}
+	if *relocating && *config != "" {
+		fmt.Fprintln(os.Stderr, "-reloc cannot be used with a configuration")
+		os.Exit(2)
+	}
+	var cfg *link.Config
+	if *config != "" {
+		var err error
+		if cfg, err = driver.ReadConfig(*config); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot read configuration: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	mods, libs, err := readInputs(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	mods, pulls := link.Select(mods, libs)
+	for _, p := range pulls {
+		fmt.Printf("%s: %s satisfied by %s\n", p.By, p.Symbol, p.Module)
+	}
+	if *gc {
+		mods = driver.Strip(os.Stdout, mods, *entries)
+	}
+	if *partial {
+		if *out == "" {
+			fmt.Fprintln(os.Stderr, "-r needs an output file")
+			os.Exit(2)
+		}
+		mod, err := link.Partial(mods, *out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "link error: %v\n", err)
+			os.Exit(1)
+		}
+		writeObj := obj.Write
+		if *format == "o65" {
+			writeObj = o65.Write
+		}
+		if err := driver.WriteFile(*out, func(w io.Writer) error { return writeObj(w, mod) }); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot write object: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	var img *link.Image
+	if cfg != nil {
+		img, err = link.LinkConfig(mods, cfg)
+	} else {
+		img, err = link.Link(mods, *base)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "link error: %v\n", err)
+		os.Exit(1)
+	}
+
+	status := 0
+	opts := output.Options{
+		Fill:       byte(*fill),
+		Vectors:    img.Vectors,
+		Attributes: img.Attributes,
+		Name:       *name,
+	}
+	blocks := output.FromImage(img)
+	if *relocating {
+		var entry int
+		if blocks, entry, err = output.Relocatable(img); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot relocate: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Relocator at $%04x.\n", entry)
+	}
+	if *out != "" {
+		if err := driver.WriteFile(*out, func(w io.Writer) error { return writeOutput(w, blocks, opts) }); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot write output: %v\n", err)
+			status = 1
+		}
+	}
+	if cfg != nil {
+		if err := driver.WriteAreas(img, cfg, writeOutput, opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+	if *mapFile != "" {
+		if err := driver.WriteMap(*mapFile, *mapFormat, img, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot write map: %v\n", err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,375 @@
+// Package d64 writes and reads D64 disk images of a 35 track Commodore
+// 1541 disk.
+package d64
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Size is the size of a D64 image in bytes.
+const Size = 174848
+
+const (
+	tracks       = 35
+	sectorSize   = 256
+	dirTrack     = 18
+	dataPerBlock = sectorSize - 2 // Bytes of data in a sector of a file.
+	entrySize    = 32             // Size of a directory entry.
+	nameSize     = 16
+	padding      = 0xa0 // Pads names on the disk.
+
+	// Sectors between consecutive sectors of a file or the directory,
+	// so that the drive does not have to wait a full revolution.
+	dataInterleave = 10
+	dirInterleave  = 3
+)
+
+// FileType is the type of a file in the directory.
+type FileType byte
+
+// File types. Files on the disk are closed, so bit 7 is set.
+const (
+	DEL FileType = 0x80
+	SEQ FileType = 0x81
+	PRG FileType = 0x82
+	USR FileType = 0x83
+)
+
+// FileTypes are the file types that can be written, by name.
+var FileTypes = map[string]FileType{
+	"del": DEL,
+	"seq": SEQ,
+	"prg": PRG,
+	"usr": USR,
+}
+
+// File is a file on the disk.
+type File struct {
+	Name string
+	Type FileType
+	Data []byte
+}
+
+// Disk is a disk image.
+type Disk struct {
+	data []byte
+}
+
+// sectors returns the number of sectors of a track.
+func sectors(track int) int {
+	switch {
+	case track <= 17:
+		return 21
+	case track <= 24:
+		return 19
+	case track <= 30:
+		return 18
+	}
+	return 17
+}
+
+// sector returns the contents of a sector.
+func (d *Disk) sector(track, sec int) []byte {
+	offset := 0
+	for t := 1; t < track; t++ {
+		offset += sectors(t) * sectorSize
+	}
+	offset += sec * sectorSize
+	return d.data[offset : offset+sectorSize]
+}
+
+// bam returns the block availability map, which also holds the disk name.
+func (d *Disk) bam() []byte {
+	return d.sector(dirTrack, 0)
+}
+
+// isFree returns true if a sector is not in use.
+func (d *Disk) isFree(track, sec int) bool {
+	entry := d.bam()[4*track:]
+	return entry[1+sec/8]&(1<<uint(sec%8)) != 0
+}
+
+// allocate marks a sector as used.
+func (d *Disk) allocate(track, sec int) {
+	entry := d.bam()[4*track:]
+	entry[1+sec/8] &^= 1 << uint(sec%8)
+	entry[0]--
+}
+
+// free returns the number of free sectors of a track.
+func (d *Disk) free(track int) int {
+	return int(d.bam()[4*track])
+}
+
+// nextSector allocates a free sector on a track, at or after the sector
+// that is interleave sectors after sec. It returns false if the track is
+// full.
+func (d *Disk) nextSector(track, sec, interleave int) (int, bool) {
+	n := sectors(track)
+	for i := 0; i < n; i++ {
+		s := (sec + interleave + i) % n
+		if d.isFree(track, s) {
+			d.allocate(track, s)
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// pad returns s in PETSCII, padded to n bytes.
+func pad(s string, n int) []byte {
+	b := bytes.Repeat([]byte{padding}, n)
+	copy(b, strings.ToUpper(s))
+	return b
+}
+
+// New creates an empty, formatted disk with a name and an ID of two
+// characters.
+func New(name, id string) (*Disk, error) {
+	if len(name) > nameSize {
+		return nil, fmt.Errorf("disk name too long: %s", name)
+	}
+	if len(id) != 2 {
+		return nil, fmt.Errorf("disk ID must have 2 characters: %q", id)
+	}
+	d := &Disk{data: make([]byte, Size)}
+	bam := d.bam()
+	bam[0], bam[1] = dirTrack, 1
+	bam[2] = 'A' // DOS version.
+	for t := 1; t <= tracks; t++ {
+		n := sectors(t)
+		bam[4*t] = byte(n)
+		for s := 0; s < n; s++ {
+			bam[4*t+1+s/8] |= 1 << uint(s%8)
+		}
+	}
+	copy(bam[0x90:], pad(name, nameSize))
+	copy(bam[0xa0:], []byte{padding, padding})
+	copy(bam[0xa2:], strings.ToUpper(id))
+	copy(bam[0xa4:], []byte{padding, '2', 'A', padding, padding, padding, padding})
+	d.allocate(dirTrack, 0)
+	d.allocate(dirTrack, 1)
+	d.sector(dirTrack, 1)[1] = 0xff
+	return d, nil
+}
+
+// Read reads a disk image.
+func Read(data []byte) (*Disk, error) {
+	if len(data) != Size {
+		return nil, fmt.Errorf("not a 35 track D64 image: size %d", len(data))
+	}
+	return &Disk{data: append([]byte(nil), data...)}, nil
+}
+
+// Bytes returns the disk image.
+func (d *Disk) Bytes() []byte {
+	return d.data
+}
+
+// Name returns the name of the disk.
+func (d *Disk) Name() string {
+	return string(bytes.TrimRight(d.bam()[0x90:0x90+nameSize], string([]byte{padding})))
+}
+
+// ID returns the ID of the disk.
+func (d *Disk) ID() string {
+	return string(d.bam()[0xa2:0xa4])
+}
+
+// dirEntries calls f with every directory entry, used or not, until f
+// returns false.
+func (d *Disk) dirEntries(f func(entry []byte) bool) error {
+	track, sec := dirTrack, 1
+	for seen := 0; track != 0; seen++ {
+		if track != dirTrack || sec >= sectors(dirTrack) || seen == sectors(dirTrack) {
+			return fmt.Errorf("corrupt directory")
+		}
+		data := d.sector(track, sec)
+		for i := 0; i < sectorSize; i += entrySize {
+			if !f(data[i : i+entrySize]) {
+				return nil
+			}
+		}
+		track, sec = int(data[0]), int(data[1])
+	}
+	return nil
+}
+
+// dirEntry returns a free directory entry, adding a sector to the
+// directory if it is full.
+func (d *Disk) dirEntry() ([]byte, error) {
+	var free []byte
+	err := d.dirEntries(func(entry []byte) bool {
+		if entry[2] == 0 {
+			free = entry
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if free != nil {
+		return free, nil
+	}
+	// Add a sector to the end of the directory.
+	last := 1
+	for next := d.sector(dirTrack, 1); next[0] != 0; next = d.sector(dirTrack, last) {
+		last = int(next[1])
+	}
+	sec, ok := d.nextSector(dirTrack, last, dirInterleave)
+	if !ok {
+		return nil, fmt.Errorf("directory full")
+	}
+	prev := d.sector(dirTrack, last)
+	prev[0], prev[1] = dirTrack, byte(sec)
+	data := d.sector(dirTrack, sec)
+	data[1] = 0xff
+	return data[:entrySize], nil
+}
+
+// dataTracks returns the tracks for files in the order in which they are
+// used: moving away from the directory track, alternating between the
+// tracks below and above it.
+func dataTracks() []int {
+	var order []int
+	for dist := 1; dist < tracks; dist++ {
+		if t := dirTrack - dist; t >= 1 {
+			order = append(order, t)
+		}
+		if t := dirTrack + dist; t <= tracks {
+			order = append(order, t)
+		}
+	}
+	return order
+}
+
+// freeBlocks returns the number of free sectors outside the directory track.
+func (d *Disk) freeBlocks() int {
+	n := 0
+	for _, t := range dataTracks() {
+		n += d.free(t)
+	}
+	return n
+}
+
+// AddFile writes a file to the disk and adds it to the directory.
+func (d *Disk) AddFile(name string, typ FileType, data []byte) error {
+	if len(name) > nameSize {
+		return fmt.Errorf("file name too long: %s", name)
+	}
+	if _, err := d.findFile(name); err == nil {
+		return fmt.Errorf("file exists: %s", name)
+	}
+	blocks := (len(data) + dataPerBlock - 1) / dataPerBlock
+	if blocks == 0 {
+		blocks = 1
+	}
+	if blocks > d.freeBlocks() {
+		return fmt.Errorf("disk full: %s needs %d blocks, %d free", name, blocks, d.freeBlocks())
+	}
+	entry, err := d.dirEntry()
+	if err != nil {
+		return err
+	}
+
+	// Write the chain of sectors.
+	order := dataTracks()
+	ti, sec := 0, -dataInterleave
+	var prev []byte
+	var first [2]byte
+	for i := 0; i < blocks; i++ {
+		for d.free(order[ti]) == 0 {
+			ti++
+			sec = -dataInterleave
+		}
+		track := order[ti]
+		sec, _ = d.nextSector(track, sec, dataInterleave)
+		if prev == nil {
+			first = [2]byte{byte(track), byte(sec)}
+		} else {
+			prev[0], prev[1] = byte(track), byte(sec)
+		}
+		prev = d.sector(track, sec)
+		n := copy(prev[2:], data[i*dataPerBlock:])
+		prev[0], prev[1] = 0, byte(n+1)
+	}
+
+	entry[2] = byte(typ)
+	entry[3], entry[4] = first[0], first[1]
+	copy(entry[5:], pad(name, nameSize))
+	entry[30], entry[31] = byte(blocks), byte(blocks>>8)
+	return nil
+}
+
+// Files returns the files in the directory.
+func (d *Disk) Files() ([]*File, error) {
+	var files []*File
+	var err error
+	dirErr := d.dirEntries(func(entry []byte) bool {
+		if entry[2] == 0 {
+			return true
+		}
+		var f *File
+		if f, err = d.readFile(entry); err != nil {
+			return false
+		}
+		files = append(files, f)
+		return true
+	})
+	if err == nil {
+		err = dirErr
+	}
+	return files, err
+}
+
+// findFile returns the file with the given name.
+func (d *Disk) findFile(name string) (*File, error) {
+	files, err := d.Files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Name == strings.ToUpper(name) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("file not found: %s", name)
+}
+
+// ReadFile returns the contents of the file with the given name.
+func (d *Disk) ReadFile(name string) ([]byte, error) {
+	f, err := d.findFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.Data, nil
+}
+
+// readFile reads the file of a directory entry by following the chain of
+// its sectors.
+func (d *Disk) readFile(entry []byte) (*File, error) {
+	f := &File{
+		Name: string(bytes.TrimRight(entry[5:5+nameSize], string([]byte{padding}))),
+		Type: FileType(entry[2]),
+	}
+	track, sec := int(entry[3]), int(entry[4])
+	for n := 0; track != 0; n++ {
+		if track > tracks || sec >= sectors(track) || n == Size/sectorSize {
+			return nil, fmt.Errorf("%s: invalid sector %d/%d", f.Name, track, sec)
+		}
+		data := d.sector(track, sec)
+		if data[0] == 0 {
+			if data[1] < 1 {
+				return nil, fmt.Errorf("%s: invalid size of last sector", f.Name)
+			}
+			f.Data = append(f.Data, data[2:int(data[1])+1]...)
+		} else {
+			f.Data = append(f.Data, data[2:]...)
+		}
+		track, sec = int(data[0]), int(data[1])
+	}
+	return f, nil
+}
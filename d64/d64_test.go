@@ -0,0 +1,114 @@
+package d64
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// testData returns n bytes of test data.
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + n)
+	}
+	return data
+}
+
+func TestWriteRead(t *testing.T) {
+	d, err := New("test disk", "v6")
+	if err != nil {
+		t.Fatalf("New(); got:%v, want:nil", err)
+	}
+	files := []*File{
+		{"EMPTY", SEQ, []byte{}},
+		{"ONE BLOCK", PRG, testData(254)},
+		{"TWO BLOCKS", PRG, testData(255)},
+		{"LARGE", USR, testData(20000)},
+	}
+	for i := 0; i < 10; i++ {
+		// Enough files to need a second directory sector.
+		files = append(files, &File{fmt.Sprintf("FILE%d", i), PRG, testData(i * 100)})
+	}
+	for _, f := range files {
+		if err := d.AddFile(f.Name, f.Type, f.Data); err != nil {
+			t.Fatalf("AddFile(%s); got:%v, want:nil", f.Name, err)
+		}
+	}
+	if len(d.Bytes()) != Size {
+		t.Fatalf("len(d.Bytes()); got:%d, want:%d", len(d.Bytes()), Size)
+	}
+	d, err = Read(d.Bytes())
+	if err != nil {
+		t.Fatalf("Read(); got:%v, want:nil", err)
+	}
+	if d.Name() != "TEST DISK" || d.ID() != "V6" {
+		t.Errorf("name and ID; got:%s/%s, want:TEST DISK/V6", d.Name(), d.ID())
+	}
+	got, err := d.Files()
+	if err != nil {
+		t.Fatalf("Files(); got:%v, want:nil", err)
+	}
+	if len(got) != len(files) {
+		t.Fatalf("len(Files()); got:%d, want:%d", len(got), len(files))
+	}
+	for i, f := range files {
+		if got[i].Name != f.Name || got[i].Type != f.Type || !bytes.Equal(got[i].Data, f.Data) {
+			t.Errorf("file %d; got:%s/%x (%d bytes), want:%s/%x (%d bytes)", i, got[i].Name, got[i].Type, len(got[i].Data), f.Name, f.Type, len(f.Data))
+		}
+	}
+	if data, err := d.ReadFile("large"); err != nil || !bytes.Equal(data, files[3].Data) {
+		t.Errorf("ReadFile(large); got:%d bytes/%v, want:%d bytes/nil", len(data), err, len(files[3].Data))
+	}
+}
+
+func TestLayout(t *testing.T) {
+	d, _ := New("layout", "01")
+	if err := d.AddFile("prog", PRG, testData(600)); err != nil {
+		t.Fatalf("AddFile(); got:%v, want:nil", err)
+	}
+	entry := d.sector(dirTrack, 1)
+	if entry[2] != byte(PRG) || entry[3] != 17 || entry[4] != 0 || entry[30] != 3 {
+		t.Errorf("directory entry; got:% x, want:prg at 17/0 with 3 blocks", entry[:32])
+	}
+	// The sectors of the file are 10 apart.
+	track, sec := int(entry[3]), int(entry[4])
+	for _, want := range [][2]int{{17, 10}, {17, 20}, {0, 600 - 2*254 + 1}} {
+		data := d.sector(track, sec)
+		track, sec = int(data[0]), int(data[1])
+		if track != want[0] || sec != want[1] {
+			t.Errorf("link; got:%d/%d, want:%d/%d", track, sec, want[0], want[1])
+		}
+	}
+	if free := d.free(17); free != 18 {
+		t.Errorf("free sectors on track 17; got:%d, want:18", free)
+	}
+	if free := d.free(dirTrack); free != 17 {
+		t.Errorf("free sectors on track 18; got:%d, want:17", free)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := New("a name that is too long", "01"); err == nil {
+		t.Errorf("New() with long name; got:nil, want:error")
+	}
+	if _, err := New("disk", "1"); err == nil {
+		t.Errorf("New() with short ID; got:nil, want:error")
+	}
+	if _, err := Read(make([]byte, 100)); err == nil {
+		t.Errorf("Read() of short image; got:nil, want:error")
+	}
+	d, _ := New("disk", "01")
+	if err := d.AddFile("big", PRG, testData(665*254)); err == nil {
+		t.Errorf("AddFile() of too large file; got:nil, want:error")
+	}
+	if err := d.AddFile("a", PRG, testData(10)); err != nil {
+		t.Fatalf("AddFile(a); got:%v, want:nil", err)
+	}
+	if err := d.AddFile("a", PRG, testData(10)); err == nil {
+		t.Errorf("AddFile() of existing file; got:nil, want:error")
+	}
+	if _, err := d.ReadFile("b"); err == nil {
+		t.Errorf("ReadFile() of missing file; got:nil, want:error")
+	}
+}
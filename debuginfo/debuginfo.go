@@ -0,0 +1,114 @@
+// Package debuginfo reads and writes debug information files, which map
+// the addresses of assembled code and data back to the source.
+//
+// A debug information file is a text file. The first line is the header
+//
+//	v65-debug 1
+//
+// Every other line describes a range of bytes with the fields
+//
+//	ADDR SIZE LINE COLUMN SCOPE FILE
+//
+// separated by spaces. ADDR is the hexadecimal address of the first byte,
+// prefixed with $. SIZE, LINE and COLUMN are decimal, and LINE and COLUMN
+// start at 1. SCOPE is the label in effect at the line, or - if there is
+// none. FILE is the name of the source file as a double-quoted Go string.
+// The ranges are sorted by address.
+package debuginfo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"v65/obj"
+)
+
+// header is the first line of a debug information file.
+const header = "v65-debug 1"
+
+// Entry maps a range of addresses to a place in the source.
+type Entry struct {
+	Addr   int
+	Size   int
+	File   string
+	Line   int
+	Column int
+	Scope  string
+}
+
+// FromSegment returns the entries for a segment that is placed at addr.
+func FromSegment(seg *obj.Segment, addr int) []*Entry {
+	var entries []*Entry
+	for _, l := range seg.Lines {
+		entries = append(entries, &Entry{
+			Addr:   addr + l.Offset,
+			Size:   l.Size,
+			File:   l.File,
+			Line:   l.Line,
+			Column: l.Column,
+			Scope:  l.Scope,
+		})
+	}
+	return entries
+}
+
+// Write writes the entries, sorted by address.
+func Write(w io.Writer, entries []*Entry) error {
+	sorted := append([]*Entry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Addr < sorted[j].Addr
+	})
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, header)
+	for _, e := range sorted {
+		scope := e.Scope
+		if scope == "" {
+			scope = "-"
+		}
+		fmt.Fprintf(bw, "$%04x %d %d %d %s %s\n", e.Addr, e.Size, e.Line, e.Column, scope, strconv.Quote(e.File))
+	}
+	return bw.Flush()
+}
+
+// Read reads a debug information file.
+func Read(r io.Reader) ([]*Entry, error) {
+	var entries []*Entry
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if lineNo == 1 {
+			if line != header {
+				return nil, fmt.Errorf("not a debug information file: %q", line)
+			}
+			continue
+		}
+		fields := strings.SplitN(line, " ", 6)
+		if len(fields) != 6 || !strings.HasPrefix(fields[0], "$") {
+			return nil, fmt.Errorf("line %d: invalid entry: %q", lineNo, line)
+		}
+		e := &Entry{Scope: fields[4]}
+		if e.Scope == "-" {
+			e.Scope = ""
+		}
+		addr, err := strconv.ParseInt(fields[0][1:], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address: %v", lineNo, err)
+		}
+		e.Addr = int(addr)
+		for i, p := range []*int{&e.Size, &e.Line, &e.Column} {
+			if *p, err = strconv.Atoi(fields[i+1]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid number: %v", lineNo, err)
+			}
+		}
+		if e.File, err = strconv.Unquote(fields[5]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid file name: %v", lineNo, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
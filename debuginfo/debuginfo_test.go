@@ -0,0 +1,47 @@
+package debuginfo
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"v65/obj"
+)
+
+func TestWriteRead(t *testing.T) {
+	seg := &obj.Segment{Lines: []*obj.Line{
+		{Offset: 3, Size: 2, File: "main s", Line: 4, Column: 9},
+		{Offset: 0, Size: 3, File: "main s", Line: 2, Column: 7, Scope: "start"},
+	}}
+	entries := FromSegment(seg, 0x1000)
+	var buf bytes.Buffer
+	if err := Write(&buf, entries); err != nil {
+		t.Fatalf("Write(); got:%v, want:nil", err)
+	}
+	want := "v65-debug 1\n$1000 3 2 7 start \"main s\"\n$1003 2 4 9 - \"main s\"\n"
+	if buf.String() != want {
+		t.Errorf("Write(); got:%q, want:%q", buf.String(), want)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read(); got:%v, want:nil", err)
+	}
+	if !reflect.DeepEqual(got, []*Entry{entries[1], entries[0]}) {
+		t.Errorf("Read(); got:%v, want:%v", got, entries)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, str := range []string{
+		"v65-debug 2\n",
+		"v65-debug 1\n1000 3 2 7 - \"a\"\n",
+		"v65-debug 1\n$1000 3 2 - \"a\"\n",
+		"v65-debug 1\n$1000 x 2 7 - \"a\"\n",
+		"v65-debug 1\n$1000 3 2 7 - a\n",
+	} {
+		println(str)
+		if _, err := Read(strings.NewReader(str)); err == nil {
+			t.Errorf("Read(); got:nil, want:error")
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package driver contains the steps that the assembler and the linker
+// commands share: reading a linker configuration, dropping the sections
+// that are not used, and writing the program, its memory areas and its
+// map to files.
+package driver
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"v65/link"
+	"v65/mapfile"
+	"v65/obj"
+	"v65/output"
+)
+
+// MapFormats are the formats of a map file, by name.
+var MapFormats = map[string]func(w io.Writer, m *mapfile.Map) error{
+	"text": mapfile.Write,
+	"json": mapfile.WriteJSON,
+}
+
+// ReadConfig reads a linker configuration file.
+func ReadConfig(name string) (*link.Config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return link.ParseConfig(f)
+}
+
+// Strip drops the sections of the modules that are not used, and reports
+// them to w. Entries are the comma-separated symbols whose sections are
+// used, besides the ones that the modules refer to.
+func Strip(w io.Writer, mods []*obj.Module, entries string) []*obj.Module {
+	var names []string
+	if entries != "" {
+		names = strings.Split(entries, ",")
+	}
+	mods, removed := link.Strip(mods, names)
+	saved := 0
+	for _, r := range removed {
+		fmt.Fprintf(w, "%s: removed section %s (%d bytes)\n", r.Module, r.Section, r.Size)
+		saved += r.Size
+	}
+	fmt.Fprintf(w, "Removed %d section(s), %d byte(s) saved.\n", len(removed), saved)
+	return mods
+}
+
+// WriteFile creates a file and writes it with write.
+func WriteFile(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteMap writes the map of a linked program to a file, in a format of
+// MapFormats.
+func WriteMap(name, format string, img *link.Image, cfg *link.Config) error {
+	write, ok := MapFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown map format: %s", format)
+	}
+	m := mapfile.New(img, cfg)
+	return WriteFile(name, func(w io.Writer) error { return write(w, m) })
+}
+
+// WriteAreas writes every memory area of a configuration that has a file
+// to that file, with write. It writes as many areas as it can, and returns
+// the errors of the others.
+func WriteAreas(img *link.Image, cfg *link.Config, write output.Writer, opts output.Options) error {
+	var errs []string
+	for _, area := range cfg.Areas {
+		if area.File == "" {
+			continue
+		}
+		blocks := output.FromArea(img, area)
+		if err := WriteFile(area.File, func(w io.Writer) error { return write(w, blocks, opts) }); err != nil {
+			errs = append(errs, fmt.Sprintf("cannot write memory area %s: %v", area.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package driver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"v65/link"
+	"v65/obj"
+	"v65/output"
+)
+
+func TestStrip(t *testing.T) {
+	mods := []*obj.Module{{
+		Name: "main",
+		Segments: []*obj.Segment{
+			{Name: "code", Code: []byte{0x60}},
+			{Name: "code.used", Parent: "code", Code: []byte{0xea}},
+			{Name: "code.unused", Parent: "code", Code: []byte{0xea, 0x60}},
+		},
+		Symbols: []*obj.Symbol{{Name: "used", Segment: "code.used"}},
+	}}
+	var buf bytes.Buffer
+	mods = Strip(&buf, mods, "used")
+	if len(mods[0].Segments) != 2 {
+		t.Errorf("len(mods[0].Segments); got:%d, want:2", len(mods[0].Segments))
+	}
+	want := "main: removed section code.unused (2 bytes)\nRemoved 1 section(s), 2 byte(s) saved.\n"
+	if buf.String() != want {
+		t.Errorf("report; got:%q, want:%q", buf.String(), want)
+	}
+}
+
+func TestWriteAreas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "driver")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(); got:%v, want:nil", err)
+	}
+	defer os.RemoveAll(dir)
+	rom := filepath.Join(dir, "rom.bin")
+	config := "memory RAM start=$0200 size=$10\nmemory ROM start=$8000 size=4 fill=$ff file=" + rom + "\nsegment code memory=ROM\n"
+	cfg, err := link.ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("link.ParseConfig(); got:%v, want:nil", err)
+	}
+	mods := []*obj.Module{{Name: "main", Segments: []*obj.Segment{{Name: "code", Code: []byte{0xea, 0x60}}}}}
+	img, err := link.LinkConfig(mods, cfg)
+	if err != nil {
+		t.Fatalf("link.LinkConfig(); got:%v, want:nil", err)
+	}
+	if err := WriteAreas(img, cfg, output.WriteBin, output.Options{}); err != nil {
+		t.Fatalf("WriteAreas(); got:%v, want:nil", err)
+	}
+	got, err := ioutil.ReadFile(rom)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile(); got:%v, want:nil", err)
+	}
+	if want := []byte{0xea, 0x60, 0xff, 0xff}; !bytes.Equal(got, want) {
+		t.Errorf("rom.bin; got:% x, want:% x", got, want)
+	}
+	if err := WriteMap(filepath.Join(dir, "map.json"), "json", img, cfg); err != nil {
+		t.Errorf("WriteMap(); got:%v, want:nil", err)
+	}
+	if err := WriteMap(filepath.Join(dir, "map.xml"), "xml", img, cfg); err == nil || !strings.Contains(err.Error(), "unknown map format: xml") {
+		t.Errorf("WriteMap() in xml; got:%v, want:unknown map format error", err)
+	}
+
+	cfg.Areas[1].File = filepath.Join(dir, "missing", "rom.bin")
+	if err := WriteAreas(img, cfg, output.WriteBin, output.Options{}); err == nil || !strings.Contains(err.Error(), "cannot write memory area ROM") {
+		t.Errorf("WriteAreas() to a missing directory; got:%v, want:cannot write error", err)
+	}
+}
@@ -0,0 +1,401 @@
+package link
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"v65/obj"
+)
+
+// A configuration describes the memory of a machine and where the
+// segments go. It is a text file with one statement per line; a # starts
+// a comment. A memory area is described by
+//
+//	memory NAME start=ADDR size=SIZE [fill=BYTE] [file=NAME] [bank=N]
+//
+// The bytes of the area that are not used are filled with BYTE, if it is
+// given, and the contents of the area are written to the file NAME. An
+// area with a bank is switchable: the areas of the banks of a cartridge
+// all have the same addresses, but only one of them is mapped at a time.
+// Other areas cannot overlap. A placement rule for a segment is
+//
+//	segment NAME memory=AREA [align=N] [optional]
+//	segment NAME load=AREA run=AREA [align=N] [optional]
+//
+// A segment with different load and run areas is stored in the load area,
+// but its code refers to its address in the run area, to which it is
+// copied at startup. The alignment applies to the start of the segment,
+// in both areas. The segments are placed in the order of the rules,
+// one after the other. A segment must be present in at least one module,
+// unless it is optional.
+//
+// Code in a switchable bank cannot call code in another bank directly.
+// Code that is always mapped can, because it can map the bank first. With
+// the rule
+//
+//	trampoline memory=AREA switch=BYTES
+//
+// the linker redirects such a jsr or jmp to a trampoline in AREA, which
+// must always be mapped. A trampoline for a jsr switches to the bank of
+// the routine, calls it, switches back to the bank of the caller and
+// returns. BYTES is the code that switches banks: bytes separated by
+// commas, where the word bank stands for the number of the bank. For a
+// mapper with its bank register at $8000, that is lda #bank; sta $8000:
+//
+//	trampoline memory=FIXED switch=$a9,bank,$8d,$00,$80
+//
+// Numbers are decimal, or hexadecimal when they start with $ or 0x.
+
+// Area is a range of memory.
+type Area struct {
+	Name  string
+	Start int
+	Size  int
+	Fill  int    // The value of unused bytes, or -1 to leave them out.
+	File  string // The file to write the area to, "" for none.
+	Bank  int    // The bank of a switchable area, or -1 if it is always mapped.
+}
+
+// End returns the address after the area.
+func (a *Area) End() int {
+	return a.Start + a.Size
+}
+
+// SegmentRule tells where the segments with a name are placed.
+type SegmentRule struct {
+	Name     string
+	Load     string // The area that holds the segment.
+	Run      string // The area that the segment runs in.
+	Align    int
+	Optional bool
+}
+
+// TrampolineRule tells where the trampolines for calls between banks go,
+// and how they switch banks.
+type TrampolineRule struct {
+	Area   string
+	Switch []int // The code that switches banks, -1 stands for the bank.
+}
+
+// Config is a linker configuration.
+type Config struct {
+	Areas       []*Area
+	Segments    []*SegmentRule
+	Trampolines *TrampolineRule // nil if calls between banks are errors.
+}
+
+// Area returns the area with a name, or nil if there is none.
+func (cfg *Config) Area(name string) *Area {
+	for _, a := range cfg.Areas {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// rule returns the placement rule of a segment, or nil if there is none.
+func (cfg *Config) rule(name string) *SegmentRule {
+	for _, r := range cfg.Segments {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// ParseConfig reads a configuration.
+func ParseConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing name", lineNo)
+		}
+		var err error
+		switch fields[0] {
+		case "memory":
+			err = cfg.parseArea(fields[1], fields[2:])
+		case "segment":
+			err = cfg.parseRule(fields[1], fields[2:])
+		case "trampoline":
+			err = cfg.parseTrampolines(fields[1:])
+		default:
+			err = fmt.Errorf("unknown statement %s", fields[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, cfg.check()
+}
+
+// parseArea parses the attributes of a memory area.
+func (cfg *Config) parseArea(name string, attrs []string) error {
+	if cfg.Area(name) != nil {
+		return fmt.Errorf("duplicate memory area %s", name)
+	}
+	a := &Area{Name: name, Start: -1, Size: -1, Fill: -1, Bank: -1}
+	for _, attr := range attrs {
+		key, value := splitAttr(attr)
+		var err error
+		switch key {
+		case "start":
+			a.Start, err = parseNumber(value, 0xffff)
+		case "size":
+			a.Size, err = parseNumber(value, 0x10000)
+		case "fill":
+			a.Fill, err = parseNumber(value, 0xff)
+		case "file":
+			a.File = value
+		case "bank":
+			a.Bank, err = parseNumber(value, 0xff)
+		default:
+			err = fmt.Errorf("unknown attribute %s of memory area %s", key, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if a.Start < 0 || a.Size < 0 {
+		return fmt.Errorf("memory area %s needs a start and a size", name)
+	}
+	if a.End() > 0x10000 {
+		return fmt.Errorf("memory area %s ends beyond $ffff", name)
+	}
+	for _, other := range cfg.Areas {
+		overlap := a.Start < other.End() && other.Start < a.End()
+		if overlap && (a.Bank < 0 || other.Bank < 0 || a.Bank == other.Bank) {
+			return fmt.Errorf("memory area %s overlaps %s", name, other.Name)
+		}
+	}
+	cfg.Areas = append(cfg.Areas, a)
+	return nil
+}
+
+// parseRule parses the attributes of a segment placement rule.
+func (cfg *Config) parseRule(name string, attrs []string) error {
+	if cfg.rule(name) != nil {
+		return fmt.Errorf("duplicate segment %s", name)
+	}
+	r := &SegmentRule{Name: name, Align: 1}
+	for _, attr := range attrs {
+		key, value := splitAttr(attr)
+		var err error
+		switch key {
+		case "memory":
+			r.Load, r.Run = value, value
+		case "load":
+			r.Load = value
+		case "run":
+			r.Run = value
+		case "align":
+			r.Align, err = parseNumber(value, 0x10000)
+			if err == nil && (r.Align == 0 || r.Align&(r.Align-1) != 0) {
+				err = fmt.Errorf("alignment of segment %s is not a power of two: %d", name, r.Align)
+			}
+		case "optional":
+			r.Optional = true
+		case "required":
+			r.Optional = false
+		default:
+			err = fmt.Errorf("unknown attribute %s of segment %s", key, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if r.Load == "" && r.Run == "" {
+		return fmt.Errorf("segment %s needs a memory area", name)
+	}
+	if r.Load == "" {
+		r.Load = r.Run
+	}
+	if r.Run == "" {
+		r.Run = r.Load
+	}
+	cfg.Segments = append(cfg.Segments, r)
+	return nil
+}
+
+// parseTrampolines parses the attributes of the trampoline rule.
+func (cfg *Config) parseTrampolines(attrs []string) error {
+	if cfg.Trampolines != nil {
+		return fmt.Errorf("duplicate trampoline rule")
+	}
+	t := &TrampolineRule{}
+	for _, attr := range attrs {
+		key, value := splitAttr(attr)
+		switch key {
+		case "memory":
+			t.Area = value
+		case "switch":
+			for _, b := range strings.Split(value, ",") {
+				if b == "bank" {
+					t.Switch = append(t.Switch, -1)
+					continue
+				}
+				n, err := parseNumber(b, 0xff)
+				if err != nil {
+					return err
+				}
+				t.Switch = append(t.Switch, n)
+			}
+		default:
+			return fmt.Errorf("unknown attribute %s of trampolines", key)
+		}
+	}
+	if t.Area == "" || len(t.Switch) == 0 {
+		return fmt.Errorf("trampolines need a memory area and switch code")
+	}
+	cfg.Trampolines = t
+	return nil
+}
+
+// check checks that the rules refer to existing areas, and that the
+// trampolines are in memory that is always mapped.
+func (cfg *Config) check() error {
+	for _, r := range cfg.Segments {
+		for _, name := range []string{r.Load, r.Run} {
+			if cfg.Area(name) == nil {
+				return fmt.Errorf("segment %s refers to unknown memory area %s", r.Name, name)
+			}
+		}
+	}
+	if t := cfg.Trampolines; t != nil {
+		a := cfg.Area(t.Area)
+		if a == nil {
+			return fmt.Errorf("trampolines refer to unknown memory area %s", t.Area)
+		}
+		if a.Bank >= 0 {
+			return fmt.Errorf("trampolines in switchable memory area %s", t.Area)
+		}
+	}
+	return nil
+}
+
+// splitAttr splits an attribute into its key and its value.
+func splitAttr(attr string) (key, value string) {
+	if i := strings.IndexByte(attr, '='); i >= 0 {
+		return attr[:i], attr[i+1:]
+	}
+	return attr, ""
+}
+
+// parseNumber parses a number from 0 to max.
+func parseNumber(s string, max int) (int, error) {
+	base := 10
+	digits := s
+	switch {
+	case strings.HasPrefix(s, "$"):
+		base, digits = 16, s[1:]
+	case strings.HasPrefix(s, "0x"):
+		base, digits = 16, s[2:]
+	}
+	n, err := strconv.ParseInt(digits, base, 32)
+	if err != nil || n < 0 || int(n) > max {
+		return 0, fmt.Errorf("invalid number: %q", s)
+	}
+	return int(n), nil
+}
+
+// LinkConfig links modules according to a configuration. The relocatable
+// segments are placed in the memory areas in the order of the rules, and
+// in the order of the modules for segments with the same name. Absolute
+// segments are placed at their address, and it is an error if the rules
+// put other segments over them.
+func LinkConfig(mods []*obj.Module, cfg *Config) (*Image, error) {
+	l := newLinker(mods)
+	l.cfg = cfg
+
+	// Every relocatable segment needs a rule, unless it is empty. Sections
+	// follow the rule of their segment.
+	for _, mod := range mods {
+		for _, seg := range mod.Segments {
+			if !seg.Absolute && len(seg.Code) > 0 && cfg.rule(seg.Group()) == nil {
+				l.errs.add("%s: segment %s is not in the configuration", mod.Name, seg.Name)
+			}
+		}
+	}
+
+	// The next free address of every area.
+	next := l.next
+	for _, a := range cfg.Areas {
+		next[a.Name] = a.Start
+	}
+	for _, r := range cfg.Segments {
+		load, run := cfg.Area(r.Load), cfg.Area(r.Run)
+		found := false
+		for _, mod := range mods {
+			for _, seg := range mod.Segments {
+				if seg.Absolute || seg.Group() != r.Name {
+					continue
+				}
+				// The alignment of the rule is the alignment of the
+				// first segment or section. The load address is padded
+				// like the run address, so that the segments can be
+				// copied as a whole.
+				alignment := seg.Align
+				if !found && r.Align > alignment {
+					alignment = r.Align
+				}
+				found = true
+				addr := align(next[run.Name], alignment)
+				loadAddr := addr
+				if load != run {
+					loadAddr = next[load.Name] + addr - next[run.Name]
+				}
+				size := len(seg.Code)
+				next[run.Name] = addr + size
+				next[load.Name] = loadAddr + size
+				if over := addr + size - run.End(); over > 0 {
+					l.errs.add("%s: segment %s overflows memory area %s by %d byte(s)", mod.Name, seg.Name, run.Name, over)
+				} else if over := loadAddr + size - load.End(); load != run && over > 0 {
+					l.errs.add("%s: segment %s overflows memory area %s by %d byte(s)", mod.Name, seg.Name, load.Name, over)
+				}
+				l.place(mod, seg, addr, loadAddr, load)
+			}
+		}
+		if !found && !r.Optional {
+			l.errs.add("required segment %s is not in any module", r.Name)
+		}
+	}
+
+	// Absolute segments stay where they are, but belong to the area that
+	// contains them. For switchable areas, that is the area with the bank
+	// of the segment.
+	for _, mod := range mods {
+		for _, seg := range mod.Segments {
+			if !seg.Absolute {
+				continue
+			}
+			var area *Area
+			for _, a := range cfg.Areas {
+				if seg.Addr >= a.Start && seg.Addr < a.End() && (a.Bank < 0 || a.Bank == seg.Bank) {
+					area = a
+					break
+				}
+			}
+			l.place(mod, seg, seg.Addr, seg.Addr, area)
+		}
+	}
+	if len(l.errs) > 0 {
+		return l.img, l.errs.err()
+	}
+	return l.finish()
+}
@@ -0,0 +1,329 @@
+package link
+
+import (
+	"strings"
+	"testing"
+	"v65/obj"
+)
+
+const testConfig = `
+# A cartridge with its data copied to RAM.
+memory ZP   start=$02 size=$fe
+memory RAM  start=$0200 size=$0600
+memory ROM  start=$8000 size=0x10 fill=$ff file=rom.bin
+
+segment code memory=ROM
+segment data load=ROM run=RAM align=256
+segment bss  memory=RAM optional
+`
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("ParseConfig(); got:%v, want:nil", err)
+	}
+	rom := cfg.Area("ROM")
+	if rom == nil || *rom != (Area{Name: "ROM", Start: 0x8000, Size: 0x10, Fill: 0xff, File: "rom.bin", Bank: -1}) {
+		t.Errorf("cfg.Area(ROM); got:%+v, want:ROM area", rom)
+	}
+	if zp := cfg.Area("ZP"); zp == nil || zp.Fill != -1 || zp.End() != 0x100 {
+		t.Errorf("cfg.Area(ZP); got:%+v, want:$02-$ff without fill", zp)
+	}
+	want := []SegmentRule{
+		{Name: "code", Load: "ROM", Run: "ROM", Align: 1},
+		{Name: "data", Load: "ROM", Run: "RAM", Align: 256},
+		{Name: "bss", Load: "RAM", Run: "RAM", Align: 1, Optional: true},
+	}
+	for i, r := range want {
+		if i >= len(cfg.Segments) || *cfg.Segments[i] != r {
+			t.Errorf("cfg.Segments[%d]; got:%v, want:%+v", i, cfg.Segments, r)
+		}
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		str  string
+		want string
+	}{
+		{"memory ROM start=$8000", "needs a start and a size"},
+		{"memory ROM start=$8000 size=$8001", "beyond $ffff"},
+		{"memory ROM start=$8000 size=$100 fill=$100", "invalid number"},
+		{"memory ROM start=$8000 size=$100 speed=1", "unknown attribute"},
+		{"memory ROM start=0 size=1\nmemory ROM start=1 size=1", "duplicate memory area"},
+		{"segment code memory=ROM", "unknown memory area ROM"},
+		{"memory ROM start=0 size=1\nsegment code align=3 memory=ROM", "not a power of two"},
+		{"segment code", "needs a memory area"},
+		{"section code", "unknown statement"},
+		{"memory A start=0 size=2\nmemory B start=1 size=2", "memory area B overlaps A"},
+		{"memory A start=0 size=2 bank=1\nmemory B start=1 size=2", "memory area B overlaps A"},
+		{"memory A start=0 size=2 bank=1\nmemory B start=1 size=2 bank=1", "memory area B overlaps A"},
+		{"memory A start=0 size=2 bank=256", "invalid number"},
+		{"memory A start=0 size=2 bank=1\ntrampoline memory=A switch=1", "switchable memory area A"},
+		{"trampoline memory=A switch=1", "unknown memory area A"},
+		{"memory A start=0 size=2\ntrampoline memory=A", "need a memory area and switch code"},
+		{"memory A start=0 size=2\ntrampoline memory=A switch=$a9,$100", "invalid number"},
+		{"memory A start=0 size=2\ntrampoline memory=A switch=1 bank=2", "unknown attribute"},
+	} {
+		println(tc.str)
+		_, err := ParseConfig(strings.NewReader(tc.str))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ParseConfig(%q); got:%v, want:%s", tc.str, err, tc.want)
+		}
+	}
+}
+
+// configModules returns a module with code in ROM that refers to data
+// that runs in RAM, and an absolute segment.
+func configModules() []*obj.Module {
+	return []*obj.Module{{
+		Name: "main",
+		Segments: []*obj.Segment{
+			{Name: "data", Code: []byte{1, 2}},
+			{
+				Name:   "code",
+				Code:   []byte{0xad, 0x00, 0x00, 0x60}, // lda data+1; rts
+				Relocs: []*obj.Reloc{{Offset: 1, Size: 2, Segment: "data", Addend: 1}},
+			},
+			{Name: "io", Code: []byte{0}, Absolute: true, Addr: 0xd000},
+		},
+	}}
+}
+
+func TestLinkConfig(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("ParseConfig(); got:%v, want:nil", err)
+	}
+	img, err := LinkConfig(configModules(), cfg)
+	if err != nil {
+		t.Fatalf("LinkConfig(); got:%v, want:nil", err)
+	}
+	for i, want := range []Placement{
+		{Module: "main", Addr: 0x8000, Load: 0x8000, Area: "ROM"},
+		{Module: "main", Addr: 0x0200, Load: 0x8004, Area: "ROM"},
+		{Module: "main", Addr: 0xd000, Load: 0xd000, Area: ""},
+	} {
+		p := img.Placements[i]
+		if p.Addr != want.Addr || p.Load != want.Load || p.Area != want.Area {
+			t.Errorf("img.Placements[%d]; got:%+v, want:%+v", i, p, want)
+		}
+	}
+	want := []byte{0xad, 0x01, 0x02, 0x60}
+	for i, b := range want {
+		if got := img.Placements[0].Segment.Code[i]; got != b {
+			t.Errorf("code[%d]; got:$%x, want:$%x", i, got, b)
+		}
+	}
+}
+
+func TestLinkConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		str  string
+		want string
+	}{
+		{
+			"memory ROM start=$8000 size=3\nsegment code memory=ROM\nsegment data memory=ROM",
+			"segment code overflows memory area ROM by 1 byte(s)",
+		},
+		{
+			"memory ROM start=$8000 size=5\nsegment code memory=ROM\nsegment data memory=ROM",
+			"segment data overflows memory area ROM by 1 byte(s)",
+		},
+		{
+			"memory ROM start=$8000 size=5\nmemory RAM start=0 size=$100\nsegment code memory=ROM\nsegment data load=ROM run=RAM",
+			"segment data overflows memory area ROM by 1 byte(s)",
+		},
+		{
+			"memory ROM start=$8000 size=$100\nsegment code memory=ROM",
+			"segment data is not in the configuration",
+		},
+		{
+			"memory ROM start=$8000 size=$100\nsegment code memory=ROM\nsegment data memory=ROM\nsegment bss memory=ROM",
+			"required segment bss",
+		},
+	} {
+		println(tc.str)
+		cfg, err := ParseConfig(strings.NewReader(tc.str))
+		if err != nil {
+			t.Errorf("ParseConfig(%q); got:%v, want:nil", tc.str, err)
+			continue
+		}
+		if _, err := LinkConfig(configModules(), cfg); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("LinkConfig() with %q; got:%v, want:%s", tc.str, err, tc.want)
+		}
+	}
+}
+
+func TestLinkConfigOverlap(t *testing.T) {
+	for _, tc := range []struct {
+		str  string
+		want string
+	}{
+		{"memory RAM start=$1000 size=$100\nsegment main memory=RAM", "org.s: segment code at $1000-$1002 overlaps segment main of main.s at $1000-$1001"},
+		{"memory ROM start=$8000 size=$100\nmemory RAM start=$1000 size=$100\nsegment main load=ROM run=RAM", "overlaps segment main"},
+		{"memory ROM start=$8000 size=$100\nmemory RAM start=$0fff size=$100\nsegment main load=ROM run=RAM", "overlaps segment main"},
+		{"memory RAM start=$1003 size=$100\nsegment main memory=RAM", ""},
+		{"memory A start=$1000 size=$100 bank=0\nmemory B start=$1000 size=$100 bank=1\nsegment main memory=B", ""},
+	} {
+		println(tc.str)
+		mods := []*obj.Module{
+			{Name: "org.s", Segments: []*obj.Segment{{Name: "code", Code: []byte{1, 2, 3}, Absolute: true, Addr: 0x1000}}},
+			{Name: "main.s", Segments: []*obj.Segment{{Name: "main", Code: []byte{9, 9}}}},
+		}
+		cfg, err := ParseConfig(strings.NewReader(tc.str))
+		if err != nil {
+			t.Errorf("ParseConfig(%q); got:%v, want:nil", tc.str, err)
+			continue
+		}
+		_, err = LinkConfig(mods, cfg)
+		if tc.want == "" && err != nil || tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("LinkConfig(); got:%v, want:%q", err, tc.want)
+		}
+	}
+	mods := []*obj.Module{
+		{Name: "org.s", Segments: []*obj.Segment{{Name: "code", Code: []byte{1, 2, 3}, Absolute: true, Addr: 0x1001}}},
+		{Name: "main.s", Segments: []*obj.Segment{{Name: "main", Code: []byte{9, 9}}}},
+	}
+	if _, err := Link(mods, 0x1000); err == nil || !strings.Contains(err.Error(), "overlaps segment code of org.s") {
+		t.Errorf("Link(); got:%v, want:overlap error", err)
+	}
+}
+
+func TestLinkBounds(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("ParseConfig(); got:%v, want:nil", err)
+	}
+	mods := configModules()
+	mods = append(mods, &obj.Module{
+		Name:     "startup",
+		Segments: []*obj.Segment{{Name: "data", Code: []byte{3}}},
+		Symbols:  []*obj.Symbol{{Name: "__io_size__", Value: 16}},
+	})
+	img, err := LinkConfig(mods, cfg)
+	if err != nil {
+		t.Fatalf("LinkConfig(); got:%v, want:nil", err)
+	}
+	for _, tc := range []struct {
+		name string
+		want int64
+	}{
+		{"__code_load__", 0x8000},
+		{"__code_run__", 0x8000},
+		{"__code_size__", 4},
+		{"__data_load__", 0x8004},
+		{"__data_run__", 0x0200},
+		{"__data_size__", 3},
+		{"__io_run__", 0xd000},
+		{"__io_size__", 16}, // Defined by a module.
+		{"__rom_load__", 0x8000},
+		{"__rom_size__", 0x10},
+		{"__zp_run__", 0x02},
+	} {
+		println(tc.name)
+		if got, ok := img.Symbols[tc.name]; !ok || got != tc.want {
+			t.Errorf("img.Symbols[%s]; got:$%x, want:$%x", tc.name, got, tc.want)
+		}
+	}
+}
+
+const bankConfig = `
+memory BANK0 start=$8000 size=$4000 bank=0 file=bank0.bin
+memory BANK1 start=$8000 size=$4000 bank=1 file=bank1.bin
+memory FIXED start=$c000 size=$4000
+segment fixed memory=FIXED
+segment one memory=BANK1
+segment zero memory=BANK0
+`
+
+// bankModules returns a module with code in two banks and in memory that
+// is always mapped. The code in bank 0 calls the code in bank 1.
+func bankModules() []*obj.Module {
+	return []*obj.Module{{
+		Name: "main",
+		Segments: []*obj.Segment{
+			{
+				Name: "fixed",
+				Code: []byte{0xa9, 0x00, 0x20, 0x00, 0x00}, // lda #bank(fn); jsr fn
+				Relocs: []*obj.Reloc{
+					{Offset: 1, Size: 1, Symbol: "fn", Part: obj.Bank},
+					{Offset: 3, Size: 2, Symbol: "fn", Call: true},
+				},
+			},
+			{Name: "one", Code: []byte{0xea, 0x60}}, // nop; fn: rts
+			{Name: "empty"},
+			{
+				Name:   "zero",
+				Code:   []byte{0x20, 0x00, 0x00}, // jsr fn
+				Relocs: []*obj.Reloc{{Offset: 1, Size: 2, Symbol: "fn", Call: true}},
+			},
+		},
+		Symbols: []*obj.Symbol{{Name: "fn", Segment: "one", Value: 1}},
+	}}
+}
+
+func TestLinkBanks(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(bankConfig))
+	if err != nil {
+		t.Fatalf("ParseConfig(); got:%v, want:nil", err)
+	}
+	mods := bankModules()
+	_, err = LinkConfig(mods, cfg)
+	if err == nil || !strings.Contains(err.Error(), "call from bank 0 to fn in bank 1 needs a trampoline") {
+		t.Errorf("LinkConfig() with a call between banks; got:%v, want:trampoline error", err)
+	}
+	mods[0].Segments[3].Relocs[0].Call = false
+	img, err := LinkConfig(mods, cfg)
+	if err != nil {
+		t.Fatalf("LinkConfig(); got:%v, want:nil", err)
+	}
+	// The empty segment is not in the configuration, and is not placed.
+	for i, want := range []struct {
+		addr int
+		bank int
+		area string
+	}{
+		{0xc000, 0, "FIXED"},
+		{0x8000, 1, "BANK1"},
+		{0x8000, 0, "BANK0"},
+	} {
+		p := img.Placements[i]
+		if p.Addr != want.addr || p.Segment.Bank != want.bank || p.Area != want.area {
+			t.Errorf("img.Placements[%d]; got:$%x/%d/%s, want:$%x/%d/%s", i, p.Addr, p.Segment.Bank, p.Area, want.addr, want.bank, want.area)
+		}
+	}
+	want := []byte{0xa9, 0x01, 0x20, 0x01, 0x80}
+	for i, b := range want {
+		if got := img.Placements[0].Segment.Code[i]; got != b {
+			t.Errorf("code[%d]; got:$%x, want:$%x", i, got, b)
+		}
+	}
+}
+
+func TestLinkSharedBanks(t *testing.T) {
+	// Without a configuration, banks are switchable where they share
+	// addresses. The fixed segment is always mapped, and can call fn.
+	for _, tc := range []struct {
+		str  string
+		zero int // The address of the code in bank 0 that calls fn.
+		want string
+	}{
+		{"same addresses", 0x8000, "call from bank 0 to fn in bank 1 needs a trampoline"},
+		{"other addresses", 0xa000, ""},
+	} {
+		println(tc.str)
+		mods := bankModules()
+		for _, seg := range mods[0].Segments {
+			seg.Absolute = true
+		}
+		fixed, one, zero := mods[0].Segments[0], mods[0].Segments[1], mods[0].Segments[3]
+		fixed.Addr = 0xc000
+		one.Addr, one.Bank = 0x8000, 1
+		zero.Addr = tc.zero
+		_, err := Link(mods, 0)
+		if tc.want == "" && err != nil || tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("Link(); got:%v, want:%q", err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,529 @@
+// Package link contains the linker, which places the segments of object
+// modules in memory and resolves the references between them.
+package link
+
+import (
+	"fmt"
+	"strings"
+	"v65/debuginfo"
+	"v65/obj"
+	"v65/symfile"
+)
+
+// Placement is a segment of a module at its final address. The code of
+// the segment has all its relocations applied. A segment can be loaded at
+// another address than the one it runs at, for example when it is copied
+// from ROM to RAM at startup.
+type Placement struct {
+	Module  string
+	Segment *obj.Segment
+	Addr    int    // The address at which the segment runs.
+	Load    int    // The address at which the segment is loaded.
+	Area    string // The memory area that holds the segment, if any.
+}
+
+// Vector is an address for the loader (see obj.Vector). At is the address
+// at which it was defined.
+type Vector struct {
+	Kind int
+	Addr int
+	At   int
+}
+
+// Fixup is a value in the image that depends on the address of a
+// relocatable segment, and changes when the program is moved.
+type Fixup struct {
+	Module string
+	Addr   int // The load address of the value.
+	Size   int
+	Part   int
+}
+
+// Image is the result of linking.
+type Image struct {
+	Placements []*Placement
+	Symbols    map[string]int64  // Final values of all exported symbols.
+	Defined    map[string]string // The module that defines each symbol.
+	Vectors    []*Vector
+	Attributes map[string]int // The attributes of all modules.
+	Fixups     []*Fixup       // In the order of the placements.
+}
+
+// errorList collects the errors found while linking.
+type errorList []string
+
+// add adds an error to the list.
+func (e *errorList) add(format string, args ...interface{}) {
+	*e = append(*e, fmt.Sprintf(format, args...))
+}
+
+// err returns the errors as a single error, or nil if there were none.
+func (e errorList) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(e, "\n"))
+}
+
+// linker holds the state of a link: the image that is being built, the
+// address of every segment and the errors found so far.
+type linker struct {
+	mods   []*obj.Module
+	cfg    *Config        // The configuration, nil for Link.
+	next   map[string]int // The next free address of every area.
+	img    *Image
+	addrs  map[*obj.Segment]int // The run address of every segment.
+	owners []*obj.Module        // The module of every placement.
+	segs   []*obj.Segment       // The original segment of every placement.
+
+	// The bank of every segment, and whether it is in a switchable bank.
+	banks  map[*obj.Segment]int
+	banked map[*obj.Segment]bool
+
+	// The segment that defines each symbol, nil for a constant.
+	symSegs map[string]*obj.Segment
+
+	// The address of the trampoline that replaces the target of a call.
+	redirect map[*obj.Reloc]int
+
+	errs errorList
+}
+
+// newLinker returns a linker for modules, with their attributes merged.
+func newLinker(mods []*obj.Module) *linker {
+	l := &linker{
+		mods: mods,
+		img: &Image{
+			Symbols:    make(map[string]int64),
+			Defined:    make(map[string]string),
+			Attributes: make(map[string]int),
+		},
+		next:     make(map[string]int),
+		addrs:    make(map[*obj.Segment]int),
+		banks:    make(map[*obj.Segment]int),
+		banked:   make(map[*obj.Segment]bool),
+		symSegs:  make(map[string]*obj.Segment),
+		redirect: make(map[*obj.Reloc]int),
+	}
+
+	// Merge the attributes. Modules cannot disagree about them.
+	for _, mod := range mods {
+		for name, value := range mod.Attributes {
+			if old, ok := l.img.Attributes[name]; ok && old != value {
+				l.errs.add("%s: %s is %d, but %d in another module", mod.Name, name, value, old)
+				continue
+			}
+			l.img.Attributes[name] = value
+		}
+	}
+	return l
+}
+
+// place places a segment of a module. The segment runs at address addr,
+// but is loaded at address load, in a memory area if area is not nil. A
+// segment in a switchable area gets the bank of the area.
+func (l *linker) place(mod *obj.Module, seg *obj.Segment, addr, load int, area *Area) {
+	if addr+len(seg.Code) > 0x10000 {
+		l.errs.add("%s: segment %s does not fit in memory: ends at $%x", mod.Name, seg.Name, addr+len(seg.Code))
+	}
+	areaName, bank := "", seg.Bank
+	if area != nil {
+		areaName = area.Name
+		if area.Bank >= 0 {
+			bank = area.Bank
+			l.banked[seg] = true
+		}
+	}
+	l.addrs[seg] = addr
+	l.banks[seg] = bank
+	l.owners = append(l.owners, mod)
+	l.segs = append(l.segs, seg)
+	l.img.Placements = append(l.img.Placements, &Placement{
+		Module: mod.Name,
+		Segment: &obj.Segment{
+			Name:     seg.Name,
+			Code:     append([]byte(nil), seg.Code...),
+			Relocs:   seg.Relocs,
+			Absolute: seg.Absolute,
+			Addr:     addr,
+			Align:    seg.Align,
+			Lines:    seg.Lines,
+			Bank:     bank,
+			Parent:   seg.Parent,
+		},
+		Addr: addr,
+		Load: load,
+		Area: areaName,
+	})
+}
+
+// Link links modules. Absolute segments are placed at their address, the
+// relocatable segments are placed one after the other, starting at address
+// base. An absolute segment cannot overlap another segment. A segment is
+// in a switchable bank if a segment in another bank runs at the same
+// addresses.
+func Link(mods []*obj.Module, base int) (*Image, error) {
+	l := newLinker(mods)
+	addr := base
+	for _, mod := range mods {
+		for _, seg := range mod.Segments {
+			segAddr := seg.Addr
+			if !seg.Absolute {
+				segAddr = align(addr, seg.Align)
+				addr = segAddr + len(seg.Code)
+			}
+			l.place(mod, seg, segAddr, segAddr, nil)
+		}
+	}
+	l.sharedBanks()
+	return l.finish()
+}
+
+// sharedBanks marks the segments that run at the same addresses as a
+// segment in another bank as switchable. Only one of the banks can be
+// mapped at a time, like the banks of the areas of a configuration.
+func (l *linker) sharedBanks() {
+	ps := l.img.Placements
+	for i, a := range ps {
+		for j, b := range ps[i+1:] {
+			if a.Segment.Bank != b.Segment.Bank && overlap(a.Addr, len(a.Segment.Code), b.Addr, len(b.Segment.Code)) {
+				l.banked[l.segs[i]] = true
+				l.banked[l.segs[i+1+j]] = true
+			}
+		}
+	}
+}
+
+// finish resolves the symbols, the relocations and the vectors of the
+// placed segments.
+func (l *linker) finish() (*Image, error) {
+	img := l.img
+
+	// Determine the values of the exported symbols. A weak symbol is
+	// overridden by a symbol with the same name that is not weak.
+	weak := make(map[string]bool)
+	for _, mod := range l.mods {
+		for _, sym := range mod.Symbols {
+			if other, ok := img.Defined[sym.Name]; ok {
+				if sym.Weak {
+					continue
+				}
+				if !weak[sym.Name] {
+					l.errs.add("%s: symbol %s already defined in %s", mod.Name, sym.Name, other)
+					continue
+				}
+			}
+			value := sym.Value
+			var seg *obj.Segment
+			if sym.Segment != "" {
+				if seg = mod.Segment(sym.Segment); seg == nil {
+					l.errs.add("%s: symbol %s is relative to unknown segment %s", mod.Name, sym.Name, sym.Segment)
+					continue
+				}
+				value += int64(l.addrs[seg])
+			}
+			l.symSegs[sym.Name] = seg
+			img.Defined[sym.Name] = mod.Name
+			weak[sym.Name] = sym.Weak
+			img.Symbols[sym.Name] = value
+		}
+	}
+
+	if l.cfg != nil && l.cfg.Trampolines != nil {
+		l.trampolines()
+	}
+
+	// The symbols that the linker defines are weak too. They are defined
+	// once all segments are placed, including the trampolines.
+	for name, value := range l.bounds() {
+		if _, ok := img.Defined[name]; ok && !weak[name] {
+			continue
+		}
+		img.Symbols[name] = value
+		img.Defined[name] = linkerModule
+		delete(l.symSegs, name)
+	}
+	l.checkOverlaps()
+
+	// Apply the relocations.
+	for i, p := range img.Placements {
+		mod, seg := l.owners[i], l.segs[i]
+		for _, r := range p.Segment.Relocs {
+			value, ok := l.resolve(mod, r.Symbol, r.Segment)
+			if !ok {
+				continue
+			}
+			addr, redirected := l.redirect[r]
+			if r.Call && !redirected {
+				l.checkCall(mod, seg, r)
+			}
+			if r.Part == obj.Bank {
+				target := l.target(mod, r)
+				if target == nil {
+					l.errs.add("%s: %s is a constant, it has no bank", mod.Name, r.Symbol)
+					continue
+				}
+				value = int64(l.banks[target])
+			}
+			name := r.Symbol
+			if r.Segment != "" {
+				name = "segment " + r.Segment
+			}
+			value += r.Addend
+			if redirected {
+				value = int64(addr)
+			}
+			if ext := mod.Extern(r.Symbol); ext != nil && ext.ZeroPage && (value < 0 || value > 0xff) {
+				l.errs.add("%s: symbol %s is not in the zero page: $%x", mod.Name, r.Symbol, value)
+				continue
+			}
+			value = part(value, r.Part)
+			if !fits(value, r.Size) {
+				l.errs.add("%s: value of %s does not fit in %d byte(s): $%x", mod.Name, name, r.Size, value)
+				continue
+			}
+			p.Segment.Patch(r.Offset, r.Size, value)
+			if target := l.target(mod, r); (redirected || target != nil && !target.Absolute) && r.Part != obj.Bank {
+				img.Fixups = append(img.Fixups, &Fixup{Module: mod.Name, Addr: p.Load + r.Offset, Size: r.Size, Part: r.Part})
+			}
+		}
+	}
+
+	// Resolve the vectors. A program can only start at one address.
+	runIn := ""
+	for _, mod := range l.mods {
+		for _, v := range mod.Vectors {
+			value, ok := l.resolve(mod, v.Symbol, v.Segment)
+			if !ok {
+				continue
+			}
+			at := mod.Segment(v.AtSegment)
+			if at == nil {
+				l.errs.add("%s: vector defined in unknown segment %s", mod.Name, v.AtSegment)
+				continue
+			}
+			if v.Kind == obj.Run {
+				if runIn != "" {
+					l.errs.add("%s: run address already defined in %s", mod.Name, runIn)
+					continue
+				}
+				runIn = mod.Name
+			}
+			img.Vectors = append(img.Vectors, &Vector{
+				Kind: v.Kind,
+				Addr: int(value + v.Value),
+				At:   l.addrs[at] + v.AtOffset,
+			})
+		}
+	}
+	return img, l.errs.err()
+}
+
+// checkOverlaps reports the absolute segments that overlap other
+// segments, where they run or where they are loaded, because one would
+// overwrite the other. Segments in different banks can overlap.
+func (l *linker) checkOverlaps() {
+	ps := l.img.Placements
+	for i, a := range ps {
+		for _, b := range ps[i+1:] {
+			if !a.Segment.Absolute && !b.Segment.Absolute || a.Segment.Bank != b.Segment.Bank {
+				continue
+			}
+			size, other := len(a.Segment.Code), len(b.Segment.Code)
+			if overlap(a.Addr, size, b.Addr, other) || overlap(a.Load, size, b.Load, other) {
+				l.errs.add("%s: segment %s at $%04x-$%04x overlaps segment %s of %s at $%04x-$%04x", b.Module, b.Segment.Name, b.Addr, b.Addr+other-1, a.Segment.Name, a.Module, a.Addr, a.Addr+size-1)
+			}
+		}
+	}
+}
+
+// overlap returns true if the size bytes at addr and the other bytes at
+// otherAddr have an address in common.
+func overlap(addr, size, otherAddr, other int) bool {
+	return size > 0 && other > 0 && addr < otherAddr+other && otherAddr < addr+size
+}
+
+// target returns the segment that a relocation refers to, or nil if it
+// refers to a constant.
+func (l *linker) target(mod *obj.Module, r *obj.Reloc) *obj.Segment {
+	if r.Segment != "" {
+		return mod.Segment(r.Segment)
+	}
+	return l.symSegs[r.Symbol]
+}
+
+// crossBank returns true if a relocation in code in a switchable bank
+// refers to code in another switchable bank.
+func (l *linker) crossBank(mod *obj.Module, seg *obj.Segment, r *obj.Reloc) bool {
+	target := l.target(mod, r)
+	return target != nil && l.banked[seg] && l.banked[target] && l.banks[seg] != l.banks[target]
+}
+
+// checkCall checks that code in a switchable bank does not call code in
+// another switchable bank, which is not mapped when the call is made. Such
+// a call has to go through a trampoline in memory that is always mapped.
+// Code in memory that is always mapped can call any bank: it stays mapped
+// while it maps the bank of the routine, which is how a program switches
+// banks in the first place, and the linker cannot see whether it does.
+func (l *linker) checkCall(mod *obj.Module, seg *obj.Segment, r *obj.Reloc) {
+	if !l.crossBank(mod, seg, r) {
+		return
+	}
+	target := l.target(mod, r)
+	name := r.Symbol
+	if name == "" {
+		name = "segment " + r.Segment
+	}
+	l.errs.add("%s: call from bank %d to %s in bank %d needs a trampoline", mod.Name, l.banks[seg], name, l.banks[target])
+}
+
+// linkerModule is the name of the module that defines the symbols that
+// the linker generates.
+const linkerModule = "linker"
+
+// bounds returns the symbols __NAME_LOAD__, __NAME_RUN__ and __NAME_SIZE__
+// for every placed segment and memory area, so that startup code can copy
+// data from ROM to RAM and clear uninitialized data. The segments with the
+// same name of all modules and their sections count as one segment, from
+// the lowest address to the highest. NAME is in lower case, like all
+// identifiers in a source.
+func (l *linker) bounds() map[string]int64 {
+	syms := make(map[string]int64)
+	define := func(name string, load, run, size int) {
+		prefix := "__" + strings.ToLower(name)
+		syms[prefix+"_load__"] = int64(load)
+		syms[prefix+"_run__"] = int64(run)
+		syms[prefix+"_size__"] = int64(size)
+	}
+	type span struct{ load, run, end int }
+	spans := make(map[string]*span)
+	var names []string
+	for _, p := range l.img.Placements {
+		name, end := p.Segment.Group(), p.Addr+len(p.Segment.Code)
+		s, ok := spans[name]
+		if !ok {
+			spans[name] = &span{p.Load, p.Addr, end}
+			names = append(names, name)
+			continue
+		}
+		if p.Load < s.load {
+			s.load = p.Load
+		}
+		if p.Addr < s.run {
+			s.run = p.Addr
+		}
+		if end > s.end {
+			s.end = end
+		}
+	}
+	for _, name := range names {
+		s := spans[name]
+		define(name, s.load, s.run, s.end-s.run)
+	}
+	if l.cfg != nil {
+		for _, a := range l.cfg.Areas {
+			define(a.Name, a.Start, a.Start, a.Size)
+		}
+	}
+	return syms
+}
+
+// resolve returns the value of a symbol, or the address of a segment of a
+// module if segment is set. If neither is set, the value is absolute.
+func (l *linker) resolve(mod *obj.Module, symbol, segment string) (int64, bool) {
+	value, ok := l.lookup(mod, symbol, segment)
+	switch {
+	case ok:
+	case segment != "":
+		l.errs.add("%s: reference to unknown segment %s", mod.Name, segment)
+	default:
+		l.errs.add("%s: undefined symbol %s", mod.Name, symbol)
+	}
+	return value, ok
+}
+
+// lookup is resolve without reporting errors.
+func (l *linker) lookup(mod *obj.Module, symbol, segment string) (int64, bool) {
+	if symbol == "" && segment == "" {
+		return 0, true
+	}
+	if segment != "" {
+		seg := mod.Segment(segment)
+		if seg == nil {
+			return 0, false
+		}
+		return int64(l.addrs[seg]), true
+	}
+	value, ok := l.img.Symbols[symbol]
+	return value, ok
+}
+
+// DebugInfo returns the debug information of all placed segments, with
+// the addresses of the lines where they end up in memory.
+func (img *Image) DebugInfo() []*debuginfo.Entry {
+	var entries []*debuginfo.Entry
+	for _, p := range img.Placements {
+		entries = append(entries, debuginfo.FromSegment(p.Segment, p.Addr)...)
+	}
+	return entries
+}
+
+// SymbolTable returns the symbol table of a source that was linked on its
+// own, with the values of the symbols where the program ends up. Exported
+// symbols get their final value, and the other labels in relocatable
+// segments are moved with their segment. The labels of segments that are
+// not placed are left out.
+func (img *Image) SymbolTable(syms []*symfile.Symbol) []*symfile.Symbol {
+	placed := make(map[string]*Placement)
+	for _, p := range img.Placements {
+		placed[p.Segment.Name] = p
+	}
+	var out []*symfile.Symbol
+	for _, sym := range syms {
+		moved := *sym
+		if value, ok := img.Symbols[sym.Name]; ok && sym.Global {
+			moved.Value = value
+		} else if sym.Segment != "" {
+			p, ok := placed[sym.Segment]
+			if !ok {
+				continue
+			}
+			if !p.Segment.Absolute {
+				moved.Value += int64(p.Addr)
+			}
+		}
+		out = append(out, &moved)
+	}
+	return out
+}
+
+// align rounds addr up to a multiple of alignment.
+func align(addr int, alignment int) int {
+	if alignment <= 1 {
+		return addr
+	}
+	return (addr + alignment - 1) &^ (alignment - 1)
+}
+
+// part returns the part of a value that a relocation stores.
+func part(value int64, p int) int64 {
+	switch p {
+	case obj.Bank:
+		// The bank does not depend on the address.
+	case obj.Low:
+		value &= 0xff
+	case obj.High:
+		value = (value >> 8) & 0xff
+	}
+	return value
+}
+
+// fits returns true if value fits in size bytes, either as a signed or
+// as an unsigned number.
+func fits(value int64, size int) bool {
+	if size >= 8 {
+		return true
+	}
+	bits := uint(8 * size)
+	return value >= -(1<<(bits-1)) && value < 1<<bits
+}
@@ -0,0 +1,207 @@
+package link
+
+import (
+	"strings"
+	"testing"
+	"v65/obj"
+	"v65/symfile"
+)
+
+// testModules returns a module that exports a zero page variable and a
+// routine, and a module that uses both.
+func testModules(ptr int64) []*obj.Module {
+	return []*obj.Module{
+		{
+			Name: "lib",
+			Segments: []*obj.Segment{{
+				Name: "code",
+				Code: []byte{0xea, 0x60}, // nop; fn: rts
+			}},
+			Symbols: []*obj.Symbol{
+				{Name: "ptr", Value: ptr},
+				{Name: "fn", Segment: "code", Value: 1},
+			},
+		},
+		{
+			Name: "main",
+			Segments: []*obj.Segment{{
+				Name: "code",
+				Code: []byte{0xa5, 0x01, 0x20, 0x00, 0x00}, // lda ptr+1; jsr fn
+				Relocs: []*obj.Reloc{
+					{Offset: 1, Size: 1, Symbol: "ptr", Addend: 1},
+					{Offset: 3, Size: 2, Symbol: "fn"},
+				},
+			}},
+			Externs: []*obj.Extern{
+				{Name: "ptr", ZeroPage: true},
+				{Name: "fn"},
+			},
+		},
+	}
+}
+
+func TestLink(t *testing.T) {
+	img, err := Link(testModules(0xfb), 0x1000)
+	if err != nil {
+		t.Fatalf("Link(); got:%v, want:nil", err)
+	}
+	if len(img.Placements) != 2 {
+		t.Fatalf("len(img.Placements); got:%d, want:2", len(img.Placements))
+	}
+	if img.Placements[1].Addr != 0x1002 {
+		t.Errorf("img.Placements[1].Addr; got:$%x, want:$1002", img.Placements[1].Addr)
+	}
+	if img.Symbols["fn"] != 0x1001 {
+		t.Errorf("img.Symbols[fn]; got:$%x, want:$1001", img.Symbols["fn"])
+	}
+	want := []byte{0xa5, 0xfc, 0x20, 0x01, 0x10}
+	for i, b := range want {
+		if got := img.Placements[1].Segment.Code[i]; got != b {
+			t.Errorf("code[%d]; got:$%x, want:$%x", i, got, b)
+		}
+	}
+	// ptr is a constant, only fn moves with the program.
+	if len(img.Fixups) != 1 || *img.Fixups[0] != (Fixup{Module: "main", Addr: 0x1005, Size: 2}) {
+		t.Errorf("img.Fixups; got:%v, want:fn at $1005", img.Fixups)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	mods := testModules(0xff)
+	if _, err := Link(mods, 0x1000); err == nil || !strings.Contains(err.Error(), "zero page") {
+		t.Errorf("Link() with ptr+1 outside the zero page; got:%v, want:zero page error", err)
+	}
+	mods = testModules(0xfb)
+	mods[0].Symbols = mods[0].Symbols[:1]
+	if _, err := Link(mods, 0x1000); err == nil || !strings.Contains(err.Error(), "undefined symbol fn") {
+		t.Errorf("Link() without fn; got:%v, want:undefined symbol error", err)
+	}
+	mods = testModules(0xfb)
+	mods[1].Symbols = []*obj.Symbol{{Name: "fn", Value: 1}}
+	if _, err := Link(mods, 0x1000); err == nil || !strings.Contains(err.Error(), "already defined") {
+		t.Errorf("Link() with fn defined twice; got:%v, want:already defined error", err)
+	}
+	if _, err := Link(testModules(0xfb), 0xfffe); err == nil || !strings.Contains(err.Error(), "does not fit") {
+		t.Errorf("Link() at $fffe; got:%v, want:does not fit error", err)
+	}
+}
+
+func TestLinkSegments(t *testing.T) {
+	mods := []*obj.Module{{
+		Name: "main",
+		Segments: []*obj.Segment{
+			{
+				Name: "code",
+				Code: []byte{0xad, 0x00, 0x01, 0xa9, 0x01, 0xa2, 0x01}, // lda data+1; lda #<data+1; ldx #>data+1
+				Relocs: []*obj.Reloc{
+					{Offset: 1, Size: 2, Segment: "data", Addend: 1},
+					{Offset: 4, Size: 1, Segment: "data", Addend: 1, Part: obj.Low},
+					{Offset: 6, Size: 1, Segment: "data", Addend: 1, Part: obj.High},
+				},
+			},
+			{Name: "data", Code: []byte{1, 2}, Align: 256},
+			{Name: "vectors", Code: []byte{0, 0}, Absolute: true, Addr: 0xfffa},
+		},
+	}}
+	img, err := Link(mods, 0x1000)
+	if err != nil {
+		t.Fatalf("Link(); got:%v, want:nil", err)
+	}
+	for i, want := range []int{0x1000, 0x1100, 0xfffa} {
+		if got := img.Placements[i].Addr; got != want {
+			t.Errorf("img.Placements[%d].Addr; got:$%x, want:$%x", i, got, want)
+		}
+	}
+	want := []byte{0xad, 0x01, 0x11, 0xa9, 0x01, 0xa2, 0x11}
+	for i, b := range want {
+		if got := img.Placements[0].Segment.Code[i]; got != b {
+			t.Errorf("code[%d]; got:$%x, want:$%x", i, got, b)
+		}
+	}
+}
+
+func TestLinkWeak(t *testing.T) {
+	for _, tc := range []struct {
+		weak      []bool // Is fn weak in lib and main?
+		wantValue int64
+		wantError bool
+	}{
+		{[]bool{true, false}, 0x1003, false},
+		{[]bool{false, true}, 0x1001, false},
+		{[]bool{true, true}, 0x1001, false},
+		{[]bool{false, false}, 0, true},
+	} {
+		mods := testModules(0xfb)
+		mods[0].Symbols[1].Weak = tc.weak[0]
+		mods[1].Symbols = []*obj.Symbol{{Name: "fn", Segment: "code", Value: 1, Weak: tc.weak[1]}}
+		img, err := Link(mods, 0x1000)
+		if (err != nil) != tc.wantError {
+			t.Errorf("Link() with weak %v; got:%v, want error:%v", tc.weak, err, tc.wantError)
+			continue
+		}
+		if err == nil && img.Symbols["fn"] != tc.wantValue {
+			t.Errorf("img.Symbols[fn] with weak %v; got:$%x, want:$%x", tc.weak, img.Symbols["fn"], tc.wantValue)
+		}
+	}
+}
+
+func TestLinkDebugInfo(t *testing.T) {
+	mods := testModules(0xfb)
+	mods[1].Segments[0].Lines = []*obj.Line{{Offset: 2, Size: 3, File: "main.s", Line: 5, Column: 1}}
+	img, err := Link(mods, 0x1000)
+	if err != nil {
+		t.Fatalf("Link(); got:%v, want:nil", err)
+	}
+	entries := img.DebugInfo()
+	if len(entries) != 1 || entries[0].Addr != 0x1004 || entries[0].Line != 5 {
+		t.Errorf("img.DebugInfo(); got:%v, want:line 5 at $1004", entries)
+	}
+}
+
+func TestLinkSymbolTable(t *testing.T) {
+	img, err := Link(testModules(0xfb)[:1], 0x1000)
+	if err != nil {
+		t.Fatalf("Link(); got:%v, want:nil", err)
+	}
+	syms := img.SymbolTable([]*symfile.Symbol{
+		{Name: "fn", Segment: "code", Value: 1, Global: true},
+		{Name: "loop", Segment: "code"},
+		{Name: "ptr", Value: 0xfb, Global: true},
+		{Name: "gone", Segment: "data", Value: 1},
+	})
+	want := []int64{0x1001, 0x1000, 0xfb}
+	if len(syms) != len(want) {
+		t.Fatalf("len(img.SymbolTable()); got:%d, want:%d", len(syms), len(want))
+	}
+	for i, sym := range syms {
+		if sym.Value != want[i] {
+			t.Errorf("%s; got:$%x, want:$%x", sym.Name, sym.Value, want[i])
+		}
+	}
+}
+
+func TestLinkVectors(t *testing.T) {
+	mods := testModules(0xfb)
+	mods[1].Vectors = []*obj.Vector{
+		{Kind: obj.Init, Symbol: "fn", AtSegment: "code", AtOffset: 5},
+		{Kind: obj.Run, Segment: "code", Value: 2, AtSegment: "code", AtOffset: 5},
+		{Kind: obj.NMI, Value: 0xe000, AtSegment: "code"},
+	}
+	img, err := Link(mods, 0x1000)
+	if err != nil {
+		t.Fatalf("Link(); got:%v, want:nil", err)
+	}
+	for i, want := range []Vector{
+		{Kind: obj.Init, Addr: 0x1001, At: 0x1007},
+		{Kind: obj.Run, Addr: 0x1004, At: 0x1007},
+		{Kind: obj.NMI, Addr: 0xe000, At: 0x1002},
+	} {
+		if i >= len(img.Vectors) || *img.Vectors[i] != want {
+			t.Errorf("img.Vectors[%d]; got:%v, want:%+v", i, img.Vectors, want)
+		}
+	}
+	mods[0].Vectors = []*obj.Vector{{Kind: obj.Run, Symbol: "fn", AtSegment: "code"}}
+	if _, err := Link(mods, 0x1000); err == nil || !strings.Contains(err.Error(), "run address") {
+		t.Errorf("Link() with two run addresses; got:%v, want:run address error", err)
+	}
+}
@@ -0,0 +1,248 @@
+package link
+
+import (
+	"fmt"
+	"v65/obj"
+)
+
+// piece is where a segment of an input module ends up in the merged
+// module: in segment seg, at offset.
+type piece struct {
+	seg    *obj.Segment
+	offset int
+}
+
+// definition is a symbol of the merged module, with the segment it is
+// relative to, nil for a constant.
+type definition struct {
+	sym *obj.Symbol
+	seg *obj.Segment
+	mod string // The module that defined it.
+}
+
+// Partial links modules into a single relocatable module with the given
+// name, for a later link. The relocatable segments with the same name are
+// concatenated, in the order of the modules; absolute segments are kept
+// as they are. References between the modules are resolved: a reference
+// to a constant is patched, a reference to a label becomes a reference to
+// the merged segment. References to weak symbols, which a later module can
+// still override, and to symbols that none of the modules define are left
+// as relocations, and the latter stay imported. All exported symbols are
+// exported by the merged module.
+func Partial(mods []*obj.Module, name string) (*obj.Module, error) {
+	l := newLinker(mods)
+	out := &obj.Module{Name: name, Attributes: l.img.Attributes}
+
+	// Merge the segments.
+	pieces := make(map[*obj.Segment]piece)
+	merged := make(map[string]*obj.Segment)
+	owner := make(map[string]string)
+	for _, mod := range mods {
+		for _, seg := range mod.Segments {
+			if seg.Absolute {
+				copied := *seg
+				if merged[copied.Name] != nil {
+					copied.Name = fmt.Sprintf("%s@%04x", seg.Name, seg.Addr)
+				}
+				if merged[copied.Name] != nil {
+					l.errs.add("%s: segment %s already defined in %s", mod.Name, copied.Name, owner[copied.Name])
+					continue
+				}
+				copied.Code = append([]byte(nil), seg.Code...)
+				copied.Relocs, copied.Lines = nil, nil
+				merged[copied.Name], owner[copied.Name] = &copied, mod.Name
+				out.Segments = append(out.Segments, &copied)
+				pieces[seg] = piece{&copied, 0}
+				continue
+			}
+			m := merged[seg.Name]
+			switch {
+			case m == nil:
+				m = &obj.Segment{Name: seg.Name, Align: seg.Align, Bank: seg.Bank, Parent: seg.Parent}
+				merged[m.Name], owner[m.Name] = m, mod.Name
+				out.Segments = append(out.Segments, m)
+			case m.Absolute:
+				l.errs.add("%s: segment %s is absolute in %s", mod.Name, seg.Name, owner[m.Name])
+				continue
+			case m.Bank != seg.Bank:
+				l.errs.add("%s: segment %s is in bank %d, but in bank %d in %s", mod.Name, seg.Name, seg.Bank, m.Bank, owner[m.Name])
+				continue
+			case m.Parent != seg.Parent:
+				l.errs.add("%s: segment %s is part of %q, but of %q in %s", mod.Name, seg.Name, seg.Parent, m.Parent, owner[m.Name])
+				continue
+			}
+			offset := align(len(m.Code), seg.Align)
+			m.Code = append(m.Code, make([]byte, offset-len(m.Code))...)
+			m.Code = append(m.Code, seg.Code...)
+			if seg.Align > m.Align {
+				m.Align = seg.Align
+			}
+			pieces[seg] = piece{m, offset}
+		}
+	}
+
+	// Merge the exported symbols. As in a link, a weak symbol is
+	// overridden by a symbol that is not weak.
+	defs := make(map[string]*definition)
+	var names []string
+	for _, mod := range mods {
+		for _, sym := range mod.Symbols {
+			other, ok := defs[sym.Name]
+			if ok {
+				if sym.Weak {
+					continue
+				}
+				if !other.sym.Weak {
+					l.errs.add("%s: symbol %s already defined in %s", mod.Name, sym.Name, other.mod)
+					continue
+				}
+			}
+			exp := *sym
+			var seg *obj.Segment
+			if sym.Segment != "" {
+				p, ok := pieces[mod.Segment(sym.Segment)]
+				if !ok {
+					l.errs.add("%s: symbol %s is relative to unknown segment %s", mod.Name, sym.Name, sym.Segment)
+					continue
+				}
+				seg = p.seg
+				exp.Segment = seg.Name
+				exp.Value += int64(p.offset)
+			}
+			if !ok {
+				names = append(names, sym.Name)
+			}
+			defs[sym.Name] = &definition{&exp, seg, mod.Name}
+		}
+	}
+	for _, name := range names {
+		out.Symbols = append(out.Symbols, defs[name].sym)
+	}
+
+	// Move the relocations and the lines to the merged segments.
+	for _, mod := range mods {
+		for _, seg := range mod.Segments {
+			p, ok := pieces[seg]
+			if !ok {
+				continue
+			}
+			for _, line := range seg.Lines {
+				moved := *line
+				moved.Offset += p.offset
+				p.seg.Lines = append(p.seg.Lines, &moved)
+			}
+			for _, r := range seg.Relocs {
+				moved := *r
+				moved.Offset += p.offset
+				if l.partialReloc(mod, pieces, defs, p.seg, &moved) {
+					continue
+				}
+				p.seg.Relocs = append(p.seg.Relocs, &moved)
+			}
+		}
+	}
+
+	// Keep the imported symbols that are not resolved yet.
+	externs := make(map[string]*obj.Extern)
+	for _, mod := range mods {
+		for _, ext := range mod.Externs {
+			if def := defs[ext.Name]; def != nil && !def.sym.Weak && (def.seg == nil || !ext.ZeroPage) {
+				continue
+			}
+			if e, ok := externs[ext.Name]; ok {
+				e.ZeroPage = e.ZeroPage || ext.ZeroPage
+				continue
+			}
+			e := *ext
+			externs[e.Name] = &e
+			out.Externs = append(out.Externs, &e)
+		}
+	}
+
+	// Move the vectors. A program can only start at one address.
+	runIn := ""
+	for _, mod := range mods {
+		for _, v := range mod.Vectors {
+			moved := *v
+			at, ok := pieces[mod.Segment(v.AtSegment)]
+			if !ok {
+				l.errs.add("%s: vector defined in unknown segment %s", mod.Name, v.AtSegment)
+				continue
+			}
+			moved.AtSegment = at.seg.Name
+			moved.AtOffset += at.offset
+			if v.Segment != "" {
+				p, ok := pieces[mod.Segment(v.Segment)]
+				if !ok {
+					l.errs.add("%s: reference to unknown segment %s", mod.Name, v.Segment)
+					continue
+				}
+				moved.Segment = p.seg.Name
+				moved.Value += int64(p.offset)
+			}
+			if v.Kind == obj.Run {
+				if runIn != "" {
+					l.errs.add("%s: run address already defined in %s", mod.Name, runIn)
+					continue
+				}
+				runIn = mod.Name
+			}
+			out.Vectors = append(out.Vectors, &moved)
+		}
+	}
+	if err := l.errs.err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// partialReloc rewrites a relocation of module mod for the merged module,
+// and returns true if it was resolved and patched into seg, the merged
+// segment that holds it. A reference to a segment refers to the merged
+// segment, and a reference to a label that one of the modules exports
+// becomes one too.
+func (l *linker) partialReloc(mod *obj.Module, pieces map[*obj.Segment]piece, defs map[string]*definition, seg *obj.Segment, r *obj.Reloc) bool {
+	if r.Segment != "" {
+		p, ok := pieces[mod.Segment(r.Segment)]
+		if !ok {
+			l.errs.add("%s: reference to unknown segment %s", mod.Name, r.Segment)
+			return false
+		}
+		r.Segment = p.seg.Name
+		if r.Part != obj.Bank {
+			r.Addend += int64(p.offset)
+		}
+		return false
+	}
+	def, ok := defs[r.Symbol]
+	if !ok || def.sym.Weak {
+		return false
+	}
+	if def.seg != nil {
+		// The zero page check needs the final address.
+		if ext := mod.Extern(r.Symbol); ext != nil && ext.ZeroPage {
+			return false
+		}
+		r.Symbol, r.Segment = "", def.seg.Name
+		if r.Part != obj.Bank {
+			r.Addend += def.sym.Value
+		}
+		return false
+	}
+	if r.Part == obj.Bank {
+		l.errs.add("%s: %s is a constant, it has no bank", mod.Name, r.Symbol)
+		return true
+	}
+	value := def.sym.Value + r.Addend
+	if ext := mod.Extern(r.Symbol); ext != nil && ext.ZeroPage && (value < 0 || value > 0xff) {
+		l.errs.add("%s: symbol %s is not in the zero page: $%x", mod.Name, r.Symbol, value)
+		return true
+	}
+	value = part(value, r.Part)
+	if !fits(value, r.Size) {
+		l.errs.add("%s: value of %s does not fit in %d byte(s): $%x", mod.Name, r.Symbol, r.Size, value)
+		return true
+	}
+	seg.Patch(r.Offset, r.Size, value)
+	return true
+}
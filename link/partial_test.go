@@ -0,0 +1,113 @@
+package link
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"v65/obj"
+)
+
+// partialModules returns the test modules, where main also calls a routine
+// of a third module and starts at a label of its own.
+func partialModules() []*obj.Module {
+	mods := testModules(0xfb)
+	main := mods[1]
+	main.Segments[0].Code = append(main.Segments[0].Code, 0x20, 0, 0, 0x60) // jsr far; rts
+	main.Segments[0].Relocs = append(main.Segments[0].Relocs, &obj.Reloc{Offset: 6, Size: 2, Symbol: "far"})
+	main.Segments[0].Lines = []*obj.Line{{Offset: 2, Size: 3, File: "main.s", Line: 2}}
+	main.Externs = append(main.Externs, &obj.Extern{Name: "far"})
+	main.Vectors = []*obj.Vector{{Kind: obj.Run, Segment: "code", AtSegment: "code"}}
+	far := &obj.Module{
+		Name:     "far",
+		Segments: []*obj.Segment{{Name: "code", Code: []byte{0x60}}},
+		Symbols:  []*obj.Symbol{{Name: "far", Segment: "code"}},
+	}
+	return append(mods, far)
+}
+
+func TestPartial(t *testing.T) {
+	mods := partialModules()
+	mod, err := Partial(mods[:2], "sub")
+	if err != nil {
+		t.Fatalf("Partial(); got:%v, want:nil", err)
+	}
+	if len(mod.Segments) != 1 || len(mod.Externs) != 1 || mod.Externs[0].Name != "far" {
+		t.Fatalf("Partial(); got:%d segment(s), externs %v, want:1 segment, extern far", len(mod.Segments), mod.Externs)
+	}
+	seg := mod.Segments[0]
+	// lda ptr+1 is patched, jsr fn refers to the segment, jsr far is kept.
+	wantCode := []byte{0xea, 0x60, 0xa5, 0xfc, 0x20, 0x00, 0x00, 0x20, 0x00, 0x00, 0x60}
+	if !bytes.Equal(seg.Code, wantCode) {
+		t.Errorf("code; got:% x, want:% x", seg.Code, wantCode)
+	}
+	wantRelocs := []obj.Reloc{
+		{Offset: 5, Size: 2, Segment: "code", Addend: 1},
+		{Offset: 8, Size: 2, Symbol: "far"},
+	}
+	if len(seg.Relocs) != len(wantRelocs) {
+		t.Fatalf("relocs; got:%d, want:%d", len(seg.Relocs), len(wantRelocs))
+	}
+	for i, want := range wantRelocs {
+		if *seg.Relocs[i] != want {
+			t.Errorf("relocs[%d]; got:%+v, want:%+v", i, *seg.Relocs[i], want)
+		}
+	}
+	if len(mod.Symbols) != 2 || mod.Symbols[1].Name != "fn" || mod.Symbols[1].Value != 1 {
+		t.Errorf("symbols; got:%v, want:ptr and fn at 1", mod.Symbols)
+	}
+	if seg.Lines[0].Offset != 4 || mod.Vectors[0].Value != 2 || mod.Vectors[0].AtOffset != 2 {
+		t.Errorf("line and vector offsets; got:%d, %d, %d, want:4, 2, 2", seg.Lines[0].Offset, mod.Vectors[0].Value, mod.Vectors[0].AtOffset)
+	}
+
+	// Linking the merged module gives the same program as linking all.
+	img, err := Link([]*obj.Module{mod, mods[2]}, 0x1000)
+	if err != nil {
+		t.Fatalf("Link() of the merged module; got:%v, want:nil", err)
+	}
+	want, err := Link(partialModules(), 0x1000)
+	if err != nil {
+		t.Fatalf("Link(); got:%v, want:nil", err)
+	}
+	var got, all []byte
+	for _, p := range img.Placements {
+		got = append(got, p.Segment.Code...)
+	}
+	for _, p := range want.Placements {
+		all = append(all, p.Segment.Code...)
+	}
+	if !bytes.Equal(got, all) || img.Vectors[0].Addr != want.Vectors[0].Addr {
+		t.Errorf("Link() of the merged module; got:% x, want:% x", got, all)
+	}
+}
+
+func TestPartialErrors(t *testing.T) {
+	for _, tc := range []struct {
+		str    string
+		change func(mods []*obj.Module)
+		want   string
+	}{
+		{"duplicate symbol", func(mods []*obj.Module) {
+			mods[1].Symbols = []*obj.Symbol{{Name: "fn", Value: 1}}
+		}, "symbol fn already defined in lib"},
+		{"zero page", func(mods []*obj.Module) {
+			mods[0].Symbols[0].Value = 0xff
+		}, "symbol ptr is not in the zero page"},
+		{"bank", func(mods []*obj.Module) {
+			mods[1].Segments[0].Bank = 1
+		}, "segment code is in bank 1, but in bank 0 in lib"},
+		{"absolute", func(mods []*obj.Module) {
+			mods[0].Segments[0].Absolute = true
+		}, "segment code is absolute in lib"},
+		{"run", func(mods []*obj.Module) {
+			mods[0].Vectors = []*obj.Vector{{Kind: obj.Run, AtSegment: "code"}}
+		}, "run address already defined in lib"},
+	} {
+		println(tc.str)
+		mods := partialModules()
+		tc.change(mods)
+		_, err := Partial(mods, "sub")
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Partial(); got:%v, want:%s", err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package link
+
+import (
+	"v65/archive"
+	"v65/obj"
+)
+
+// Pull records that a module of a library was linked, because it exports
+// a symbol that another module imports.
+type Pull struct {
+	Symbol string
+	Module string // The library module that exports the symbol.
+	By     string // The module that imports the symbol.
+}
+
+// Select returns mods together with the modules of libs that are needed
+// to resolve their imported symbols, and why each library module was
+// selected. A selected module can need other library modules in turn.
+// The libraries are searched in order. Symbols that no library exports
+// are left for Link to report.
+func Select(mods []*obj.Module, libs []*archive.Archive) ([]*obj.Module, []*Pull) {
+	selected := append([]*obj.Module(nil), mods...)
+	defined := make(map[string]bool)
+	for _, mod := range mods {
+		for _, sym := range mod.Symbols {
+			defined[sym.Name] = true
+		}
+	}
+	indexes := make([]map[string]string, len(libs))
+	for i, lib := range libs {
+		indexes[i] = lib.Index()
+	}
+	var pulls []*Pull
+	for i := 0; i < len(selected); i++ {
+		mod := selected[i]
+		for _, ext := range mod.Externs {
+			if defined[ext.Name] {
+				continue
+			}
+			lib, name := find(libs, indexes, ext.Name)
+			if lib == nil {
+				continue
+			}
+			for _, m := range lib.Modules {
+				if m.Name != name {
+					continue
+				}
+				selected = append(selected, m)
+				for _, sym := range m.Symbols {
+					defined[sym.Name] = true
+				}
+			}
+			pulls = append(pulls, &Pull{Symbol: ext.Name, Module: name, By: mod.Name})
+		}
+	}
+	return selected, pulls
+}
+
+// find returns the first library that exports a symbol, and the name of
+// the module that exports it.
+func find(libs []*archive.Archive, indexes []map[string]string, symbol string) (*archive.Archive, string) {
+	for i, index := range indexes {
+		if name, ok := index[symbol]; ok {
+			return libs[i], name
+		}
+	}
+	return nil, ""
+}
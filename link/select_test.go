@@ -0,0 +1,68 @@
+package link
+
+import (
+	"testing"
+	"v65/archive"
+	"v65/obj"
+)
+
+// libModule returns a module that exports and imports symbols.
+func libModule(name string, exports []string, imports ...string) *obj.Module {
+	mod := &obj.Module{Name: name}
+	for _, sym := range exports {
+		mod.Symbols = append(mod.Symbols, &obj.Symbol{Name: sym})
+	}
+	for _, sym := range imports {
+		mod.Externs = append(mod.Externs, &obj.Extern{Name: sym})
+	}
+	return mod
+}
+
+func TestSelect(t *testing.T) {
+	math := &archive.Archive{Modules: []*obj.Module{
+		libModule("mul.s", []string{"mul8"}, "add8"),
+		libModule("add.s", []string{"add8"}),
+		libModule("div.s", []string{"div8"}),
+	}}
+	io := &archive.Archive{Modules: []*obj.Module{
+		libModule("print.s", []string{"print", "add8"}),
+	}}
+	main := libModule("main.s", []string{"start"}, "mul8", "print", "start", "missing")
+	mods, pulls := Select([]*obj.Module{main}, []*archive.Archive{math, io})
+	var names []string
+	for _, mod := range mods {
+		names = append(names, mod.Name)
+	}
+	for i, want := range []string{"main.s", "mul.s", "print.s"} {
+		if i >= len(names) || names[i] != want {
+			t.Errorf("modules[%d]; got:%v, want:%s", i, names, want)
+		}
+	}
+	if len(names) != 3 {
+		t.Errorf("len(modules); got:%d, want:3", len(names))
+	}
+	for i, want := range []Pull{
+		{Symbol: "mul8", Module: "mul.s", By: "main.s"},
+		{Symbol: "print", Module: "print.s", By: "main.s"},
+	} {
+		if i >= len(pulls) || *pulls[i] != want {
+			t.Errorf("pulls[%d]; got:%v, want:%+v", i, pulls, want)
+		}
+	}
+}
+
+func TestSelectClosure(t *testing.T) {
+	math := &archive.Archive{Modules: []*obj.Module{
+		libModule("mul.s", []string{"mul8"}, "add8"),
+		libModule("add.s", []string{"add8"}),
+	}}
+	main := libModule("main.s", nil, "mul8")
+	mods, pulls := Select([]*obj.Module{main}, []*archive.Archive{math})
+	if len(mods) != 3 {
+		t.Errorf("len(modules); got:%d, want:3", len(mods))
+	}
+	want := Pull{Symbol: "add8", Module: "add.s", By: "mul.s"}
+	if len(pulls) != 2 || *pulls[1] != want {
+		t.Errorf("pulls; got:%v, want:%+v last", pulls, want)
+	}
+}
@@ -0,0 +1,98 @@
+package link
+
+import "v65/obj"
+
+// Removed is a section that was dropped because nothing uses it.
+type Removed struct {
+	Module  string
+	Section string
+	Size    int
+}
+
+// Strip drops the sections that are not used. Segments that are not
+// sections are always used, and so are the targets of the vectors and the
+// sections that define the entry symbols. A used section or segment uses
+// the sections that its relocations refer to. The sections that are left
+// over are removed, together with the symbols they define. The modules
+// are copied, mods is not changed.
+func Strip(mods []*obj.Module, entries []string) ([]*obj.Module, []*Removed) {
+	// The segments that define each exported symbol. A weak symbol can
+	// have more than one definition, all of which are kept.
+	defs := make(map[string][]*obj.Segment)
+	owner := make(map[*obj.Segment]*obj.Module)
+	for _, mod := range mods {
+		for _, seg := range mod.Segments {
+			owner[seg] = mod
+		}
+		for _, sym := range mod.Symbols {
+			if seg := mod.Segment(sym.Segment); seg != nil {
+				defs[sym.Name] = append(defs[sym.Name], seg)
+			}
+		}
+	}
+
+	used := make(map[*obj.Segment]bool)
+	var work []*obj.Segment
+	use := func(seg *obj.Segment) {
+		if seg != nil && !used[seg] {
+			used[seg] = true
+			work = append(work, seg)
+		}
+	}
+	for _, mod := range mods {
+		for _, seg := range mod.Segments {
+			if seg.Parent == "" {
+				use(seg)
+			}
+		}
+		for _, v := range mod.Vectors {
+			use(mod.Segment(v.Segment))
+			use(mod.Segment(v.AtSegment))
+			for _, seg := range defs[v.Symbol] {
+				use(seg)
+			}
+		}
+	}
+	for _, name := range entries {
+		for _, seg := range defs[name] {
+			use(seg)
+		}
+	}
+	for len(work) > 0 {
+		seg := work[len(work)-1]
+		work = work[:len(work)-1]
+		mod := owner[seg]
+		for _, r := range seg.Relocs {
+			if r.Segment != "" {
+				use(mod.Segment(r.Segment))
+				continue
+			}
+			for _, def := range defs[r.Symbol] {
+				use(def)
+			}
+		}
+	}
+
+	// Copy the modules without the sections that are not used.
+	var out []*obj.Module
+	var removed []*Removed
+	for _, mod := range mods {
+		stripped := *mod
+		stripped.Segments = nil
+		stripped.Symbols = nil
+		for _, seg := range mod.Segments {
+			if used[seg] {
+				stripped.Segments = append(stripped.Segments, seg)
+				continue
+			}
+			removed = append(removed, &Removed{Module: mod.Name, Section: seg.Name, Size: len(seg.Code)})
+		}
+		for _, sym := range mod.Symbols {
+			if seg := mod.Segment(sym.Segment); seg == nil || used[seg] {
+				stripped.Symbols = append(stripped.Symbols, sym)
+			}
+		}
+		out = append(out, &stripped)
+	}
+	return out, removed
+}
@@ -0,0 +1,79 @@
+package link
+
+import (
+	"testing"
+	"v65/obj"
+)
+
+// stripModules returns a program that uses one routine of a library with
+// three routines, each in a section of its own.
+func stripModules() []*obj.Module {
+	return []*obj.Module{
+		{
+			Name: "main",
+			Segments: []*obj.Segment{{
+				Name:   "code",
+				Code:   []byte{0x20, 0, 0, 0x60}, // jsr mul; rts
+				Relocs: []*obj.Reloc{{Offset: 1, Size: 2, Symbol: "mul"}},
+			}},
+			Externs: []*obj.Extern{{Name: "mul"}},
+		},
+		{
+			Name: "lib",
+			Segments: []*obj.Segment{
+				{Name: "code"},
+				{
+					Name:   "code:mul",
+					Parent: "code",
+					Code:   []byte{0x4c, 0, 0}, // jmp add
+					Relocs: []*obj.Reloc{{Offset: 1, Size: 2, Segment: "code:add"}},
+				},
+				{Name: "code:add", Parent: "code", Code: []byte{0x60}},
+				{Name: "code:div", Parent: "code", Code: make([]byte, 10)},
+				{Name: "code:irq", Parent: "code", Code: []byte{0x40}},
+			},
+			Symbols: []*obj.Symbol{
+				{Name: "mul", Segment: "code:mul"},
+				{Name: "div", Segment: "code:div"},
+				{Name: "irq", Segment: "code:irq"},
+			},
+			Vectors: []*obj.Vector{{Kind: obj.IRQ, Symbol: "irq", AtSegment: "code"}},
+		},
+	}
+}
+
+func TestStrip(t *testing.T) {
+	for _, tc := range []struct {
+		entries     []string
+		wantRemoved []Removed
+	}{
+		{nil, []Removed{{Module: "lib", Section: "code:div", Size: 10}}},
+		{[]string{"div"}, nil},
+	} {
+		mods := stripModules()
+		stripped, removed := Strip(mods, tc.entries)
+		if len(removed) != len(tc.wantRemoved) {
+			t.Errorf("Strip(%v) removed; got:%v, want:%v", tc.entries, removed, tc.wantRemoved)
+			continue
+		}
+		for i, want := range tc.wantRemoved {
+			if *removed[i] != want {
+				t.Errorf("Strip(%v) removed[%d]; got:%+v, want:%+v", tc.entries, i, removed[i], want)
+			}
+		}
+		if len(mods[1].Segments) != 5 {
+			t.Errorf("Strip(%v) changed the modules", tc.entries)
+		}
+		img, err := Link(stripped, 0x1000)
+		if err != nil {
+			t.Errorf("Link() after Strip(%v); got:%v, want:nil", tc.entries, err)
+			continue
+		}
+		if _, ok := img.Symbols["div"]; ok != (len(tc.wantRemoved) == 0) {
+			t.Errorf("img.Symbols[div] after Strip(%v); got:%v, want:%v", tc.entries, ok, !ok)
+		}
+		if img.Symbols["mul"] != 0x1004 {
+			t.Errorf("img.Symbols[mul] after Strip(%v); got:$%x, want:$1004", tc.entries, img.Symbols["mul"])
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package link
+
+import "v65/obj"
+
+// trampolineName is the name of the segment with the trampolines.
+const trampolineName = "trampolines"
+
+// Opcodes of the instructions that trampolines use.
+const (
+	opJSR = 0x20
+	opJMP = 0x4c
+	opRTS = 0x60
+)
+
+// trampolineKey identifies a trampoline. Calls from the same bank to the
+// same address in the same bank share a trampoline.
+type trampolineKey struct {
+	target int64
+	bank   int // The bank of the target.
+	from   int // The bank of the caller.
+	call   bool
+}
+
+// trampolines generates a trampoline for every jsr or jmp from one
+// switchable bank to another, and redirects the calls to them. The
+// trampolines are placed after the segments in the area of the rule.
+func (l *linker) trampolines() {
+	rule := l.cfg.Trampolines
+	area := l.cfg.Area(rule.Area)
+	start := l.next[area.Name]
+	seg := &obj.Segment{Name: trampolineName}
+	shared := make(map[trampolineKey]int)
+	for i, p := range l.img.Placements {
+		mod, from := l.owners[i], l.segs[i]
+		for _, r := range p.Segment.Relocs {
+			if !r.Call || r.Part != obj.All || r.Size != 2 || !l.crossBank(mod, from, r) {
+				continue
+			}
+			value, ok := l.lookup(mod, r.Symbol, r.Segment)
+			if !ok {
+				// Reported when the relocations are applied.
+				continue
+			}
+			key := trampolineKey{
+				target: value + r.Addend,
+				bank:   l.banks[l.target(mod, r)],
+				from:   l.banks[from],
+				call:   r.Offset > 0 && p.Segment.Code[r.Offset-1] == opJSR,
+			}
+			addr, ok := shared[key]
+			if !ok {
+				addr = start + len(seg.Code)
+				seg.Code = append(seg.Code, trampoline(rule, key)...)
+				shared[key] = addr
+			}
+			l.redirect[r] = addr
+		}
+	}
+	if len(seg.Code) == 0 {
+		return
+	}
+	if over := start + len(seg.Code) - area.End(); over > 0 {
+		l.errs.add("trampolines overflow memory area %s by %d byte(s)", area.Name, over)
+	}
+	l.next[area.Name] = start + len(seg.Code)
+	l.place(&obj.Module{Name: linkerModule, Segments: []*obj.Segment{seg}}, seg, start, start, area)
+}
+
+// trampoline returns the code of a trampoline. A trampoline for a jsr
+// switches to the bank of the target, calls it, switches back to the bank
+// of the caller and returns. A trampoline for a jmp does not come back.
+func trampoline(rule *TrampolineRule, key trampolineKey) []byte {
+	code := switchBank(nil, rule.Switch, key.bank)
+	op := byte(opJMP)
+	if key.call {
+		op = opJSR
+	}
+	// The 6502 reads the target low byte first.
+	code = append(code, op, byte(key.target), byte(key.target>>8))
+	if !key.call {
+		return code
+	}
+	code = switchBank(code, rule.Switch, key.from)
+	return append(code, opRTS)
+}
+
+// switchBank appends the code that switches to a bank.
+func switchBank(code []byte, template []int, bank int) []byte {
+	for _, b := range template {
+		if b < 0 {
+			b = bank
+		}
+		code = append(code, byte(b))
+	}
+	return code
+}
@@ -0,0 +1,59 @@
+package link
+
+import (
+	"strings"
+	"testing"
+	"v65/obj"
+)
+
+func TestTrampolines(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(bankConfig + "trampoline memory=FIXED switch=$a9,bank,$8d,$00,$80\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig(); got:%v, want:nil", err)
+	}
+	mods := bankModules()
+	zero := mods[0].Segments[3]
+	zero.Code = []byte{0x20, 0, 0, 0x20, 0, 0, 0x4c, 0, 0} // jsr fn; jsr fn; jmp fn
+	zero.Relocs = []*obj.Reloc{
+		{Offset: 1, Size: 2, Symbol: "fn", Call: true},
+		{Offset: 4, Size: 2, Symbol: "fn", Call: true},
+		{Offset: 7, Size: 2, Symbol: "fn", Call: true},
+	}
+	img, err := LinkConfig(mods, cfg)
+	if err != nil {
+		t.Fatalf("LinkConfig(); got:%v, want:nil", err)
+	}
+	// The fixed code is 5 bytes, so the trampolines start at $c005.
+	want := []byte{0x20, 0x05, 0xc0, 0x20, 0x05, 0xc0, 0x4c, 0x13, 0xc0}
+	for i, b := range want {
+		if got := img.Placements[2].Segment.Code[i]; got != b {
+			t.Errorf("code[%d]; got:$%x, want:$%x", i, got, b)
+		}
+	}
+	p := img.Placements[len(img.Placements)-1]
+	if p.Segment.Name != trampolineName || p.Addr != 0xc005 || p.Area != "FIXED" {
+		t.Fatalf("last placement; got:%s at $%x in %s, want:trampolines at $c005 in FIXED", p.Segment.Name, p.Addr, p.Area)
+	}
+	want = []byte{
+		0xa9, 0x01, 0x8d, 0x00, 0x80, 0x20, 0x01, 0x80, 0xa9, 0x00, 0x8d, 0x00, 0x80, 0x60, // jsr
+		0xa9, 0x01, 0x8d, 0x00, 0x80, 0x4c, 0x01, 0x80, // jmp
+	}
+	if string(p.Segment.Code) != string(want) {
+		t.Errorf("trampolines; got:% x, want:% x", p.Segment.Code, want)
+	}
+	if run, size := img.Symbols["__trampolines_run__"], img.Symbols["__trampolines_size__"]; run != 0xc005 || size != int64(len(want)) {
+		t.Errorf("__trampolines_run__, __trampolines_size__; got:$%x, %d, want:$c005, %d", run, size, len(want))
+	}
+}
+
+func TestTrampolinesOverflow(t *testing.T) {
+	config := strings.Replace(bankConfig, "size=$4000\n", "size=8\n", 1)
+	cfg, err := ParseConfig(strings.NewReader(config + "trampoline memory=FIXED switch=$a9,bank,$8d,$00,$80\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig(); got:%v, want:nil", err)
+	}
+	_, err = LinkConfig(bankModules(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "trampolines overflow memory area FIXED by 11 byte(s)") {
+		t.Errorf("LinkConfig(); got:%v, want:overflow error", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Package mapfile writes the map of a linked image: where every segment
+// and symbol ended up, and how much of every memory area is used.
+package mapfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"v65/link"
+)
+
+// Segment is a placed segment of a module.
+type Segment struct {
+	Module string `json:"module"`
+	Name   string `json:"name"`
+	Addr   int    `json:"addr"`
+	Load   int    `json:"load"`
+	Size   int    `json:"size"`
+	Area   string `json:"area,omitempty"`
+}
+
+// Symbol is an exported symbol with its final value.
+type Symbol struct {
+	Name   string `json:"name"`
+	Value  int64  `json:"value"`
+	Module string `json:"module"` // The module that defines it.
+}
+
+// Usage is the usage of a memory area.
+type Usage struct {
+	Area    string `json:"area"`
+	Start   int    `json:"start"`
+	Size    int    `json:"size"`
+	Used    int    `json:"used"`
+	Free    int    `json:"free"`
+	Largest int    `json:"largest_gap"` // The size of the largest free range.
+}
+
+// Map is the map of a linked image.
+type Map struct {
+	Segments []*Segment `json:"segments"`
+	Symbols  []*Symbol  `json:"symbols"`
+	Areas    []*Usage   `json:"areas,omitempty"`
+}
+
+// New returns the map of an image. The segments are sorted by module, the
+// symbols by name. The usage of the memory areas is only computed if cfg
+// is not nil.
+func New(img *link.Image, cfg *link.Config) *Map {
+	m := &Map{Segments: []*Segment{}, Symbols: []*Symbol{}}
+	for _, p := range img.Placements {
+		m.Segments = append(m.Segments, &Segment{
+			Module: p.Module,
+			Name:   p.Segment.Name,
+			Addr:   p.Addr,
+			Load:   p.Load,
+			Size:   len(p.Segment.Code),
+			Area:   p.Area,
+		})
+	}
+	sort.SliceStable(m.Segments, func(i, j int) bool {
+		return m.Segments[i].Module < m.Segments[j].Module
+	})
+	for name, value := range img.Symbols {
+		m.Symbols = append(m.Symbols, &Symbol{Name: name, Value: value, Module: img.Defined[name]})
+	}
+	sort.Slice(m.Symbols, func(i, j int) bool {
+		return m.Symbols[i].Name < m.Symbols[j].Name
+	})
+	if cfg != nil {
+		for _, a := range cfg.Areas {
+			m.Areas = append(m.Areas, usage(img, a))
+		}
+	}
+	return m
+}
+
+// usage computes the usage of an area. A segment uses the area if it is
+// loaded or runs in it, and for a switchable area, if it is in its bank.
+func usage(img *link.Image, a *link.Area) *Usage {
+	used := make([]bool, a.Size)
+	mark := func(addr, size int) {
+		for i := addr; i < addr+size; i++ {
+			if i >= a.Start && i < a.End() {
+				used[i-a.Start] = true
+			}
+		}
+	}
+	for _, p := range img.Placements {
+		if a.Bank >= 0 && p.Segment.Bank != a.Bank {
+			continue
+		}
+		mark(p.Load, len(p.Segment.Code))
+		if p.Addr != p.Load {
+			mark(p.Addr, len(p.Segment.Code))
+		}
+	}
+	u := &Usage{Area: a.Name, Start: a.Start, Size: a.Size}
+	gap := 0
+	for _, b := range used {
+		if b {
+			u.Used++
+			gap = 0
+			continue
+		}
+		gap++
+		if gap > u.Largest {
+			u.Largest = gap
+		}
+	}
+	u.Free = a.Size - u.Used
+	return u
+}
+
+// Write writes a map as text.
+func Write(w io.Writer, m *Map) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "Segments:")
+	for _, s := range m.Segments {
+		fmt.Fprintf(bw, "  %-16s %-16s $%04x %5d", s.Module, s.Name, s.Addr, s.Size)
+		if s.Load != s.Addr {
+			fmt.Fprintf(bw, " load $%04x", s.Load)
+		}
+		if s.Area != "" {
+			fmt.Fprintf(bw, " %s", s.Area)
+		}
+		fmt.Fprintln(bw)
+	}
+	fmt.Fprintln(bw, "\nSymbols:")
+	for _, s := range m.Symbols {
+		fmt.Fprintf(bw, "  %-24s $%04x %s\n", s.Name, s.Value, s.Module)
+	}
+	if len(m.Areas) > 0 {
+		fmt.Fprintln(bw, "\nMemory areas:")
+		for _, u := range m.Areas {
+			fmt.Fprintf(bw, "  %-16s $%04x-$%04x used %5d free %5d largest gap %5d\n",
+				u.Area, u.Start, u.Start+u.Size-1, u.Used, u.Free, u.Largest)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteJSON writes a map as JSON.
+func WriteJSON(w io.Writer, m *Map) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
@@ -0,0 +1,118 @@
+package mapfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"v65/link"
+	"v65/obj"
+)
+
+// testMap links a library and a main module with a memory map that has a
+// hole in ROM and data that is copied to RAM.
+func testMap(t *testing.T) *Map {
+	cfg, err := link.ParseConfig(strings.NewReader(`
+memory RAM start=$0200 size=$10
+memory ROM start=$8000 size=$20
+segment code memory=ROM
+segment vectors memory=ROM align=16
+segment data load=ROM run=RAM
+`))
+	if err != nil {
+		t.Fatalf("link.ParseConfig(); got:%v, want:nil", err)
+	}
+	mods := []*obj.Module{
+		{
+			Name:     "main",
+			Segments: []*obj.Segment{{Name: "code", Code: make([]byte, 4)}},
+			Symbols:  []*obj.Symbol{{Name: "start", Segment: "code"}},
+		},
+		{
+			Name: "lib",
+			Segments: []*obj.Segment{
+				{Name: "vectors", Code: make([]byte, 6)},
+				{Name: "data", Code: make([]byte, 3)},
+			},
+			Symbols: []*obj.Symbol{{Name: "buf", Segment: "data", Value: 1}},
+		},
+	}
+	img, err := link.LinkConfig(mods, cfg)
+	if err != nil {
+		t.Fatalf("link.LinkConfig(); got:%v, want:nil", err)
+	}
+	return New(img, cfg)
+}
+
+func TestNew(t *testing.T) {
+	m := testMap(t)
+	segs := []Segment{
+		{Module: "lib", Name: "vectors", Addr: 0x8010, Load: 0x8010, Size: 6, Area: "ROM"},
+		{Module: "lib", Name: "data", Addr: 0x0200, Load: 0x8016, Size: 3, Area: "ROM"},
+		{Module: "main", Name: "code", Addr: 0x8000, Load: 0x8000, Size: 4, Area: "ROM"},
+	}
+	if len(m.Segments) != len(segs) {
+		t.Fatalf("len(m.Segments); got:%d, want:%d", len(m.Segments), len(segs))
+	}
+	for i, want := range segs {
+		if *m.Segments[i] != want {
+			t.Errorf("m.Segments[%d]; got:%+v, want:%+v", i, m.Segments[i], want)
+		}
+	}
+	syms := make(map[string]Symbol)
+	for _, s := range m.Symbols {
+		syms[s.Name] = *s
+	}
+	for _, want := range []Symbol{
+		{Name: "buf", Value: 0x0201, Module: "lib"},
+		{Name: "start", Value: 0x8000, Module: "main"},
+		{Name: "__data_load__", Value: 0x8016, Module: "linker"},
+	} {
+		if got := syms[want.Name]; got != want {
+			t.Errorf("symbol %s; got:%+v, want:%+v", want.Name, got, want)
+		}
+	}
+	areas := []Usage{
+		{Area: "RAM", Start: 0x0200, Size: 0x10, Used: 3, Free: 13, Largest: 13},
+		{Area: "ROM", Start: 0x8000, Size: 0x20, Used: 13, Free: 19, Largest: 12},
+	}
+	if len(m.Areas) != len(areas) {
+		t.Fatalf("len(m.Areas); got:%d, want:%d", len(m.Areas), len(areas))
+	}
+	for i, want := range areas {
+		if *m.Areas[i] != want {
+			t.Errorf("m.Areas[%d]; got:%+v, want:%+v", i, m.Areas[i], want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testMap(t)); err != nil {
+		t.Fatalf("Write(); got:%v, want:nil", err)
+	}
+	for _, want := range []string{
+		"lib              data             $0200     3 load $8016 ROM\n",
+		"buf                      $0201 lib\n",
+		"ROM              $8000-$801f used    13 free    19 largest gap    12\n",
+	} {
+		println(want)
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Write(); got:%q, want:%q", buf.String(), want)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, testMap(t)); err != nil {
+		t.Fatalf("WriteJSON(); got:%v, want:nil", err)
+	}
+	var m Map
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("json.Unmarshal(); got:%v, want:nil", err)
+	}
+	if len(m.Areas) != 2 || m.Areas[1].Largest != 12 || m.Areas[1].Free != 19 {
+		t.Errorf("areas; got:%v, want:ROM with 19 free bytes and a gap of 12", m.Areas)
+	}
+}
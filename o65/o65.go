@@ -0,0 +1,457 @@
+// Package o65 reads and writes object modules in the o65 format, the
+// relocatable format of 6502 operating systems and loaders like GeckOS
+// and LUnix.
+//
+// An o65 file has four segments: text, data, bss and zero page. The
+// segments of a module named data, bss and zp (or zeropage) go to the
+// segment with the same name, all others to text. Only text and data have
+// contents, bss and zero page only have a size. The relocation tables
+// refer to the segments by number, or to an imported symbol by its index
+// in the list of undefined references. Like everything in the format, the
+// words in the code are stored low byte first.
+//
+// Vectors, attributes, lines, weak symbols, zero page imports and calls
+// have no place in the format and are not written. Absolute segments and
+// banks cannot be written.
+package o65
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"v65/obj"
+)
+
+// Magic starts every o65 file: a marker, "o65" and the version.
+var Magic = []byte{0x01, 0x00, 'o', '6', '5', 0x00}
+
+// Bits of the mode word of the header.
+const (
+	modeObject = 0x1000 // An object file, not an executable.
+	modeAlign  = 0x0003 // The alignment of the segments.
+)
+
+// Segment numbers.
+const (
+	segUndefined = 0
+	segAbsolute  = 1
+	segText      = 2
+	segData      = 3
+	segBSS       = 4
+	segZero      = 5
+)
+
+// Relocation types, in the high nibble of the type byte.
+const (
+	relocWord = 0x80
+	relocHigh = 0x40
+	relocLow  = 0x20
+)
+
+// Header options.
+const (
+	optFilename  = 0
+	optAssembler = 2
+)
+
+// names are the names of the segments of a module that is read, indexed
+// by segment number.
+var names = [...]string{segText: "code", segData: "data", segBSS: "bss", segZero: "zp"}
+
+// alignments are the alignments that the mode word can hold.
+var alignments = [...]int{1, 2, 4, 256}
+
+// kind returns the number of the o65 segment for a segment of a module.
+func kind(seg *obj.Segment) int {
+	switch seg.Group() {
+	case "data":
+		return segData
+	case "bss":
+		return segBSS
+	case "zp", "zeropage":
+		return segZero
+	}
+	return segText
+}
+
+// piece is where a segment of the module ends up: in o65 segment kind, at
+// offset.
+type piece struct {
+	kind   int
+	offset int
+}
+
+// reloc is a relocation of an o65 segment.
+type reloc struct {
+	offset int
+	typ    byte
+	seg    int
+	index  int  // The index of the undefined reference.
+	low    byte // The low byte of the value of a high byte relocation.
+}
+
+// Write writes a module as an o65 object file.
+func Write(w io.Writer, mod *obj.Module) error {
+	var code [segZero + 1][]byte
+	pieces := make(map[string]piece)
+	align := 1
+	for _, seg := range mod.Segments {
+		if seg.Absolute {
+			return fmt.Errorf("%s: absolute segment %s cannot be written in o65", mod.Name, seg.Name)
+		}
+		if seg.Bank != 0 {
+			return fmt.Errorf("%s: segment %s is in bank %d, o65 has no banks", mod.Name, seg.Name, seg.Bank)
+		}
+		k := kind(seg)
+		offset := len(code[k])
+		if seg.Align > 1 {
+			offset = (offset + seg.Align - 1) &^ (seg.Align - 1)
+		}
+		if seg.Align > align {
+			align = seg.Align
+		}
+		code[k] = append(code[k], make([]byte, offset-len(code[k]))...)
+		code[k] = append(code[k], seg.Code...)
+		pieces[seg.Name] = piece{k, offset}
+	}
+	mode := 0
+	for mode < len(alignments)-1 && alignments[mode] < align {
+		mode++
+	}
+	if align > alignments[mode] {
+		return fmt.Errorf("%s: alignment %d is larger than a page", mod.Name, align)
+	}
+
+	// Fill in the values of the relocations, relative to the segments.
+	undefined := make(map[string]int)
+	for i, ext := range mod.Externs {
+		undefined[ext.Name] = i
+	}
+	var relocs [segData + 1][]*reloc
+	for _, seg := range mod.Segments {
+		p := pieces[seg.Name]
+		for _, r := range seg.Relocs {
+			if p.kind == segBSS || p.kind == segZero {
+				return fmt.Errorf("%s: segment %s has no contents, but relocations", mod.Name, seg.Name)
+			}
+			out := &reloc{offset: p.offset + r.Offset, seg: segUndefined}
+			value := r.Addend
+			switch {
+			case r.Segment != "":
+				target, ok := pieces[r.Segment]
+				if !ok {
+					return fmt.Errorf("%s: reference to unknown segment %s", mod.Name, r.Segment)
+				}
+				out.seg = target.kind
+				value += int64(target.offset)
+			default:
+				index, ok := undefined[r.Symbol]
+				if !ok {
+					return fmt.Errorf("%s: symbol %s is not imported", mod.Name, r.Symbol)
+				}
+				out.index = index
+			}
+			switch {
+			case r.Size == 2 && r.Part == obj.All:
+				out.typ = relocWord
+			case r.Size == 1 && (r.Part == obj.All || r.Part == obj.Low):
+				out.typ = relocLow
+				value &= 0xff
+			case r.Size == 1 && r.Part == obj.High:
+				out.typ = relocHigh
+				out.low = byte(value)
+				value = (value >> 8) & 0xff
+			default:
+				return fmt.Errorf("%s: relocation of %d byte(s), part %d, cannot be written in o65", mod.Name, r.Size, r.Part)
+			}
+			put(code[p.kind], out.offset, r.Size, value)
+			relocs[p.kind] = append(relocs[p.kind], out)
+		}
+	}
+	for _, rs := range relocs {
+		sort.Slice(rs, func(i, j int) bool { return rs[i].offset < rs[j].offset })
+	}
+	for _, k := range []int{segBSS, segZero} {
+		for _, b := range code[k] {
+			if b != 0 {
+				return fmt.Errorf("%s: segment %s has no contents, but code", mod.Name, names[k])
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(Magic)
+	words := []int{
+		modeObject | mode,
+		0, len(code[segText]),
+		0, len(code[segData]),
+		0, len(code[segBSS]),
+		0, len(code[segZero]),
+		0, // The stack size.
+	}
+	for _, v := range words {
+		if v > 0xffff {
+			return fmt.Errorf("%s: segment is larger than 64K", mod.Name)
+		}
+		binary.Write(bw, binary.LittleEndian, uint16(v))
+	}
+	writeOption(bw, optFilename, mod.Name)
+	writeOption(bw, optAssembler, "v65")
+	bw.WriteByte(0)
+	bw.Write(code[segText])
+	bw.Write(code[segData])
+
+	binary.Write(bw, binary.LittleEndian, uint16(len(mod.Externs)))
+	for _, ext := range mod.Externs {
+		bw.WriteString(ext.Name)
+		bw.WriteByte(0)
+	}
+	for _, rs := range relocs[segText:] {
+		writeRelocs(bw, rs)
+	}
+
+	binary.Write(bw, binary.LittleEndian, uint16(len(mod.Symbols)))
+	for _, sym := range mod.Symbols {
+		seg, value := segAbsolute, sym.Value
+		if sym.Segment != "" {
+			p, ok := pieces[sym.Segment]
+			if !ok {
+				return fmt.Errorf("%s: symbol %s is relative to unknown segment %s", mod.Name, sym.Name, sym.Segment)
+			}
+			seg, value = p.kind, value+int64(p.offset)
+		}
+		if value < 0 || value > 0xffff {
+			return fmt.Errorf("%s: value of %s does not fit in 2 bytes: $%x", mod.Name, sym.Name, value)
+		}
+		bw.WriteString(sym.Name)
+		bw.WriteByte(0)
+		bw.WriteByte(byte(seg))
+		binary.Write(bw, binary.LittleEndian, uint16(value))
+	}
+	return bw.Flush()
+}
+
+// put stores a value of size bytes at offset in code, low byte first.
+func put(code []byte, offset, size int, value int64) {
+	for i := 0; i < size; i++ {
+		code[offset+i] = byte(value >> uint(8*i))
+	}
+}
+
+// writeOption writes a header option with a text.
+func writeOption(w *bufio.Writer, typ byte, text string) {
+	if len(text)+3 > 0xff {
+		text = text[:0xff-3]
+	}
+	w.WriteByte(byte(len(text) + 3))
+	w.WriteByte(typ)
+	w.WriteString(text)
+	w.WriteByte(0)
+}
+
+// writeRelocs writes a relocation table. Every entry starts with the
+// distance to the previous one, the first one to the byte before the
+// segment. A distance of 255 means 254 and another distance follows.
+func writeRelocs(w *bufio.Writer, relocs []*reloc) {
+	prev := -1
+	for _, r := range relocs {
+		d := r.offset - prev
+		for ; d > 254; d -= 254 {
+			w.WriteByte(255)
+		}
+		w.WriteByte(byte(d))
+		w.WriteByte(r.typ | byte(r.seg))
+		if r.seg == segUndefined {
+			binary.Write(w, binary.LittleEndian, uint16(r.index))
+		}
+		if r.typ == relocHigh {
+			w.WriteByte(r.low)
+		}
+		prev = r.offset
+	}
+	w.WriteByte(0)
+}
+
+// reader reads the parts of an o65 file, and keeps the first error.
+type reader struct {
+	r   *bufio.Reader
+	err error
+}
+
+// byte reads a byte.
+func (r *reader) byte() int {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.r.ReadByte()
+	if err != nil {
+		r.err = io.ErrUnexpectedEOF
+	}
+	return int(b)
+}
+
+// word reads a word in little endian order.
+func (r *reader) word() int {
+	low := r.byte()
+	return low | r.byte()<<8
+}
+
+// bytes reads n bytes.
+func (r *reader) bytes(n int) []byte {
+	b := make([]byte, n)
+	if r.err == nil {
+		if _, err := io.ReadFull(r.r, b); err != nil {
+			r.err = io.ErrUnexpectedEOF
+		}
+	}
+	return b
+}
+
+// string reads a string that ends with a zero byte.
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	s, err := r.r.ReadString(0)
+	if err != nil {
+		r.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	return s[:len(s)-1]
+}
+
+// Read reads a module from an o65 object file. The name of the module is
+// the file name in the header, or o65 if there is none. The segments are
+// named code, data, bss and zp; empty ones are left out.
+func Read(rd io.Reader) (*obj.Module, error) {
+	r := &reader{r: bufio.NewReader(rd)}
+	if !bytes.Equal(r.bytes(len(Magic)), Magic) {
+		return nil, fmt.Errorf("not an o65 file")
+	}
+	mode := r.word()
+	if mode&^(modeObject|modeAlign) != 0 {
+		return nil, fmt.Errorf("unsupported o65 mode $%04x", mode)
+	}
+	var bases, sizes [segZero + 1]int
+	for k := segText; k <= segZero; k++ {
+		bases[k], sizes[k] = r.word(), r.word()
+	}
+	r.word() // The stack size.
+	mod := &obj.Module{Name: "o65"}
+	for {
+		n := r.byte()
+		if n == 0 || r.err != nil {
+			break
+		}
+		if n < 2 {
+			return nil, fmt.Errorf("invalid o65 header option")
+		}
+		typ, data := r.byte(), r.bytes(n-2)
+		if typ == optFilename && len(data) > 1 {
+			mod.Name = string(bytes.TrimRight(data, "\x00"))
+		}
+	}
+
+	segs := make([]*obj.Segment, segZero+1)
+	for k := segText; k <= segZero; k++ {
+		segs[k] = &obj.Segment{Name: names[k], Align: alignments[mode&modeAlign]}
+		if k == segText || k == segData {
+			segs[k].Code = r.bytes(sizes[k])
+		} else {
+			segs[k].Code = make([]byte, sizes[k])
+		}
+	}
+	for i, n := 0, r.word(); i < n && r.err == nil; i++ {
+		mod.Externs = append(mod.Externs, &obj.Extern{Name: r.string()})
+	}
+	for _, k := range []int{segText, segData} {
+		if err := readRelocs(r, mod, segs, bases, k); err != nil {
+			return nil, err
+		}
+	}
+	for i, n := 0, r.word(); i < n && r.err == nil; i++ {
+		sym := &obj.Symbol{Name: r.string()}
+		k, value := r.byte(), r.word()
+		switch {
+		case k == segAbsolute:
+			sym.Value = int64(value)
+		case k >= segText && k <= segZero:
+			sym.Segment, sym.Value = names[k], int64(value-bases[k])
+		default:
+			return nil, fmt.Errorf("symbol %s in unknown segment %d", sym.Name, k)
+		}
+		mod.Symbols = append(mod.Symbols, sym)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("truncated o65 file")
+	}
+	for _, seg := range segs[segText:] {
+		if len(seg.Code) > 0 {
+			mod.Segments = append(mod.Segments, seg)
+		}
+	}
+	return mod, nil
+}
+
+// readRelocs reads the relocation table of segment k. The values of the
+// relocations are taken out of the code and become the addends.
+func readRelocs(r *reader, mod *obj.Module, segs []*obj.Segment, bases [segZero + 1]int, k int) error {
+	seg := segs[k]
+	offset := -1
+	for r.err == nil {
+		d := r.byte()
+		if d == 0 {
+			return nil
+		}
+		if d == 255 {
+			offset += 254
+			continue
+		}
+		offset += d
+		typ := r.byte()
+		out := &obj.Reloc{Offset: offset}
+		target := typ & 0x0f
+		if target == segUndefined {
+			index := r.word()
+			if index >= len(mod.Externs) {
+				return fmt.Errorf("relocation of undefined reference %d", index)
+			}
+			out.Symbol = mod.Externs[index].Name
+		}
+		var value int64
+		switch typ & 0xf0 {
+		case relocWord:
+			out.Size = 2
+		case relocLow:
+			out.Size, out.Part = 1, obj.Low
+		case relocHigh:
+			out.Size, out.Part = 1, obj.High
+		default:
+			return fmt.Errorf("unsupported o65 relocation type $%02x", typ)
+		}
+		if offset+out.Size > len(seg.Code) {
+			return fmt.Errorf("relocation outside segment %s", seg.Name)
+		}
+		for i := 0; i < out.Size; i++ {
+			value |= int64(seg.Code[offset+i]) << uint(8*i)
+		}
+		if out.Part == obj.High {
+			value = value<<8 | int64(r.byte())
+		}
+		switch {
+		case target == segUndefined:
+		case target >= segText && target <= segZero:
+			out.Segment = names[target]
+			value -= int64(bases[target])
+		default:
+			return fmt.Errorf("relocation to unknown segment %d", target)
+		}
+		out.Addend = value
+		put(seg.Code, offset, out.Size, 0)
+		seg.Relocs = append(seg.Relocs, out)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package o65
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"v65/obj"
+)
+
+// module returns a module with code, data, bss and zero page, which uses a
+// label of every segment and an imported symbol.
+func module() *obj.Module {
+	return &obj.Module{
+		Name: "sound.s",
+		Segments: []*obj.Segment{
+			{
+				Name: "code",
+				// lda ptr; sta buf; ldx #<table; ldy #>table; jsr play+2; rts
+				Code: []byte{0xa5, 0, 0x8d, 0, 0, 0xa2, 0, 0xa0, 0, 0x20, 0, 0, 0x60},
+				Relocs: []*obj.Reloc{
+					{Offset: 1, Size: 1, Segment: "zp", Part: obj.Low},
+					{Offset: 3, Size: 2, Segment: "bss", Addend: 4},
+					{Offset: 6, Size: 1, Segment: "data", Addend: 0x101, Part: obj.Low},
+					{Offset: 8, Size: 1, Segment: "data", Addend: 0x101, Part: obj.High},
+					{Offset: 10, Size: 2, Symbol: "play", Addend: 2},
+				},
+				Align: 2,
+			},
+			{
+				Name:   "data",
+				Code:   append(make([]byte, 0x101), 1, 2, 0, 0),
+				Relocs: []*obj.Reloc{{Offset: 0x103, Size: 2, Segment: "code", Addend: 9}},
+				Align:  2,
+			},
+			{Name: "bss", Code: make([]byte, 8), Align: 2},
+			{Name: "zp", Code: make([]byte, 2), Align: 2},
+		},
+		Symbols: []*obj.Symbol{
+			{Name: "init", Segment: "code"},
+			{Name: "table", Segment: "data", Value: 0x101},
+			{Name: "voices", Value: 3},
+		},
+		Externs: []*obj.Extern{{Name: "play"}},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	want := module()
+	var buf bytes.Buffer
+	if err := Write(&buf, want); err != nil {
+		t.Fatalf("Write(); got:%v, want:nil", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), Magic) {
+		t.Fatalf("Write(); got:% x, want:magic", buf.Bytes()[:6])
+	}
+	// The values of the relocations are in the code.
+	if got := buf.Bytes()[bytes.Index(buf.Bytes(), []byte{0xa5}):][:13]; !bytes.Equal(got, []byte{0xa5, 0, 0x8d, 4, 0, 0xa2, 1, 0xa0, 1, 0x20, 2, 0, 0x60}) {
+		t.Errorf("text; got:% x", got)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read(); got:%v, want:nil", err)
+	}
+	// A low byte relocation only keeps the low byte of the addend.
+	want.Segments[0].Relocs[2].Addend = 1
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read(); got:%+v, want:%+v", got, want)
+	}
+}
+
+// image is an o65 file as the format describes it: a text segment with
+// lda data+1, jsr ext+2, ldx #>data+1 and rts, a data segment of two bytes
+// and the export start.
+var image = []byte{
+	0x01, 0x00, 'o', '6', '5', 0x00, // Magic.
+	0x00, 0x10, // Mode: object file, byte alignment.
+	0x00, 0x00, 0x09, 0x00, // Text base and size.
+	0x00, 0x00, 0x02, 0x00, // Data base and size.
+	0x00, 0x00, 0x00, 0x00, // BSS base and size.
+	0x00, 0x00, 0x00, 0x00, // Zero page base and size.
+	0x00, 0x00, // Stack size.
+	0x06, 0x00, 't', '.', 's', 0x00, // File name.
+	0x06, 0x02, 'v', '6', '5', 0x00, // Assembler.
+	0x00,
+	0xad, 0x01, 0x00, 0x20, 0x02, 0x00, 0xa2, 0x00, 0x60, // Text.
+	0x42, 0x43, // Data.
+	0x01, 0x00, 'e', 'x', 't', 0x00, // Undefined references.
+	0x02, 0x83, // Word at 1, data.
+	0x03, 0x80, 0x00, 0x00, // Word at 4, undefined reference 0.
+	0x03, 0x43, 0x01, // High byte at 7, data, low byte 1.
+	0x00,
+	0x00,                                                        // No data relocations.
+	0x01, 0x00, 's', 't', 'a', 'r', 't', 0x00, 0x02, 0x00, 0x00, // Exports.
+}
+
+func TestWriteImage(t *testing.T) {
+	mod := &obj.Module{
+		Name: "t.s",
+		Segments: []*obj.Segment{
+			{
+				Name: "code",
+				Code: []byte{0xad, 0, 0, 0x20, 0, 0, 0xa2, 0, 0x60},
+				Relocs: []*obj.Reloc{
+					{Offset: 1, Size: 2, Segment: "data", Addend: 1},
+					{Offset: 4, Size: 2, Symbol: "ext", Addend: 2},
+					{Offset: 7, Size: 1, Segment: "data", Addend: 1, Part: obj.High},
+				},
+			},
+			{Name: "data", Code: []byte{0x42, 0x43}},
+		},
+		Symbols: []*obj.Symbol{{Name: "start", Segment: "code"}},
+		Externs: []*obj.Extern{{Name: "ext"}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, mod); err != nil {
+		t.Fatalf("Write(); got:%v, want:nil", err)
+	}
+	if !bytes.Equal(buf.Bytes(), image) {
+		t.Errorf("Write();\ngot: % x\nwant:% x", buf.Bytes(), image)
+	}
+}
+
+func TestReadImage(t *testing.T) {
+	// The image with the text at $0400 and the data at $1000, as an
+	// assembler like xa writes it.
+	data := append([]byte(nil), image...)
+	copy(data[8:16], []byte{0x00, 0x04, 0x09, 0x00, 0x00, 0x10, 0x02, 0x00})
+	text := bytes.Index(data, []byte{0xad})
+	copy(data[text:], []byte{0xad, 0x01, 0x10, 0x20, 0x02, 0x00, 0xa2, 0x10, 0x60})
+	data[len(data)-1] = 0x04 // start is at $0400.
+	mod, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read(); got:%v, want:nil", err)
+	}
+	seg := mod.Segments[0]
+	if !bytes.Equal(seg.Code, []byte{0xad, 0, 0, 0x20, 0, 0, 0xa2, 0, 0x60}) {
+		t.Errorf("code; got:% x, want:the relocated values cleared", seg.Code)
+	}
+	want := []obj.Reloc{
+		{Offset: 1, Size: 2, Segment: "data", Addend: 1},
+		{Offset: 4, Size: 2, Symbol: "ext", Addend: 2},
+		{Offset: 7, Size: 1, Segment: "data", Addend: 1, Part: obj.High},
+	}
+	for i, r := range want {
+		if *seg.Relocs[i] != r {
+			t.Errorf("relocs[%d]; got:%+v, want:%+v", i, *seg.Relocs[i], r)
+		}
+	}
+	if sym := mod.Symbols[0]; sym.Name != "start" || sym.Segment != "code" || sym.Value != 0 {
+		t.Errorf("symbol; got:%+v, want:start at code+0", sym)
+	}
+}
+
+func TestWriteMerged(t *testing.T) {
+	mod := &obj.Module{
+		Name: "a.s",
+		Segments: []*obj.Segment{
+			{Name: "code", Code: []byte{0x60}},
+			{Name: "rodata", Code: []byte{1, 2}},
+			{Name: "code:fn", Parent: "code", Code: []byte{0x4c, 0, 0}, Relocs: []*obj.Reloc{{Offset: 1, Size: 2, Segment: "rodata", Addend: 1}}},
+		},
+		Symbols: []*obj.Symbol{{Name: "fn", Segment: "code:fn"}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, mod); err != nil {
+		t.Fatalf("Write(); got:%v, want:nil", err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read(); got:%v, want:nil", err)
+	}
+	seg := got.Segments[0]
+	if len(got.Segments) != 1 || !bytes.Equal(seg.Code, []byte{0x60, 1, 2, 0x4c, 0, 0}) {
+		t.Fatalf("Read(); got:%+v, want:one text segment", got.Segments)
+	}
+	if r := seg.Relocs[0]; r.Offset != 4 || r.Segment != "code" || r.Addend != 2 {
+		t.Errorf("relocation; got:%+v, want:code+2 at 4", r)
+	}
+	if sym := got.Symbols[0]; sym.Segment != "code" || sym.Value != 3 {
+		t.Errorf("symbol; got:%+v, want:code+3", sym)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	for _, tc := range []struct {
+		str    string
+		change func(mod *obj.Module)
+		want   string
+	}{
+		{"absolute", func(mod *obj.Module) { mod.Segments[0].Absolute = true }, "absolute segment code"},
+		{"bank", func(mod *obj.Module) { mod.Segments[0].Bank = 1 }, "o65 has no banks"},
+		{"bss code", func(mod *obj.Module) { mod.Segments[2].Code[0] = 1 }, "segment bss has no contents"},
+		{"bank part", func(mod *obj.Module) { mod.Segments[0].Relocs[0].Part = obj.Bank }, "cannot be written in o65"},
+		{"not imported", func(mod *obj.Module) { mod.Externs = nil }, "symbol play is not imported"},
+		{"symbol", func(mod *obj.Module) { mod.Symbols[2].Value = -1 }, "value of voices does not fit"},
+		{"alignment", func(mod *obj.Module) { mod.Segments[0].Align = 512 }, "larger than a page"},
+	} {
+		println(tc.str)
+		mod := module()
+		tc.change(mod)
+		if err := Write(&bytes.Buffer{}, mod); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Write(); got:%v, want:%s", err, tc.want)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, module()); err != nil {
+		t.Fatalf("Write(); got:%v, want:nil", err)
+	}
+	data := buf.Bytes()
+	for _, tc := range []struct {
+		str  string
+		data []byte
+		want string
+	}{
+		{"object file", []byte(`{"Format":"v65-obj 1"}`), "not an o65 file"},
+		{"truncated", data[:len(data)-1], "truncated o65 file"},
+		{"65816", append(append([]byte(nil), data[:6]...), 0x00, 0x90), "unsupported o65 mode"},
+	} {
+		println(tc.str)
+		if _, err := Read(bytes.NewReader(tc.data)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Read(); got:%v, want:%s", err, tc.want)
+		}
+	}
+}
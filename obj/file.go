@@ -0,0 +1,36 @@
+package obj
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// FileFormat identifies an object file and the version of its format.
+const FileFormat = "v65-obj 1"
+
+// file is an object file: a module encoded as JSON, with the format.
+type file struct {
+	Format string
+	Module *Module
+}
+
+// Write writes a module as an object file.
+func Write(w io.Writer, mod *Module) error {
+	return json.NewEncoder(w).Encode(&file{Format: FileFormat, Module: mod})
+}
+
+// Read reads a module from an object file.
+func Read(r io.Reader) (*Module, error) {
+	var f file
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("not an object file: %v", err)
+	}
+	if f.Format != FileFormat {
+		return nil, fmt.Errorf("not an object file: format %q", f.Format)
+	}
+	if f.Module == nil {
+		return nil, fmt.Errorf("object file without a module")
+	}
+	return f.Module, nil
+}
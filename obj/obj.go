@@ -0,0 +1,142 @@
+// Package obj contains the object modules that the assembler produces
+// and the linker consumes.
+package obj
+
+// Module is an assembled object module.
+type Module struct {
+	Name     string
+	Segments []*Segment
+	Symbols  []*Symbol // The symbols that the module exports.
+	Externs  []*Extern // The symbols that the module imports.
+	Vectors  []*Vector // Addresses for the loader, in order of definition.
+
+	// Attributes are settings for the output, like the fields of the
+	// iNES header of a NES ROM.
+	Attributes map[string]int
+}
+
+// Segment is a block of code or data that is placed in memory as a whole.
+// A segment is relocatable, unless it is absolute, in which case it has
+// to be placed at its address.
+type Segment struct {
+	Name     string
+	Code     []byte
+	Relocs   []*Reloc
+	Absolute bool
+	Addr     int // Address of an absolute segment.
+	Align    int // Alignment of a relocatable segment, a power of two.
+	Lines    []*Line
+	Bank     int // The bank of a cartridge or of banked memory.
+
+	// Parent is the segment that a section is part of. A section is
+	// placed with its segment, but it is dropped if nothing uses it.
+	Parent string
+}
+
+// Line maps a range of bytes in a segment to the source line that
+// produced them.
+type Line struct {
+	Offset int // Offset of the first byte in the segment.
+	Size   int
+	File   string
+	Line   int
+	Column int
+	Scope  string // The label in effect, "" if there is none.
+}
+
+// Parts of a value that a relocation can store.
+const (
+	All  = 0
+	Low  = 1 // The low byte.
+	High = 2 // The high byte.
+	Bank = 3 // The bank of the segment of the symbol, plus the addend.
+)
+
+// Reloc is a place in a segment where the value of a symbol (plus the
+// addend) needs to be stored after linking. For a reference to a label
+// in a relocatable segment of the same module, Segment is the name of that
+// segment and the address of the segment is used instead of the value of
+// a symbol.
+type Reloc struct {
+	Offset  int // Offset of the value in the segment.
+	Size    int // Size of the value in bytes: 1, 2 or 4.
+	Symbol  string
+	Segment string
+	Addend  int64
+	Part    int
+	Call    bool // Is the value the target of a jsr or jmp?
+}
+
+// Symbol is a symbol that is exported by a module.
+type Symbol struct {
+	Name    string
+	Segment string // The segment the value is relative to, "" if absolute.
+	Value   int64
+	Weak    bool // Can the symbol be overridden by another module?
+}
+
+// Extern is a symbol that is imported by a module.
+type Extern struct {
+	Name     string
+	ZeroPage bool // Does the symbol need to be in the zero page?
+}
+
+// Kinds of vectors.
+const (
+	Init = 1 // A routine that is called when the code before it is loaded.
+	Run  = 2 // The address at which the program starts.
+
+	// The interrupt vectors of the 6502 at $fffa.
+	NMI   = 3
+	Reset = 4
+	IRQ   = 5
+)
+
+// Vector is an address that a loader needs, like the start address of the
+// program. Its value is the value of Symbol, or the address of Segment,
+// plus Value. At is the place where the vector was defined.
+type Vector struct {
+	Kind      int
+	Symbol    string
+	Segment   string
+	Value     int64
+	AtSegment string
+	AtOffset  int
+}
+
+// Segment returns the segment with the given name, or nil.
+func (m *Module) Segment(name string) *Segment {
+	for _, seg := range m.Segments {
+		if seg.Name == name {
+			return seg
+		}
+	}
+	return nil
+}
+
+// Group returns the name of the segment with which a segment is placed:
+// its parent if it is a section, or its own name.
+func (seg *Segment) Group() string {
+	if seg.Parent != "" {
+		return seg.Parent
+	}
+	return seg.Name
+}
+
+// Extern returns the imported symbol with the given name, or nil.
+func (m *Module) Extern(name string) *Extern {
+	for _, ext := range m.Externs {
+		if ext.Name == name {
+			return ext
+		}
+	}
+	return nil
+}
+
+// Patch stores a value of size bytes at offset in the segment, low byte
+// first, like the words of the assembler.
+func (seg *Segment) Patch(offset int, size int, value int64) {
+	for i := 0; i < size; i++ {
+		seg.Code[offset+i] = byte(value >> uint(8*i))
+	}
+}
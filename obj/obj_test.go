@@ -0,0 +1,62 @@
+package obj
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	for _, tc := range []struct {
+		size  int
+		value int64
+		want  []byte
+	}{
+		{1, 0x12, []byte{0x12, 0, 0, 0}},
+		{1, -1, []byte{0xff, 0, 0, 0}},
+		{2, 0x1234, []byte{0x34, 0x12, 0, 0}},
+		{4, 0x12345678, []byte{0x78, 0x56, 0x34, 0x12}},
+	} {
+		seg := &Segment{Code: make([]byte, 4)}
+		seg.Patch(0, tc.size, tc.value)
+		for i, b := range tc.want {
+			if seg.Code[i] != b {
+				t.Errorf("Patch(0, %d, %d) code[%d]; got:%d, want:%d", tc.size, tc.value, i, seg.Code[i], b)
+			}
+		}
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	mod := &Module{
+		Name: "main.s",
+		Segments: []*Segment{{
+			Name:   "code",
+			Code:   []byte{0x20, 0, 0},
+			Relocs: []*Reloc{{Offset: 1, Size: 2, Symbol: "fn"}},
+			Lines:  []*Line{{Size: 3, File: "main.s", Line: 1, Column: 2}},
+		}},
+		Symbols:    []*Symbol{{Name: "start", Segment: "code"}},
+		Externs:    []*Extern{{Name: "fn"}},
+		Vectors:    []*Vector{{Kind: Run, Symbol: "start", AtSegment: "code"}},
+		Attributes: map[string]int{"inesprg": 2},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, mod); err != nil {
+		t.Fatalf("Write(); got:%v, want:nil", err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read(); got:%v, want:nil", err)
+	}
+	if !reflect.DeepEqual(got, mod) {
+		t.Errorf("Read(); got:%+v, want:%+v", got, mod)
+	}
+	for _, str := range []string{"", "{}", `{"Format":"v65-obj 2"}`, `{"Format":"v65-obj 1"}`} {
+		println(str)
+		if _, err := Read(strings.NewReader(str)); err == nil {
+			t.Errorf("Read(%q); got:nil, want:error", str)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package output
+
+import (
+	"io"
+	"strings"
+	"v65/apple2"
+)
+
+// defaultName is the name of the file on a disk if none is given.
+const defaultName = "PROGRAM"
+
+// fileName returns the name for the program in a disk image.
+func fileName(opts Options) string {
+	if opts.Name == "" {
+		return defaultName
+	}
+	return strings.ToUpper(opts.Name)
+}
+
+// WriteA2Bin writes a DOS 3.3 binary file: the load address and length,
+// followed by the bytes from the lowest to the highest used address.
+func WriteA2Bin(w io.Writer, blocks []*Block, opts Options) error {
+	low, data, err := flatten(blocks, opts.Fill)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(apple2.BinaryFile(low, data))
+	return err
+}
+
+// WriteDSK writes a DOS 3.3 disk image with the program as a binary file
+// named opts.Name.
+func WriteDSK(w io.Writer, blocks []*Block, opts Options) error {
+	low, data, err := flatten(blocks, opts.Fill)
+	if err != nil {
+		return err
+	}
+	d := apple2.NewDOSDisk()
+	if err := d.AddFile(fileName(opts), apple2.TypeBinary, apple2.BinaryFile(low, data)); err != nil {
+		return err
+	}
+	_, err = w.Write(d.Bytes())
+	return err
+}
+
+// WritePO writes a ProDOS disk image with the program as a BIN file named
+// opts.Name, with the load address as its aux type.
+func WritePO(w io.Writer, blocks []*Block, opts Options) error {
+	low, data, err := flatten(blocks, opts.Fill)
+	if err != nil {
+		return err
+	}
+	v, err := apple2.NewProDOSVolume(fileName(opts))
+	if err != nil {
+		return err
+	}
+	if err := v.AddFile(fileName(opts), apple2.TypeBIN, low, data); err != nil {
+		return err
+	}
+	_, err = w.Write(v.Bytes())
+	return err
+}
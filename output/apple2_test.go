@@ -0,0 +1,53 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"v65/apple2"
+)
+
+func TestWriteApple2(t *testing.T) {
+	blocks := []*Block{{Addr: 0x0803, Data: []byte{0xea}}, {Addr: 0x0805, Data: []byte{0x60}}}
+	code := []byte{0xea, 0xff, 0x60}
+	opts := Options{Fill: 0xff, Name: "hello"}
+
+	var buf bytes.Buffer
+	if err := WriteA2Bin(&buf, blocks, opts); err != nil {
+		t.Fatalf("WriteA2Bin(); got:%v, want:nil", err)
+	}
+	if want := apple2.BinaryFile(0x0803, code); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("WriteA2Bin(); got:% x, want:% x", buf.Bytes(), want)
+	}
+
+	buf.Reset()
+	if err := WriteDSK(&buf, blocks, opts); err != nil {
+		t.Fatalf("WriteDSK(); got:%v, want:nil", err)
+	}
+	d, err := apple2.ReadDOSDisk(buf.Bytes())
+	if err != nil {
+		t.Fatalf("apple2.ReadDOSDisk(); got:%v, want:nil", err)
+	}
+	file, err := d.ReadFile("HELLO")
+	if err != nil {
+		t.Fatalf("ReadFile(HELLO); got:%v, want:nil", err)
+	}
+	if addr, data, err := apple2.ParseBinaryFile(file); err != nil || addr != 0x0803 || !bytes.Equal(data, code) {
+		t.Errorf("DOS 3.3 file; got:$%04x/% x/%v, want:$0803/% x/nil", addr, data, err, code)
+	}
+
+	buf.Reset()
+	if err := WritePO(&buf, blocks, opts); err != nil {
+		t.Fatalf("WritePO(); got:%v, want:nil", err)
+	}
+	v, err := apple2.ReadProDOSVolume(buf.Bytes())
+	if err != nil {
+		t.Fatalf("apple2.ReadProDOSVolume(); got:%v, want:nil", err)
+	}
+	files, err := v.Files()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Files(); got:%d files/%v, want:1 file/nil", len(files), err)
+	}
+	if f := files[0]; f.Name != "HELLO" || f.Type != apple2.TypeBIN || f.AuxType != 0x0803 || !bytes.Equal(f.Data, code) {
+		t.Errorf("ProDOS file; got:%s/%x/$%04x/% x, want:HELLO/6/$0803/% x", f.Name, f.Type, f.AuxType, f.Data, code)
+	}
+}
@@ -0,0 +1,31 @@
+package output
+
+import "io"
+
+// flatten returns the bytes from the lowest to the highest used address
+// of the blocks, with the gaps between them filled with fill.
+func flatten(blocks []*Block, fill byte) (low int, data []byte, err error) {
+	low, high, err := bounds(blocks)
+	if err != nil {
+		return 0, nil, err
+	}
+	data = make([]byte, high-low)
+	for i := range data {
+		data[i] = fill
+	}
+	for _, b := range blocks {
+		copy(data[b.Addr-low:], b.Data)
+	}
+	return low, data, nil
+}
+
+// WriteBin writes a raw binary from the lowest to the highest used
+// address. Gaps between the blocks are filled with opts.Fill.
+func WriteBin(w io.Writer, blocks []*Block, opts Options) error {
+	_, data, err := flatten(blocks, opts.Fill)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,50 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// recordSize is the maximum number of data bytes in a record of the
+// Intel HEX and S-record formats.
+const recordSize = 16
+
+// chunks calls f for every piece of at most recordSize bytes of the blocks.
+func chunks(blocks []*Block, f func(addr int, data []byte)) {
+	for _, b := range blocks {
+		for i := 0; i < len(b.Data); i += recordSize {
+			end := i + recordSize
+			if end > len(b.Data) {
+				end = len(b.Data)
+			}
+			f(b.Addr+i, b.Data[i:end])
+		}
+	}
+}
+
+// writeIHexRecord writes an Intel HEX record. The checksum is the two's
+// complement of the sum of all bytes of the record.
+func writeIHexRecord(w io.Writer, addr int, typ byte, data []byte) {
+	sum := byte(len(data)) + byte(addr>>8) + byte(addr) + typ
+	fmt.Fprintf(w, ":%02X%04X%02X", len(data), addr&0xffff, typ)
+	for _, b := range data {
+		fmt.Fprintf(w, "%02X", b)
+		sum += b
+	}
+	fmt.Fprintf(w, "%02X\n", -sum)
+}
+
+// WriteIHex writes the blocks in Intel HEX format, with data records
+// (type 00) and an end-of-file record (type 01).
+func WriteIHex(w io.Writer, blocks []*Block, opts Options) error {
+	if _, _, err := bounds(blocks); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	chunks(blocks, func(addr int, data []byte) {
+		writeIHexRecord(bw, addr, 0x00, data)
+	})
+	writeIHexRecord(bw, 0, 0x01, nil)
+	return bw.Flush()
+}
@@ -0,0 +1,61 @@
+package output
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parseIHex parses Intel HEX records and returns the memory contents.
+func parseIHex(t *testing.T, s string) map[int]byte {
+	mem := make(map[int]byte)
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, ":") {
+			t.Fatalf("record %d does not start with ':': %q", i, line)
+		}
+		rec, err := hex.DecodeString(line[1:])
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0 {
+			t.Errorf("record %d checksum; got:$%02x, want:0", i, sum)
+		}
+		n := int(rec[0])
+		if len(rec) != n+5 {
+			t.Fatalf("record %d length; got:%d, want:%d", i, len(rec), n+5)
+		}
+		addr, _ := strconv.ParseInt(line[3:7], 16, 32)
+		switch rec[3] {
+		case 0x00:
+			for j, b := range rec[4 : 4+n] {
+				mem[int(addr)+j] = b
+			}
+		case 0x01:
+			if i != len(lines)-1 {
+				t.Errorf("end-of-file record %d is not the last one", i)
+			}
+		default:
+			t.Errorf("record %d type; got:%d, want:0 or 1", i, rec[3])
+		}
+	}
+	if lines[len(lines)-1] != ":00000001FF" {
+		t.Errorf("last record; got:%s, want::00000001FF", lines[len(lines)-1])
+	}
+	return mem
+}
+
+func TestWriteIHex(t *testing.T) {
+	blocks := testBlocks(t)
+	var buf bytes.Buffer
+	if err := WriteIHex(&buf, blocks, Options{}); err != nil {
+		t.Fatalf("WriteIHex(); got:%v, want:nil", err)
+	}
+	compare(t, parseIHex(t, buf.String()), contents(blocks))
+}
@@ -0,0 +1,98 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"v65/obj"
+)
+
+// Sizes of the banks of a NES ROM.
+const (
+	nesBankSize = 0x2000 // Banks in the source are 8K.
+	prgUnit     = 0x4000 // The header counts PRG ROM in 16K units.
+	chrUnit     = 0x2000 // The header counts CHR ROM in 8K units.
+	nesVectors  = 0xfffa
+)
+
+// nesHeader returns the 16 byte iNES header. A mapper number above 255
+// needs the NES 2.0 header, which is otherwise the same for these fields.
+func nesHeader(prg, chr, mapper, mirror int) []byte {
+	header := make([]byte, 16)
+	copy(header, "NES\x1a")
+	header[4] = byte(prg)
+	header[5] = byte(chr)
+	header[6] = byte(mapper<<4) | byte(mirror&0x0f)
+	header[7] = byte(mapper & 0xf0)
+	if mapper > 0xff {
+		header[7] |= 0x08 // NES 2.0 identifier.
+		header[8] = byte(mapper>>8) & 0x0f
+	}
+	return header
+}
+
+// WriteNES writes a NES ROM image (.nes) with an iNES header. The header
+// fields are the inesprg, ineschr, inesmap and inesmir attributes. The
+// source is divided in 8K banks, of which the first 2*inesprg are PRG ROM
+// and the rest CHR ROM. A block is put in its bank at the offset given by
+// the low 13 bits of its address. The NMI, reset and IRQ vectors are put
+// at the end of the last PRG bank, where the CPU finds them at $fffa.
+func WriteNES(w io.Writer, blocks []*Block, opts Options) error {
+	prg, ok := opts.Attributes["inesprg"]
+	if !ok || prg < 1 || prg > 0xff {
+		return fmt.Errorf("inesprg must be set to 1-255 16K PRG banks")
+	}
+	chr := opts.Attributes["ineschr"]
+	if chr > 0xff {
+		return fmt.Errorf("ineschr out of range: %d", chr)
+	}
+	prgBanks := prg * prgUnit / nesBankSize
+	rom := make([]byte, prg*prgUnit+chr*chrUnit)
+	for i := range rom[:prg*prgUnit] {
+		rom[i] = opts.Fill
+	}
+	if err := CheckOverlap(blocks); err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		if len(b.Data) == 0 {
+			continue
+		}
+		if b.Bank*nesBankSize >= len(rom) {
+			return fmt.Errorf("bank %d does not exist, there are %d 8K banks", b.Bank, len(rom)/nesBankSize)
+		}
+		offset := b.Addr % nesBankSize
+		if over := offset + len(b.Data) - nesBankSize; over > 0 {
+			return fmt.Errorf("bank %d overflows by %d byte(s) at $%04x", b.Bank, over, b.Addr)
+		}
+		copy(rom[b.Bank*nesBankSize+offset:], b.Data)
+	}
+
+	// The interrupt vectors, little endian as the CPU reads them.
+	vectorOffset := prg*prgUnit - (0x10000 - nesVectors)
+	for _, v := range opts.Vectors {
+		var offset int
+		switch v.Kind {
+		case obj.NMI:
+			offset = vectorOffset
+		case obj.Reset:
+			offset = vectorOffset + 2
+		case obj.IRQ:
+			offset = vectorOffset + 4
+		default:
+			continue
+		}
+		for _, b := range blocks {
+			if b.Bank == prgBanks-1 && b.Addr%nesBankSize+len(b.Data) > offset%nesBankSize {
+				return fmt.Errorf("vectors at $%04x overlap code in bank %d", nesVectors, b.Bank)
+			}
+		}
+		rom[offset], rom[offset+1] = byte(v.Addr), byte(v.Addr>>8)
+	}
+
+	header := nesHeader(prg, chr, opts.Attributes["inesmap"], opts.Attributes["inesmir"])
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(rom)
+	return err
+}
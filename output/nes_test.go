@@ -0,0 +1,77 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"v65/link"
+	"v65/obj"
+)
+
+func TestWriteNES(t *testing.T) {
+	blocks := []*Block{
+		{Addr: 0xc000, Data: []byte{0x78, 0xd8}, Bank: 0},
+		{Addr: 0xe000, Data: []byte{0x40}, Bank: 1},
+		{Addr: 0x0000, Data: []byte{0xff, 0x81}, Bank: 2},
+	}
+	opts := Options{
+		Attributes: map[string]int{"inesprg": 1, "ineschr": 1, "inesmap": 0x12, "inesmir": 1},
+		Vectors: []*link.Vector{
+			{Kind: obj.NMI, Addr: 0xe000},
+			{Kind: obj.Reset, Addr: 0xc000},
+			{Kind: obj.IRQ, Addr: 0xe000},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteNES(&buf, blocks, opts); err != nil {
+		t.Fatalf("WriteNES(); got:%v, want:nil", err)
+	}
+	rom := buf.Bytes()
+	if len(rom) != 16+0x4000+0x2000 {
+		t.Fatalf("len(rom); got:%d, want:%d", len(rom), 16+0x4000+0x2000)
+	}
+	header := []byte{'N', 'E', 'S', 0x1a, 1, 1, 0x21, 0x10, 0, 0, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(rom[:16], header) {
+		t.Errorf("header; got:% x, want:% x", rom[:16], header)
+	}
+	for _, want := range []struct {
+		offset int
+		data   []byte
+	}{
+		{0x0000, []byte{0x78, 0xd8}},
+		{0x2000, []byte{0x40}},
+		{0x3ffa, []byte{0x00, 0xe0, 0x00, 0xc0, 0x00, 0xe0}},
+		{0x4000, []byte{0xff, 0x81}},
+	} {
+		if got := rom[16+want.offset : 16+want.offset+len(want.data)]; !bytes.Equal(got, want.data) {
+			t.Errorf("rom[$%04x]; got:% x, want:% x", want.offset, got, want.data)
+		}
+	}
+}
+
+func TestNESHeader(t *testing.T) {
+	header := nesHeader(2, 0, 0x123, 0)
+	if header[6] != 0x30 || header[7] != 0x28 || header[8] != 0x01 {
+		t.Errorf("NES 2.0 header; got:% x, want:30 28 01", header[6:9])
+	}
+}
+
+func TestWriteNESErrors(t *testing.T) {
+	attrs := map[string]int{"inesprg": 1}
+	for _, tc := range []struct {
+		blocks  []*Block
+		attrs   map[string]int
+		vectors []*link.Vector
+	}{
+		{[]*Block{{Addr: 0xc000, Data: []byte{1}}}, nil, nil},
+		{[]*Block{{Addr: 0xdfff, Data: []byte{1, 2}}}, attrs, nil},
+		{[]*Block{{Addr: 0xc000, Data: []byte{1}, Bank: 2}}, attrs, nil},
+		{[]*Block{{Addr: 0xfff0, Data: make([]byte, 14), Bank: 1}}, attrs, []*link.Vector{{Kind: obj.Reset}}},
+	} {
+		err := WriteNES(&bytes.Buffer{}, tc.blocks, Options{Attributes: tc.attrs, Vectors: tc.vectors})
+		if err == nil {
+			t.Errorf("WriteNES(); got:nil, want:error")
+		} else {
+			println(err.Error())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Package output writes linked code and data in the file formats that
+// emulators, loaders and EPROM programmers understand.
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"v65/link"
+)
+
+// Block is a contiguous block of bytes that is loaded at an address.
+type Block struct {
+	Addr int
+	Data []byte
+	Bank int // Blocks in different banks can have the same addresses.
+}
+
+// Options contains the settings of the output formats.
+type Options struct {
+	Fill       byte   // The value of unused bytes in a raw binary.
+	Machine    string // The machine for a BASIC stub in a PRG, "" for none.
+	Vectors    []*link.Vector
+	Attributes map[string]int // Settings of the format, see link.Image.
+	Name       string         // The name of the program in a disk image.
+}
+
+// Writer writes blocks in a particular format.
+type Writer func(w io.Writer, blocks []*Block, opts Options) error
+
+// Formats are the supported output formats, by name.
+var Formats = map[string]Writer{
+	"a2bin": WriteA2Bin,
+	"dsk":   WriteDSK,
+	"po":    WritePO,
+	"bin":   WriteBin,
+	"ihex":  WriteIHex,
+	"nes":   WriteNES,
+	"prg":   WritePRG,
+	"srec":  WriteSRec,
+	"xex":   WriteXEX,
+}
+
+// FormatNames returns the names of the supported formats, sorted.
+func FormatNames() []string {
+	var names []string
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FromImage returns the non-empty segments of a linked image as blocks
+// at their load addresses, sorted by bank and address.
+func FromImage(img *link.Image) []*Block {
+	var blocks []*Block
+	for _, p := range img.Placements {
+		if len(p.Segment.Code) > 0 {
+			blocks = append(blocks, &Block{Addr: p.Load, Data: p.Segment.Code, Bank: p.Segment.Bank})
+		}
+	}
+	sortBlocks(blocks)
+	return blocks
+}
+
+// FromArea returns the blocks of the segments that are loaded in a memory
+// area, which for a switchable area are the segments in its bank. If the
+// area has a fill value, the result is a single block that covers the
+// whole area.
+func FromArea(img *link.Image, area *link.Area) []*Block {
+	var blocks []*Block
+	for _, b := range FromImage(img) {
+		if b.Addr >= area.Start && b.Addr < area.End() && (area.Bank < 0 || b.Bank == area.Bank) {
+			blocks = append(blocks, b)
+		}
+	}
+	if area.Fill < 0 {
+		return blocks
+	}
+	data := make([]byte, area.Size)
+	for i := range data {
+		data[i] = byte(area.Fill)
+	}
+	for _, b := range blocks {
+		copy(data[b.Addr-area.Start:], b.Data)
+	}
+	return []*Block{{Addr: area.Start, Data: data, Bank: blockBank(area)}}
+}
+
+// blockBank returns the bank of the blocks of an area.
+func blockBank(area *link.Area) int {
+	if area.Bank < 0 {
+		return 0
+	}
+	return area.Bank
+}
+
+// bounds returns the lowest and the highest (exclusive) address that is
+// used by the blocks. The formats that call it hold a single image of
+// memory, so blocks in different banks or blocks that overlap are an
+// error; the banks can be written to their own files with memory areas.
+func bounds(blocks []*Block) (low, high int, err error) {
+	if len(blocks) == 0 {
+		return 0, 0, fmt.Errorf("nothing to write")
+	}
+	if err := CheckOverlap(blocks); err != nil {
+		return 0, 0, err
+	}
+	low, high = blocks[0].Addr, blocks[0].Addr
+	for _, b := range blocks {
+		if b.Bank != blocks[0].Bank {
+			return 0, 0, fmt.Errorf("blocks in bank %d and bank %d cannot be written to a single image", blocks[0].Bank, b.Bank)
+		}
+		if b.Addr < low {
+			low = b.Addr
+		}
+		if end := b.Addr + len(b.Data); end > high {
+			high = end
+		}
+	}
+	return low, high, nil
+}
+
+// sortBlocks sorts blocks by bank and address.
+func sortBlocks(blocks []*Block) {
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if blocks[i].Bank != blocks[j].Bank {
+			return blocks[i].Bank < blocks[j].Bank
+		}
+		return blocks[i].Addr < blocks[j].Addr
+	})
+}
+
+// CheckOverlap returns an error if blocks in the same bank overlap.
+func CheckOverlap(blocks []*Block) error {
+	sorted := append([]*Block(nil), blocks...)
+	sortBlocks(sorted)
+	for i := 1; i < len(sorted); i++ {
+		prev, b := sorted[i-1], sorted[i]
+		if end := prev.Addr + len(prev.Data); b.Bank == prev.Bank && b.Addr < end {
+			return fmt.Errorf("block at $%04x-$%04x overlaps block at $%04x-$%04x", prev.Addr, end-1, b.Addr, b.Addr+len(b.Data)-1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"v65/link"
+	"v65/obj"
+)
+
+// testBlocks returns the blocks of a linked module with a relocatable
+// segment of 20 bytes at $1000 and an absolute segment at $1018.
+func testBlocks(t *testing.T) []*Block {
+	code := make([]byte, 20)
+	for i := range code {
+		code[i] = byte(i + 1)
+	}
+	mod := &obj.Module{
+		Name: "test",
+		Segments: []*obj.Segment{
+			{Name: "code", Code: code},
+			{Name: "vectors", Code: []byte{0xaa, 0xbb}, Absolute: true, Addr: 0x1018},
+		},
+	}
+	img, err := link.Link([]*obj.Module{mod}, 0x1000)
+	if err != nil {
+		t.Fatalf("link.Link(); got:%v, want:nil", err)
+	}
+	return FromImage(img)
+}
+
+// contents returns the memory contents of the blocks.
+func contents(blocks []*Block) map[int]byte {
+	mem := make(map[int]byte)
+	for _, b := range blocks {
+		for i, v := range b.Data {
+			mem[b.Addr+i] = v
+		}
+	}
+	return mem
+}
+
+// compare compares memory contents.
+func compare(t *testing.T, got, want map[int]byte) {
+	if len(got) != len(want) {
+		t.Errorf("number of bytes; got:%d, want:%d", len(got), len(want))
+	}
+	for addr, v := range want {
+		if got[addr] != v {
+			t.Errorf("byte at $%04x; got:$%02x, want:$%02x", addr, got[addr], v)
+		}
+	}
+}
+
+func TestWriteBin(t *testing.T) {
+	blocks := testBlocks(t)
+	var buf bytes.Buffer
+	if err := WriteBin(&buf, blocks, Options{Fill: 0xff}); err != nil {
+		t.Fatalf("WriteBin(); got:%v, want:nil", err)
+	}
+	got := buf.Bytes()
+	if len(got) != 0x1a {
+		t.Fatalf("len(bin); got:%d, want:%d", len(got), 0x1a)
+	}
+	mem := contents(blocks)
+	for i, b := range got {
+		want, ok := mem[0x1000+i]
+		if !ok {
+			want = 0xff
+		}
+		if b != want {
+			t.Errorf("bin[%d]; got:$%02x, want:$%02x", i, b, want)
+		}
+	}
+}
+
+func TestNothingToWrite(t *testing.T) {
+	for name, write := range Formats {
+		println(name)
+		if err := write(&bytes.Buffer{}, nil, Options{}); err == nil {
+			t.Errorf("%s: got:nil, want:error", name)
+		}
+	}
+}
+
+func TestCheckOverlap(t *testing.T) {
+	for _, tc := range []struct {
+		blocks  []*Block
+		wantErr bool
+	}{
+		{[]*Block{{Addr: 0x1000, Data: []byte{1, 2}}, {Addr: 0x1002, Data: []byte{3}}}, false},
+		{[]*Block{{Addr: 0x1002, Data: []byte{3}}, {Addr: 0x1000, Data: []byte{1, 2, 3}}}, true},
+		{[]*Block{{Addr: 0x1000, Data: []byte{1, 2, 3, 4}}, {Addr: 0x1001, Data: []byte{3}}}, true},
+		{[]*Block{{Addr: 0x1000, Data: []byte{}}, {Addr: 0x1000, Data: []byte{3}}}, false},
+	} {
+		if err := CheckOverlap(tc.blocks); (err != nil) != tc.wantErr {
+			t.Errorf("CheckOverlap(); got:%v, want error:%v", err, tc.wantErr)
+		}
+	}
+}
+
+func TestCheckOverlapBanks(t *testing.T) {
+	blocks := []*Block{{Addr: 0x8000, Data: []byte{1}, Bank: 0}, {Addr: 0x8000, Data: []byte{2}, Bank: 1}}
+	if err := CheckOverlap(blocks); err != nil {
+		t.Errorf("CheckOverlap() of blocks in different banks; got:%v, want:nil", err)
+	}
+}
+
+func TestSingleImageBanks(t *testing.T) {
+	blocks := []*Block{{Addr: 0x8000, Data: []byte{1}, Bank: 0}, {Addr: 0x8000, Data: []byte{2}, Bank: 1}}
+	for name, write := range Formats {
+		if name == "nes" {
+			continue
+		}
+		println(name)
+		if err := write(&bytes.Buffer{}, blocks, Options{}); err == nil || !strings.Contains(err.Error(), "bank 0 and bank 1") {
+			t.Errorf("%s: got:%v, want:bank error", name, err)
+		}
+		overlap := []*Block{{Addr: 0x8000, Data: []byte{1, 2}}, {Addr: 0x8001, Data: []byte{3}}}
+		if err := write(&bytes.Buffer{}, overlap, Options{}); err == nil || !strings.Contains(err.Error(), "overlaps") {
+			t.Errorf("%s with overlapping blocks: got:%v, want:overlap error", name, err)
+		}
+	}
+}
+
+func TestFromArea(t *testing.T) {
+	img := &link.Image{Placements: []*link.Placement{
+		{Segment: &obj.Segment{Code: []byte{1, 2}}, Addr: 0x0200, Load: 0x8002},
+		{Segment: &obj.Segment{Code: []byte{3}}, Addr: 0x9000, Load: 0x9000},
+	}}
+	area := &link.Area{Name: "ROM", Start: 0x8000, Size: 4, Fill: -1}
+	compare(t, contents(FromArea(img, area)), map[int]byte{0x8002: 1, 0x8003: 2})
+	area.Fill = 0xff
+	blocks := FromArea(img, area)
+	if len(blocks) != 1 {
+		t.Fatalf("len(FromArea()) with fill; got:%d, want:1", len(blocks))
+	}
+	compare(t, contents(blocks), map[int]byte{0x8000: 0xff, 0x8001: 0xff, 0x8002: 1, 0x8003: 2})
+}
+
+func TestFromAreaBanks(t *testing.T) {
+	img := &link.Image{Placements: []*link.Placement{
+		{Segment: &obj.Segment{Code: []byte{1}, Bank: 0}, Addr: 0x8000, Load: 0x8000},
+		{Segment: &obj.Segment{Code: []byte{2}, Bank: 1}, Addr: 0x8000, Load: 0x8000},
+	}}
+	for bank := 0; bank < 2; bank++ {
+		area := &link.Area{Name: "BANK", Start: 0x8000, Size: 2, Fill: 0xff, Bank: bank}
+		blocks := FromArea(img, area)
+		if len(blocks) != 1 || blocks[0].Bank != bank {
+			t.Fatalf("FromArea() of bank %d; got:%v, want:a single block in bank %d", bank, blocks, bank)
+		}
+		compare(t, contents(blocks), map[int]byte{0x8000: byte(bank + 1), 0x8001: 0xff})
+	}
+}
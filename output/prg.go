@@ -0,0 +1,72 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// BasicStarts are the addresses of the BASIC program on the Commodore
+// machines, by name.
+var BasicStarts = map[string]int{
+	"c64":   0x0801,
+	"vic20": 0x1001,
+	"c128":  0x1c01,
+}
+
+// tokenSYS is the BASIC token of the SYS statement.
+const tokenSYS = 0x9e
+
+// basicStub returns a tokenized BASIC program at start with a single line:
+// 10 SYS addr
+func basicStub(start int, addr int) []byte {
+	digits := strconv.Itoa(addr)
+	next := start + 2 + 2 + 1 + len(digits) + 1 // The address of the end marker.
+	stub := []byte{byte(next), byte(next >> 8), 10, 0, tokenSYS}
+	stub = append(stub, digits...)
+	return append(stub, 0, 0, 0)
+}
+
+// StubEnd returns the address directly after the BASIC stub for a
+// machine, which is where the code should start if it immediately
+// follows the stub.
+func StubEnd(machine string) (int, error) {
+	start, ok := BasicStarts[machine]
+	if !ok {
+		return 0, fmt.Errorf("unknown machine: %s", machine)
+	}
+	// The length of the stub depends on the number of digits of the
+	// address it jumps to, which is the address after the stub.
+	end := start + len(basicStub(start, start))
+	for end != start+len(basicStub(start, end)) {
+		end = start + len(basicStub(start, end))
+	}
+	return end, nil
+}
+
+// WritePRG writes a Commodore program file: the load address followed by
+// the bytes from the lowest to the highest used address. If opts.Machine
+// is set, a BASIC stub that starts the code with SYS is put at the start
+// of BASIC for that machine, so the program can be started with RUN.
+func WritePRG(w io.Writer, blocks []*Block, opts Options) error {
+	low, _, err := bounds(blocks)
+	if err != nil {
+		return err
+	}
+	if opts.Machine != "" {
+		start, ok := BasicStarts[opts.Machine]
+		if !ok {
+			return fmt.Errorf("unknown machine: %s", opts.Machine)
+		}
+		stub := basicStub(start, low)
+		if low < start+len(stub) {
+			return fmt.Errorf("code at $%04x overlaps the BASIC stub at $%04x-$%04x", low, start, start+len(stub)-1)
+		}
+		blocks = append([]*Block{{Addr: start, Data: stub}}, blocks...)
+		low = start
+	}
+	if _, err := w.Write([]byte{byte(low), byte(low >> 8)}); err != nil {
+		return err
+	}
+	return WriteBin(w, blocks, opts)
+}
@@ -0,0 +1,50 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePRG(t *testing.T) {
+	for _, tc := range []struct {
+		machine string
+		addr    int
+		want    []byte
+	}{
+		{"", 0xc000, []byte{0x00, 0xc0, 0xea, 0x60}},
+		{"c64", 0x080d, []byte{0x01, 0x08, 0x0b, 0x08, 10, 0, 0x9e, '2', '0', '6', '1', 0, 0, 0, 0xea, 0x60}},
+		{"vic20", 0x100d, []byte{0x01, 0x10, 0x0b, 0x10, 10, 0, 0x9e, '4', '1', '0', '9', 0, 0, 0, 0xea, 0x60}},
+		{"c128", 0x1c0f, []byte{0x01, 0x1c, 0x0b, 0x1c, 10, 0, 0x9e, '7', '1', '8', '3', 0, 0, 0, 0xff, 0xff, 0xea, 0x60}},
+	} {
+		println(tc.machine)
+		var buf bytes.Buffer
+		blocks := []*Block{{Addr: tc.addr, Data: []byte{0xea, 0x60}}}
+		if err := WritePRG(&buf, blocks, Options{Machine: tc.machine, Fill: 0xff}); err != nil {
+			t.Fatalf("WritePRG(); got:%v, want:nil", err)
+		}
+		if !bytes.Equal(buf.Bytes(), tc.want) {
+			t.Errorf("WritePRG(); got:% x, want:% x", buf.Bytes(), tc.want)
+		}
+	}
+}
+
+func TestStubEnd(t *testing.T) {
+	for machine, want := range map[string]int{"c64": 2061, "vic20": 4109, "c128": 7181} {
+		if got, err := StubEnd(machine); err != nil || got != want {
+			t.Errorf("StubEnd(%s); got:%d/%v, want:%d/nil", machine, got, err, want)
+		}
+	}
+	if _, err := StubEnd("pet"); err == nil {
+		t.Errorf("StubEnd(pet); got:nil, want:error")
+	}
+}
+
+func TestWritePRGErrors(t *testing.T) {
+	blocks := []*Block{{Addr: 0x0805, Data: []byte{0x60}}}
+	if err := WritePRG(&bytes.Buffer{}, blocks, Options{Machine: "c64"}); err == nil {
+		t.Errorf("WritePRG() with code in the stub; got:nil, want:error")
+	}
+	if err := WritePRG(&bytes.Buffer{}, blocks, Options{Machine: "pet"}); err == nil {
+		t.Errorf("WritePRG() for unknown machine; got:nil, want:error")
+	}
+}
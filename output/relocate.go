@@ -0,0 +1,237 @@
+package output
+
+import (
+	"fmt"
+	"sort"
+	"v65/link"
+	"v65/obj"
+)
+
+// Opcodes of the instructions of the relocator.
+const (
+	opSEC    = 0x38
+	opCLC    = 0x18
+	opTAX    = 0xaa
+	opTXA    = 0x8a
+	opINY    = 0xc8
+	opDEX    = 0xca
+	opLDAImm = 0xa9
+	opLDXImm = 0xa2
+	opLDYImm = 0xa0
+	opADCImm = 0x69
+	opSBCImm = 0xe9
+	opCMPImm = 0xc9
+	opCPXImm = 0xe0
+	opLDA    = 0xad
+	opSTA    = 0x8d
+	opADC    = 0x6d
+	opINC    = 0xee
+	opJMP    = 0x4c
+	opLDAY   = 0xb9
+	opSTAY   = 0x99
+	opBNE    = 0xd0
+	opBEQ    = 0xf0
+)
+
+// Relocatable returns the blocks of a linked image, followed by a block
+// with a routine that moves the program by whole pages and the relocation
+// table that the routine uses. It returns the address of the routine too.
+//
+// The routine is called with the page to move the first page of the
+// program to in A. It adds the page offset to the high bytes of the
+// addresses in the program, copies the program to its new place, which
+// must not overlap the pages of the loaded file, and jumps to the run
+// address of the program, or to its first byte if it has none. The
+// routine changes itself, so it can only run once.
+//
+// Every byte of the table is the distance from the previous high byte to
+// patch, the first one from the byte before the program. A distance of
+// 255 means 254 without a patch, and 0 ends the table.
+func Relocatable(img *link.Image) ([]*Block, int, error) {
+	blocks := FromImage(img)
+	if len(blocks) == 0 {
+		return nil, 0, fmt.Errorf("empty program")
+	}
+	for _, p := range img.Placements {
+		if p.Segment.Absolute && len(p.Segment.Code) > 0 {
+			return nil, 0, fmt.Errorf("%s: absolute segment %s cannot be moved", p.Module, p.Segment.Name)
+		}
+	}
+	low, high, err := bounds(blocks)
+	if err != nil {
+		return nil, 0, err
+	}
+	table, err := relocTable(img.Fixups, low)
+	if err != nil {
+		return nil, 0, err
+	}
+	start := low
+	for _, v := range img.Vectors {
+		if v.Kind == obj.Run {
+			start = v.Addr
+		}
+	}
+	pages := (high-1)>>8 - low>>8 + 1
+	code := relocator(high, low, start, pages)
+	code = append(code, table...)
+	if high+len(code) > 0x10000 {
+		return nil, 0, fmt.Errorf("relocator does not fit in memory: ends at $%x", high+len(code))
+	}
+	return append(blocks, &Block{Addr: high, Data: code}), high, nil
+}
+
+// relocTable returns the relocation table for the fixups of a program that
+// starts at address low.
+func relocTable(fixups []*link.Fixup, low int) ([]byte, error) {
+	var addrs []int
+	for _, f := range fixups {
+		switch {
+		case f.Size == 2 && f.Part == obj.All:
+			// The high byte of a word comes second.
+			addrs = append(addrs, f.Addr+1)
+		case f.Size == 1 && f.Part == obj.High:
+			addrs = append(addrs, f.Addr)
+		case f.Size == 1 && f.Part == obj.Low:
+			// The low byte does not change.
+		default:
+			return nil, fmt.Errorf("%s: value at $%x cannot be moved by pages", f.Module, f.Addr)
+		}
+	}
+	sort.Ints(addrs)
+	var table []byte
+	prev := low - 1
+	for _, addr := range addrs {
+		d := addr - prev
+		if d == 0 {
+			continue
+		}
+		for ; d > 254; d -= 254 {
+			table = append(table, 255)
+		}
+		table = append(table, byte(d))
+		prev = addr
+	}
+	return append(table, 0), nil
+}
+
+// routine is 6502 code with labels, which is assembled at an address.
+type routine struct {
+	addr   int
+	code   []byte
+	labels map[string]int
+	refs   map[int]string // The operands that hold the address of a label.
+	rels   map[int]string // The operands of the branches.
+}
+
+// op appends an instruction with a byte operand, or none.
+func (r *routine) op(opcode byte, operand ...byte) {
+	r.code = append(r.code, opcode)
+	r.code = append(r.code, operand...)
+}
+
+// abs appends an instruction with an address, low byte first.
+func (r *routine) abs(opcode byte, addr int) {
+	r.op(opcode, byte(addr), byte(addr>>8))
+}
+
+// ref appends an instruction with the address of a label plus offset.
+func (r *routine) ref(opcode byte, label string, offset int) {
+	r.abs(opcode, offset)
+	r.refs[len(r.code)-2] = label
+}
+
+// branch appends a branch to a label.
+func (r *routine) branch(opcode byte, label string) {
+	r.op(opcode, 0)
+	r.rels[len(r.code)-1] = label
+}
+
+// label defines a label at the next instruction.
+func (r *routine) label(name string) {
+	r.labels[name] = len(r.code)
+}
+
+// resolve fills in the addresses of the labels and returns the code.
+func (r *routine) resolve() []byte {
+	for at, label := range r.refs {
+		addr := r.addr + r.labels[label] + int(r.code[at])
+		r.code[at], r.code[at+1] = byte(addr), byte(addr>>8)
+	}
+	for at, label := range r.rels {
+		r.code[at] = byte(r.labels[label] - (at + 1))
+	}
+	return r.code
+}
+
+// relocator returns the routine that moves a program from low to high,
+// which starts at start, by whole pages. It is assembled at addr, and the
+// relocation table follows it. The routine changes the operands of its
+// own instructions: the low byte is at label+1, the high byte at label+2.
+func relocator(addr, low, start, pages int) []byte {
+	r := &routine{addr: addr, labels: make(map[string]int), refs: make(map[int]string), rels: make(map[int]string)}
+
+	// Compute the page offset and the addresses that depend on it.
+	r.ref(opSTA, "dst", 2)
+	r.op(opSEC)
+	r.op(opSBCImm, byte(low>>8))
+	r.ref(opSTA, "add", 1)
+	r.op(opCLC)
+	r.op(opADCImm, byte(start>>8))
+	r.ref(opSTA, "run", 2)
+
+	// Read the next distance from the table.
+	r.label("next")
+	r.ref(opLDA, "table", 0)
+	r.op(opTAX)
+	r.ref(opINC, "next", 1)
+	r.branch(opBNE, "read")
+	r.ref(opINC, "next", 2)
+	r.label("read")
+	r.op(opTXA)
+	r.branch(opBEQ, "copy")
+
+	// Move the pointer to the high byte to patch.
+	r.op(opCMPImm, 255)
+	r.branch(opBNE, "move")
+	r.op(opLDAImm, 254)
+	r.label("move")
+	r.op(opCLC)
+	r.ref(opADC, "load", 1)
+	r.ref(opSTA, "load", 1)
+	r.ref(opSTA, "store", 1)
+	r.ref(opLDA, "load", 2)
+	r.op(opADCImm, 0)
+	r.ref(opSTA, "load", 2)
+	r.ref(opSTA, "store", 2)
+	r.op(opCPXImm, 255)
+	r.branch(opBEQ, "next")
+
+	// Add the page offset.
+	r.label("load")
+	r.abs(opLDA, low-1)
+	r.op(opCLC)
+	r.label("add")
+	r.op(opADCImm, 0)
+	r.label("store")
+	r.abs(opSTA, low-1)
+	r.ref(opJMP, "next", 0)
+
+	// Copy the program page by page, and run it.
+	r.label("copy")
+	r.op(opLDXImm, byte(pages))
+	r.op(opLDYImm, 0)
+	r.label("src")
+	r.abs(opLDAY, low&^0xff)
+	r.label("dst")
+	r.abs(opSTAY, low&^0xff)
+	r.op(opINY)
+	r.branch(opBNE, "src")
+	r.ref(opINC, "src", 2)
+	r.ref(opINC, "dst", 2)
+	r.op(opDEX)
+	r.branch(opBNE, "src")
+	r.label("run")
+	r.abs(opJMP, start)
+	r.label("table")
+	return r.resolve()
+}
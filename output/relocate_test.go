@@ -0,0 +1,233 @@
+package output
+
+import (
+	"strings"
+	"testing"
+	"v65/link"
+	"v65/obj"
+)
+
+// relocModules returns a program with references to its code and data,
+// to a constant, and a table far enough from the code to need a distance
+// of more than 254.
+func relocModules() []*obj.Module {
+	code := []byte{
+		0xa9, 0, // lda #>table
+		0xa2, 0, // ldx #<table
+		0xad, 0, 0, // lda table+1
+		0x20, 0, 0, // jsr sub
+		0x8d, 0x00, 0xd0, // sta $d000
+		0x60, // sub: rts
+	}
+	return []*obj.Module{
+		{
+			Name: "main",
+			Segments: []*obj.Segment{
+				{
+					Name: "code",
+					Code: code,
+					Relocs: []*obj.Reloc{
+						{Offset: 1, Size: 1, Segment: "data", Part: obj.High},
+						{Offset: 3, Size: 1, Segment: "data", Part: obj.Low},
+						{Offset: 5, Size: 2, Segment: "data", Addend: 1},
+						{Offset: 8, Size: 2, Segment: "code", Addend: 13, Call: true},
+					},
+				},
+				{
+					Name:   "data",
+					Code:   append(make([]byte, 600), 0, 0),
+					Relocs: []*obj.Reloc{{Offset: 600, Size: 2, Segment: "code", Addend: 13}},
+				},
+			},
+			Vectors: []*obj.Vector{{Kind: obj.Run, Segment: "code", Value: 2, AtSegment: "code"}},
+		},
+	}
+}
+
+// relocate applies the relocation table of a relocatable program in
+// memory for a page offset, and moves the program, like the relocator.
+func relocate(mem map[int]byte, table []byte, low, high, offset int) map[int]byte {
+	addr := low - 1
+	for _, d := range table {
+		if d == 0 {
+			break
+		}
+		if d == 255 {
+			addr += 254
+			continue
+		}
+		addr += int(d)
+		mem[addr] += byte(offset)
+	}
+	moved := make(map[int]byte)
+	for a := low; a < high; a++ {
+		moved[a+offset<<8] = mem[a]
+	}
+	return moved
+}
+
+func TestRelocatable(t *testing.T) {
+	img, err := link.Link(relocModules(), 0x1000)
+	if err != nil {
+		t.Fatalf("link.Link(); got:%v, want:nil", err)
+	}
+	blocks, entry, err := Relocatable(img)
+	if err != nil {
+		t.Fatalf("Relocatable(); got:%v, want:nil", err)
+	}
+	high := 0x1000 + 14 + 602
+	if entry != high {
+		t.Errorf("entry; got:$%x, want:$%x", entry, high)
+	}
+	last := blocks[len(blocks)-1]
+	size := len(relocator(0, 0, 0, 1))
+	table := last.Data[size:]
+	if want := []byte{2, 5, 3, 255, 255, 98, 0}; string(table) != string(want) {
+		t.Errorf("table; got:%v, want:%v", table, want)
+	}
+	// The routine reads the table, and runs the program at start+2.
+	if got := last.Data[size-3 : size]; string(got) != string([]byte{0x4c, 0x02, 0x10}) {
+		t.Errorf("jmp; got:% x, want:4c 02 10", got)
+	}
+	if i := strings.Index(string(last.Data), string([]byte{0xad, byte(entry + size), byte((entry + size) >> 8)})); i < 0 {
+		t.Errorf("lda table; not found in % x", last.Data[:size])
+	}
+
+	for _, offset := range []int{1, 0x20, 0x6f} {
+		got := relocate(contents(blocks), table, 0x1000, high, offset)
+		want, err := link.Link(relocModules(), 0x1000+offset<<8)
+		if err != nil {
+			t.Fatalf("link.Link(); got:%v, want:nil", err)
+		}
+		compare(t, got, contents(FromImage(want)))
+	}
+}
+
+// cpu runs the instructions that the relocator uses.
+type cpu struct {
+	mem     map[int]byte
+	a, x, y byte
+	pc      int
+	z, c    bool
+}
+
+// step runs the instruction at pc, and returns false if it is unknown.
+func (c *cpu) step() bool {
+	op, imm := c.mem[c.pc], c.mem[c.pc+1]
+	addr := int(imm) | int(c.mem[c.pc+2])<<8
+	set := func(v byte) byte {
+		c.z = v == 0
+		return v
+	}
+	add := func(v byte) {
+		sum := int(c.a) + int(v)
+		if c.c {
+			sum++
+		}
+		c.c = sum > 0xff
+		c.a = set(byte(sum))
+	}
+	next := c.pc + 3
+	switch op {
+	case opSEC, opCLC:
+		c.c, next = op == opSEC, c.pc+1
+	case opTAX:
+		c.x, next = set(c.a), c.pc+1
+	case opTXA:
+		c.a, next = set(c.x), c.pc+1
+	case opINY:
+		c.y, next = set(c.y+1), c.pc+1
+	case opDEX:
+		c.x, next = set(c.x-1), c.pc+1
+	case opLDAImm:
+		c.a, next = set(imm), c.pc+2
+	case opLDXImm:
+		c.x, next = set(imm), c.pc+2
+	case opLDYImm:
+		c.y, next = set(imm), c.pc+2
+	case opADCImm:
+		add(imm)
+		next = c.pc + 2
+	case opSBCImm:
+		add(^imm)
+		next = c.pc + 2
+	case opCMPImm, opCPXImm:
+		v := c.a
+		if op == opCPXImm {
+			v = c.x
+		}
+		c.c = v >= imm
+		set(v - imm)
+		next = c.pc + 2
+	case opLDA:
+		c.a = set(c.mem[addr])
+	case opSTA:
+		c.mem[addr] = c.a
+	case opADC:
+		add(c.mem[addr])
+	case opINC:
+		c.mem[addr] = set(c.mem[addr] + 1)
+	case opJMP:
+		next = addr
+	case opLDAY:
+		c.a = set(c.mem[(addr+int(c.y))&0xffff])
+	case opSTAY:
+		c.mem[(addr+int(c.y))&0xffff] = c.a
+	case opBNE, opBEQ:
+		next = c.pc + 2
+		if c.z == (op == opBEQ) {
+			next += int(int8(imm))
+		}
+	default:
+		return false
+	}
+	c.pc = next
+	return true
+}
+
+func TestRelocator(t *testing.T) {
+	img, err := link.Link(relocModules(), 0x1080)
+	if err != nil {
+		t.Fatalf("link.Link(); got:%v, want:nil", err)
+	}
+	blocks, entry, err := Relocatable(img)
+	if err != nil {
+		t.Fatalf("Relocatable(); got:%v, want:nil", err)
+	}
+	c := &cpu{mem: contents(blocks), a: 0x40, pc: entry}
+	for steps := 0; c.pc != 0x4082; steps++ {
+		if steps == 100000 || !c.step() {
+			t.Fatalf("relocator stopped at $%04x, opcode $%02x", c.pc, c.mem[c.pc])
+		}
+	}
+	want, err := link.Link(relocModules(), 0x4080)
+	if err != nil {
+		t.Fatalf("link.Link(); got:%v, want:nil", err)
+	}
+	for addr, v := range contents(FromImage(want)) {
+		if c.mem[addr] != v {
+			t.Errorf("byte at $%04x; got:$%02x, want:$%02x", addr, c.mem[addr], v)
+		}
+	}
+}
+
+func TestRelocatableErrors(t *testing.T) {
+	mods := relocModules()
+	mods[0].Segments[1].Absolute = true
+	mods[0].Segments[1].Addr = 0x2000
+	img, err := link.Link(mods, 0x1000)
+	if err != nil {
+		t.Fatalf("link.Link(); got:%v, want:nil", err)
+	}
+	if _, _, err := Relocatable(img); err == nil || !strings.Contains(err.Error(), "absolute segment data cannot be moved") {
+		t.Errorf("Relocatable() with an absolute segment; got:%v, want:absolute segment error", err)
+	}
+	img, err = link.Link(relocModules(), 0x1000)
+	if err != nil {
+		t.Fatalf("link.Link(); got:%v, want:nil", err)
+	}
+	img.Fixups = append(img.Fixups, &link.Fixup{Module: "main", Addr: 0x1003, Size: 1})
+	if _, _, err := Relocatable(img); err == nil || !strings.Contains(err.Error(), "main: value at $1003 cannot be moved by pages") {
+		t.Errorf("Relocatable() with a zero page address; got:%v, want:cannot be moved error", err)
+	}
+}
@@ -0,0 +1,38 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// writeSRecord writes a Motorola S-record with a 16-bit address. The
+// checksum is the one's complement of the sum of the count, address and
+// data bytes.
+func writeSRecord(w io.Writer, typ byte, addr int, data []byte) {
+	count := byte(len(data) + 3)
+	sum := count + byte(addr>>8) + byte(addr)
+	fmt.Fprintf(w, "S%c%02X%04X", typ, count, addr&0xffff)
+	for _, b := range data {
+		fmt.Fprintf(w, "%02X", b)
+		sum += b
+	}
+	fmt.Fprintf(w, "%02X\n", ^sum)
+}
+
+// WriteSRec writes the blocks as Motorola S-records (S19): a header
+// record (S0), data records (S1) and a termination record (S9) with the
+// lowest address as the start address.
+func WriteSRec(w io.Writer, blocks []*Block, opts Options) error {
+	low, _, err := bounds(blocks)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	writeSRecord(bw, '0', 0, []byte("v65"))
+	chunks(blocks, func(addr int, data []byte) {
+		writeSRecord(bw, '1', addr, data)
+	})
+	writeSRecord(bw, '9', low, nil)
+	return bw.Flush()
+}
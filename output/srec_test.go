@@ -0,0 +1,64 @@
+package output
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// parseSRec parses S19 records and returns the memory contents and the
+// start address.
+func parseSRec(t *testing.T, s string) (map[int]byte, int) {
+	mem := make(map[int]byte)
+	start := -1
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		if len(line) < 2 || line[0] != 'S' {
+			t.Fatalf("record %d does not start with 'S': %q", i, line)
+		}
+		rec, err := hex.DecodeString(line[2:])
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if int(rec[0]) != len(rec)-1 {
+			t.Fatalf("record %d count; got:%d, want:%d", i, rec[0], len(rec)-1)
+		}
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0xff {
+			t.Errorf("record %d checksum; got:$%02x, want:$ff", i, sum)
+		}
+		addr := int(rec[1])<<8 | int(rec[2])
+		switch line[1] {
+		case '0':
+			if i != 0 {
+				t.Errorf("header record %d is not the first one", i)
+			}
+		case '1':
+			for j, b := range rec[3 : len(rec)-1] {
+				mem[addr+j] = b
+			}
+		case '9':
+			start = addr
+		default:
+			t.Errorf("record %d type; got:S%c, want:S0, S1 or S9", i, line[1])
+		}
+	}
+	return mem, start
+}
+
+func TestWriteSRec(t *testing.T) {
+	blocks := testBlocks(t)
+	var buf bytes.Buffer
+	if err := WriteSRec(&buf, blocks, Options{}); err != nil {
+		t.Fatalf("WriteSRec(); got:%v, want:nil", err)
+	}
+	mem, start := parseSRec(t, buf.String())
+	compare(t, mem, contents(blocks))
+	if start != 0x1000 {
+		t.Errorf("start address; got:$%04x, want:$1000", start)
+	}
+}
@@ -0,0 +1,70 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"v65/link"
+	"v65/obj"
+)
+
+// Addresses of the vectors of Atari DOS.
+const (
+	runad  = 0x02e0
+	initad = 0x02e2
+)
+
+// xexSegment appends a segment of an Atari binary load file: the start and
+// end address (inclusive), followed by the data.
+func xexSegment(out []byte, addr int, data []byte) []byte {
+	end := addr + len(data) - 1
+	out = append(out, byte(addr), byte(addr>>8), byte(end), byte(end>>8))
+	return append(out, data...)
+}
+
+// WriteXEX writes an Atari binary load file (XEX). Every block becomes a
+// segment. The init vectors in opts.Vectors are written as INITAD segments
+// directly after the block that ends where they were defined, so that DOS
+// calls them while loading. A run vector is written as the RUNAD segment
+// at the end.
+func WriteXEX(w io.Writer, blocks []*Block, opts Options) error {
+	if _, _, err := bounds(blocks); err != nil {
+		return err
+	}
+	out := []byte{0xff, 0xff}
+	written := make(map[*link.Vector]bool)
+	var run *link.Vector
+	for _, v := range opts.Vectors {
+		if v.Kind == obj.Run {
+			if run != nil {
+				return fmt.Errorf("more than one run address: $%04x and $%04x", run.Addr, v.Addr)
+			}
+			run = v
+		}
+	}
+	vector := func(addr int, v *link.Vector) {
+		out = xexSegment(out, addr, []byte{byte(v.Addr), byte(v.Addr >> 8)})
+		written[v] = true
+	}
+	for _, b := range blocks {
+		if len(b.Data) == 0 {
+			continue
+		}
+		out = xexSegment(out, b.Addr, b.Data)
+		for _, v := range opts.Vectors {
+			if v.Kind == obj.Init && !written[v] && v.At > b.Addr && v.At <= b.Addr+len(b.Data) {
+				vector(initad, v)
+			}
+		}
+	}
+	// Init vectors that were not defined after any code.
+	for _, v := range opts.Vectors {
+		if v.Kind == obj.Init && !written[v] {
+			vector(initad, v)
+		}
+	}
+	if run != nil {
+		vector(runad, run)
+	}
+	_, err := w.Write(out)
+	return err
+}
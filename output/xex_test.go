@@ -0,0 +1,74 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"v65/link"
+	"v65/obj"
+)
+
+// xexSegments parses an Atari binary load file into its segments.
+func xexSegments(t *testing.T, data []byte) []*Block {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xff {
+		t.Fatalf("XEX header; got:% x, want:ff ff", data[:2])
+	}
+	var blocks []*Block
+	for i := 2; i < len(data); {
+		if len(data) < i+4 {
+			t.Fatalf("segment header at %d is truncated", i)
+		}
+		start := int(data[i]) | int(data[i+1])<<8
+		end := int(data[i+2]) | int(data[i+3])<<8
+		i += 4
+		if end < start || len(data) < i+end-start+1 {
+			t.Fatalf("segment $%04x-$%04x is invalid", start, end)
+		}
+		blocks = append(blocks, &Block{Addr: start, Data: data[i : i+end-start+1]})
+		i += end - start + 1
+	}
+	return blocks
+}
+
+func TestWriteXEX(t *testing.T) {
+	blocks := []*Block{
+		{Addr: 0x2000, Data: []byte{0xa9, 0x01, 0x60}},
+		{Addr: 0x3000, Data: []byte{0xea, 0x60}},
+	}
+	vectors := []*link.Vector{
+		{Kind: obj.Run, Addr: 0x3000, At: 0x3002},
+		{Kind: obj.Init, Addr: 0x2000, At: 0x2003},
+	}
+	var buf bytes.Buffer
+	if err := WriteXEX(&buf, blocks, Options{Vectors: vectors}); err != nil {
+		t.Fatalf("WriteXEX(); got:%v, want:nil", err)
+	}
+	got := xexSegments(t, buf.Bytes())
+	want := []*Block{
+		blocks[0],
+		{Addr: initad, Data: []byte{0x00, 0x20}},
+		blocks[1],
+		{Addr: runad, Data: []byte{0x00, 0x30}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("number of segments; got:%d, want:%d", len(got), len(want))
+	}
+	for i, b := range want {
+		if got[i].Addr != b.Addr || !bytes.Equal(got[i].Data, b.Data) {
+			t.Errorf("segment %d; got:$%04x % x, want:$%04x % x", i, got[i].Addr, got[i].Data, b.Addr, b.Data)
+		}
+	}
+}
+
+func TestWriteXEXErrors(t *testing.T) {
+	blocks := []*Block{
+		{Addr: 0x2000, Data: []byte{1, 2, 3}},
+		{Addr: 0x2002, Data: []byte{4}},
+	}
+	if err := WriteXEX(&bytes.Buffer{}, blocks, Options{}); err == nil {
+		t.Errorf("WriteXEX() with overlapping blocks; got:nil, want:error")
+	}
+	vectors := []*link.Vector{{Kind: obj.Run, Addr: 0x2000}, {Kind: obj.Run, Addr: 0x2001}}
+	if err := WriteXEX(&bytes.Buffer{}, blocks[:1], Options{Vectors: vectors}); err == nil {
+		t.Errorf("WriteXEX() with two run addresses; got:nil, want:error")
+	}
+}
@@ -0,0 +1,101 @@
+// Package symfile writes symbol tables in the formats that emulators and
+// their debuggers understand.
+package symfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Symbol is a symbol in the symbol table of an assembled source.
+type Symbol struct {
+	Name    string `json:"name"`
+	Segment string `json:"segment,omitempty"` // "" for constants.
+	Value   int64  `json:"value"`
+	Global  bool   `json:"global"`
+	Line    int    `json:"line"` // The line of the source that defines it.
+}
+
+// Writer writes a symbol table in a particular format.
+type Writer func(w io.Writer, syms []*Symbol) error
+
+// Formats are the supported symbol file formats, by name.
+var Formats = map[string]Writer{
+	"vice":    WriteVICE,
+	"generic": WriteGeneric,
+	"mame":    WriteMAME,
+	"mesen":   WriteMesen,
+	"json":    WriteJSON,
+}
+
+// FormatNames returns the names of the supported formats, sorted.
+func FormatNames() []string {
+	var names []string
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeLines writes a line for every symbol, formatted by line.
+func writeLines(w io.Writer, syms []*Symbol, line func(sym *Symbol) string) error {
+	for _, sym := range syms {
+		if _, err := fmt.Fprintln(w, line(sym)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteVICE writes a label file for the VICE monitor, which can be loaded
+// with its load_labels command.
+func WriteVICE(w io.Writer, syms []*Symbol) error {
+	return writeLines(w, syms, func(sym *Symbol) string {
+		return fmt.Sprintf("al C:%04x .%s", sym.Value&0xffff, sym.Name)
+	})
+}
+
+// WriteGeneric writes the symbols as assignments: name = $addr
+func WriteGeneric(w io.Writer, syms []*Symbol) error {
+	return writeLines(w, syms, func(sym *Symbol) string {
+		return fmt.Sprintf("%s = $%04x", sym.Name, sym.Value&0xffff)
+	})
+}
+
+// WriteMAME writes a script for the MAME debugger (-debugscript) that
+// adds a comment with the name of each symbol at its address.
+func WriteMAME(w io.Writer, syms []*Symbol) error {
+	return writeLines(w, syms, func(sym *Symbol) string {
+		return fmt.Sprintf("comadd %04x,%s", sym.Value&0xffff, sym.Name)
+	})
+}
+
+// WriteMesen writes a Mesen label file (.mlb). Mesen labels are relative
+// to a memory type. This assumes the NES memory map without bank
+// switching: internal RAM below $0800, PRG ROM from $8000 and registers
+// in between.
+func WriteMesen(w io.Writer, syms []*Symbol) error {
+	return writeLines(w, syms, func(sym *Symbol) string {
+		addr := sym.Value & 0xffff
+		switch {
+		case addr < 0x0800:
+			return fmt.Sprintf("R:%04X:%s", addr, sym.Name)
+		case addr >= 0x8000:
+			return fmt.Sprintf("P:%04X:%s", addr-0x8000, sym.Name)
+		}
+		return fmt.Sprintf("G:%04X:%s", addr, sym.Name)
+	})
+}
+
+// WriteJSON writes the symbols as a JSON array.
+func WriteJSON(w io.Writer, syms []*Symbol) error {
+	if syms == nil {
+		syms = []*Symbol{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(syms)
+}
@@ -0,0 +1,57 @@
+package symfile
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriters(t *testing.T) {
+	syms := []*Symbol{
+		{Name: "ptr", Value: 0xfb, Line: 1},
+		{Name: "start", Segment: "code", Value: 0xc000, Global: true, Line: 3},
+	}
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{"vice", "al C:00fb .ptr\nal C:c000 .start\n"},
+		{"generic", "ptr = $00fb\nstart = $c000\n"},
+		{"mame", "comadd 00fb,ptr\ncomadd c000,start\n"},
+		{"mesen", "R:00FB:ptr\nP:4000:start\n"},
+		{"json", `[
+  {
+    "name": "ptr",
+    "value": 251,
+    "global": false,
+    "line": 1
+  },
+  {
+    "name": "start",
+    "segment": "code",
+    "value": 49152,
+    "global": true,
+    "line": 3
+  }
+]
+`},
+	} {
+		println(tc.format)
+		var buf bytes.Buffer
+		if err := Formats[tc.format](&buf, syms); err != nil {
+			t.Errorf("%s: got:%v, want:nil", tc.format, err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("%s; got:%q, want:%q", tc.format, got, tc.want)
+		}
+	}
+}
+
+func TestWriteGenericNegative(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGeneric(&buf, []*Symbol{{Name: "back", Value: -1}}); err != nil {
+		t.Fatalf("WriteGeneric(); got:%v, want:nil", err)
+	}
+	if got, want := buf.String(), "back = $ffff\n"; got != want {
+		t.Errorf("WriteGeneric(); got:%q, want:%q", got, want)
+	}
+}